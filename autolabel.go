@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AutolabelSettings maps changed paths to PR labels. Each rule applies to
+// the repositories matching Repos ("owner/repo" globs; empty means all) and
+// adds Label when any changed file matches one of Paths. Path patterns are
+// path.Match globs where a "**" segment matches any number of directories,
+// e.g. "docs/**" or "**/*_test.go".
+//
+// Labels a rule manages are removed again once no file matches. Missing
+// labels are created with Color (hex, no "#") and Description.
+type AutolabelSettings struct {
+	Rules []AutolabelRule `json:"rules"`
+}
+
+type AutolabelRule struct {
+	Label       string   `json:"label"`
+	Paths       []string `json:"paths"`
+	Repos       []string `json:"repos"`
+	Color       string   `json:"color"`
+	Description string   `json:"description"`
+}
+
+var labelColor = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+
+func (s AutolabelSettings) validate() error {
+	for i, rule := range s.Rules {
+		if rule.Label == "" {
+			return fmt.Errorf("rule %d has no label", i)
+		}
+		if len(rule.Paths) == 0 {
+			return fmt.Errorf("rule %q has no paths", rule.Label)
+		}
+		if err := validateGlobs(rule.Paths); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Label, err)
+		}
+		if err := validatePatterns(rule.Repos); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Label, err)
+		}
+		if rule.Color != "" && !labelColor.MatchString(rule.Color) {
+			return fmt.Errorf("rule %q: color must be six hex digits", rule.Label)
+		}
+	}
+	return nil
+}
+
+// validateGlobs checks patterns for matchGlob.
+func validateGlobs(patterns []string) error {
+	for _, pattern := range patterns {
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("bad pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether name matches pattern, where a "**" segment
+// matches zero or more path segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// LabelChange records the labels the bot added to or removed from a PR.
+type LabelChange struct {
+	Added   []string
+	Removed []string
+}
+
+// autolabel brings the PR's rule-managed labels in line with its changed
+// files and returns what it changed. Failures are logged; the returned
+// change only lists what was applied.
+func (rb *ReviewBot) autolabel(ctx context.Context, owner, repo string, pr *github.PullRequest) LabelChange {
+	var change LabelChange
+	repository := owner + "/" + repo
+	var rules []AutolabelRule
+	for _, rule := range rb.config.Settings.Autolabel.Rules {
+		if len(rule.Repos) == 0 || matchesAny(rule.Repos, repository) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return change
+	}
+
+	ctx, span := tracer().Start(ctx, "autolabel", trace.WithAttributes(prAttributes(owner, repo, pr.GetNumber())...))
+	defer span.End()
+
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to list files for autolabel on %s#%d: %v", repository, pr.GetNumber(), err)
+		return change
+	}
+
+	managed := make(map[string]AutolabelRule)
+	wanted := make(map[string]bool)
+	for _, rule := range rules {
+		if _, ok := managed[rule.Label]; !ok {
+			managed[rule.Label] = rule
+		}
+		for _, file := range files {
+			if matchesAnyGlob(rule.Paths, file.GetFilename()) {
+				wanted[rule.Label] = true
+				break
+			}
+		}
+	}
+
+	current := make(map[string]bool)
+	for _, l := range pr.Labels {
+		current[l.GetName()] = true
+	}
+
+	var add []string
+	for label := range wanted {
+		if current[label] {
+			continue
+		}
+		if err := rb.ensureLabel(ctx, owner, repo, managed[label]); err != nil {
+			log.Printf("Failed to create label %q in %s: %v", label, repository, err)
+			continue
+		}
+		add = append(add, label)
+	}
+	sort.Strings(add)
+	if len(add) > 0 {
+		if _, _, err := rb.client.Issues.AddLabelsToIssue(ctx, owner, repo, pr.GetNumber(), add); err != nil {
+			span.RecordError(err)
+			log.Printf("Failed to add labels %v to %s#%d: %v", add, repository, pr.GetNumber(), err)
+		} else {
+			change.Added = add
+		}
+	}
+
+	var remove []string
+	for label := range managed {
+		if current[label] && !wanted[label] {
+			remove = append(remove, label)
+		}
+	}
+	sort.Strings(remove)
+	for _, label := range remove {
+		if _, err := rb.client.Issues.RemoveLabelForIssue(ctx, owner, repo, pr.GetNumber(), label); err != nil && !isNotFound(err) {
+			span.RecordError(err)
+			log.Printf("Failed to remove label %q from %s#%d: %v", label, repository, pr.GetNumber(), err)
+			continue
+		}
+		change.Removed = append(change.Removed, label)
+	}
+	return change
+}
+
+func matchesAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureLabel creates rule's label in the repository if it doesn't exist
+// yet, so it gets the configured color rather than GitHub's default.
+func (rb *ReviewBot) ensureLabel(ctx context.Context, owner, repo string, rule AutolabelRule) error {
+	_, _, err := rb.client.Issues.GetLabel(ctx, owner, repo, rule.Label)
+	if err == nil || !isNotFound(err) {
+		return err
+	}
+	label := &github.Label{Name: github.String(rule.Label)}
+	if rule.Color != "" {
+		label.Color = github.String(strings.ToLower(rule.Color))
+	}
+	if rule.Description != "" {
+		label.Description = github.String(rule.Description)
+	}
+	_, _, err = rb.client.Issues.CreateLabel(ctx, owner, repo, label)
+	return err
+}
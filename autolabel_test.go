@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"docs/**", "docs/guide/intro.md", true},
+		{"docs/**", "docs/index.md", true},
+		{"docs/**", "src/docs/index.md", false},
+		{"**/*_test.go", "main_test.go", true},
+		{"**/*_test.go", "pkg/a/b/c_test.go", true},
+		{"**/*_test.go", "pkg/a/b/c.go", false},
+		{"api/**/*.proto", "api/v1/service.proto", true},
+		{"api/**/*.proto", "api/service.proto", true},
+		{"Dockerfile", "build/Dockerfile", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAutolabel(t *testing.T) {
+	var added, removed []string
+	var created []*github.Label
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{
+			{Filename: github.String("docs/setup.md")},
+			{Filename: github.String("store/store_test.go")},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/labels/documentation", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.Label{Name: github.String("documentation")})
+	})
+	mux.HandleFunc("/repos/o/r/labels/tests", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+	})
+	mux.HandleFunc("/repos/o/r/labels", func(w http.ResponseWriter, r *http.Request) {
+		var label github.Label
+		json.NewDecoder(r.Body).Decode(&label)
+		created = append(created, &label)
+		json.NewEncoder(w).Encode(&label)
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		var labels []string
+		json.NewDecoder(r.Body).Decode(&labels)
+		added = append(added, labels...)
+		json.NewEncoder(w).Encode([]*github.Label{})
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels/", func(w http.ResponseWriter, r *http.Request) {
+		removed = append(removed, strings.TrimPrefix(r.URL.Path, "/repos/o/r/issues/1/labels/"))
+	})
+
+	bot := newTestBot(t, mux)
+	bot.config.Settings.Autolabel = AutolabelSettings{Rules: []AutolabelRule{
+		{Label: "documentation", Paths: []string{"docs/**"}},
+		{Label: "tests", Paths: []string{"**/*_test.go"}, Color: "C5DEF5"},
+		{Label: "ci", Paths: []string{".github/**"}},
+		{Label: "frontend", Paths: []string{"web/**"}, Repos: []string{"other/*"}},
+	}}
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Labels: []*github.Label{{Name: github.String("ci")}, {Name: github.String("frontend")}, {Name: github.String("bug")}},
+	}
+
+	change := bot.autolabel(context.Background(), "o", "r", pr)
+	want := LabelChange{Added: []string{"documentation", "tests"}, Removed: []string{"ci"}}
+	if !reflect.DeepEqual(change, want) {
+		t.Errorf("Expected %+v, got %+v", want, change)
+	}
+	if !reflect.DeepEqual(added, want.Added) || !reflect.DeepEqual(removed, want.Removed) {
+		t.Errorf("Expected API calls to match the change, added %v removed %v", added, removed)
+	}
+	if len(created) != 1 || created[0].GetName() != "tests" || created[0].GetColor() != "c5def5" {
+		t.Errorf("Expected only the tests label to be created, got %v", created)
+	}
+
+	// A second run with the labels in place changes nothing
+	added, removed = nil, nil
+	pr.Labels = []*github.Label{{Name: github.String("documentation")}, {Name: github.String("tests")}}
+	if change := bot.autolabel(context.Background(), "o", "r", pr); len(change.Added)+len(change.Removed) != 0 || len(added)+len(removed) != 0 {
+		t.Errorf("Expected no changes, got %+v (added %v removed %v)", change, added, removed)
+	}
+
+	eval := bot.recordEvaluation(context.Background(), "o", "r", pr, nil, want, MergeVerdict{CanMerge: true, Reason: "ok"}).Current
+	if !reflect.DeepEqual(eval.LabelsAdded, want.Added) || !reflect.DeepEqual(eval.LabelsRemoved, want.Removed) {
+		t.Errorf("Expected the evaluation to record the label change, got %+v", eval)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Merge methods.
+const (
+	MergeMerge  = "merge"
+	MergeSquash = "squash"
+	MergeRebase = "rebase"
+)
+
+// AutoMergeSettings configures opt-in auto-merge. A PR opts in when a user
+// with write access adds Label, directly or by commenting "/automerge"
+// ("/automerge cancel" opts out). Opted-in PRs are merged with
+// Method as soon as the merge policy is satisfied and no check fails; with
+// DeleteBranch the head branch is deleted afterwards (never for forks). The
+// label alone doesn't opt a PR in: who added it is only known from the
+// labeled event, so that is where the opt-in is recorded.
+type AutoMergeSettings struct {
+	Enabled      bool   `json:"enabled"`
+	Label        string `json:"label"`
+	Method       string `json:"method"`
+	DeleteBranch bool   `json:"delete_branch"`
+}
+
+func (s AutoMergeSettings) validate() error {
+	switch s.Method {
+	case "", MergeMerge, MergeSquash, MergeRebase:
+		return nil
+	}
+	return fmt.Errorf("unknown method %q", s.Method)
+}
+
+func (s AutoMergeSettings) label() string {
+	if s.Label != "" {
+		return s.Label
+	}
+	return "automerge"
+}
+
+func (s AutoMergeSettings) method() string {
+	if s.Method != "" {
+		return s.Method
+	}
+	return MergeMerge
+}
+
+const autoMergeStoreName = "automerge"
+
+// AutoMergeOptIn records who opted a PR in to auto-merge.
+type AutoMergeOptIn struct {
+	Login string    `json:"login"`
+	At    time.Time `json:"at"`
+}
+
+// AutoMergeOptIns remembers the PRs a user with write access opted in to
+// auto-merge, keyed by "owner/repo#number", across restarts.
+type AutoMergeOptIns struct {
+	mu     sync.Mutex
+	store  *Store
+	optIns map[string]AutoMergeOptIn
+}
+
+func NewAutoMergeOptIns(store *Store) *AutoMergeOptIns {
+	o := &AutoMergeOptIns{store: store, optIns: make(map[string]AutoMergeOptIn)}
+	if err := store.Load(autoMergeStoreName, &o.optIns); err != nil {
+		log.Printf("Failed to load auto-merge opt-ins: %v", err)
+	}
+	return o
+}
+
+func optInKey(repository string, prNumber int) string {
+	return fmt.Sprintf("%s#%d", repository, prNumber)
+}
+
+func (o *AutoMergeOptIns) Get(repository string, prNumber int) (AutoMergeOptIn, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	optIn, ok := o.optIns[optInKey(repository, prNumber)]
+	return optIn, ok
+}
+
+func (o *AutoMergeOptIns) Record(repository string, prNumber int, login string, at time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.optIns[optInKey(repository, prNumber)] = AutoMergeOptIn{Login: login, At: at}
+	o.saveLocked()
+}
+
+func (o *AutoMergeOptIns) Forget(repository string, prNumber int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := optInKey(repository, prNumber)
+	if _, ok := o.optIns[key]; ok {
+		delete(o.optIns, key)
+		o.saveLocked()
+	}
+}
+
+func (o *AutoMergeOptIns) saveLocked() {
+	if err := o.store.Save(autoMergeStoreName, o.optIns); err != nil {
+		log.Printf("Failed to persist auto-merge opt-ins: %v", err)
+	}
+}
+
+func hasLabel(labels []*github.Label, name string) bool {
+	for _, l := range labels {
+		if l.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// maybeAutoMerge merges pr when it has opted in and eval says it's ready,
+// or with the merge queue enabled, queues it to be merged in turn. A label
+// whose labeled event hasn't been handled yet doesn't count.
+func (rb *ReviewBot) maybeAutoMerge(ctx context.Context, owner, repo string, pr *github.PullRequest, eval Evaluation) {
+	settings := rb.config.Settings.AutoMerge
+	if !settings.Enabled || !hasLabel(pr.Labels, settings.label()) {
+		return
+	}
+	if _, ok := rb.autoMergeOptIns.Get(owner+"/"+repo, pr.GetNumber()); !ok {
+		return
+	}
+	if !eval.CanMerge || len(eval.failingChecks()) > 0 {
+		return
+	}
+	if rb.config.Settings.MergeQueue.Enabled {
+		if eval.HeadSHA == pr.GetHead().GetSHA() && pr.GetState() == "open" && !pr.GetDraft() {
+			rb.enqueue(ctx, owner, repo, pr)
+		}
+		return
+	}
+	if err := rb.autoMerge(ctx, owner, repo, pr.GetNumber(), eval.HeadSHA); err != nil {
+		log.Printf("Auto-merge of %s/%s#%d failed: %v", owner, repo, pr.GetNumber(), err)
+	}
+}
+
+// autoMerge merges the PR if its head is still sha. Failures GitHub reports
+// (conflicts, branch protection) are explained in a PR comment.
+func (rb *ReviewBot) autoMerge(ctx context.Context, owner, repo string, prNumber int, sha string) (err error) {
+	settings := rb.config.Settings.AutoMerge
+	ctx, span := tracer().Start(ctx, "autoMerge", trace.WithAttributes(
+		append(prAttributes(owner, repo, prNumber), attribute.String("merge.method", settings.method()))...,
+	))
+	defer func() {
+		if err != nil {
+			recordSpanError(span, err)
+		}
+		span.End()
+	}()
+
+	pr, _, err := rb.client.PullRequests.Get(ctx, owner, repo, prNumber)
+	if err != nil {
+		return err
+	}
+	if pr.GetState() != "open" || pr.GetMerged() {
+		return nil
+	}
+	if pr.GetHead().GetSHA() != sha {
+		// A newer push will be evaluated on its own
+		log.Printf("Not auto-merging %s/%s#%d: head moved from %s to %s", owner, repo, prNumber, shortSHA(sha), shortSHA(pr.GetHead().GetSHA()))
+		return nil
+	}
+	if pr.GetDraft() {
+		return nil
+	}
+
+	// Passing the SHA makes GitHub refuse if the head moves in between
+	opts := &github.PullRequestOptions{MergeMethod: settings.method(), SHA: sha}
+	result, _, err := rb.client.PullRequests.Merge(ctx, owner, repo, prNumber, "", opts)
+	if err != nil {
+		reason := mergeFailureReason(pr, err)
+		body := fmt.Sprintf("⚠️ Auto-merge failed: %s", reason)
+		if _, _, cerr := rb.client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{Body: github.String(body)}); cerr != nil {
+			log.Printf("Failed to comment on %s/%s#%d: %v", owner, repo, prNumber, cerr)
+		}
+		return fmt.Errorf("%s: %w", reason, err)
+	}
+	log.Printf("Auto-merged %s/%s#%d (%s): %s", owner, repo, prNumber, settings.method(), result.GetSHA())
+
+	if settings.DeleteBranch && pr.GetHead().GetRepo().GetFullName() == pr.GetBase().GetRepo().GetFullName() {
+		if _, err := rb.client.Git.DeleteRef(ctx, owner, repo, "heads/"+pr.GetHead().GetRef()); err != nil && !isNotFound(err) {
+			log.Printf("Failed to delete branch %s after merging %s/%s#%d: %v", pr.GetHead().GetRef(), owner, repo, prNumber, err)
+		}
+	}
+	return nil
+}
+
+// mergeFailureReason explains a failed merge in terms a PR author can act
+// on.
+func mergeFailureReason(pr *github.PullRequest, err error) string {
+	var ghErr *github.ErrorResponse
+	status := 0
+	message := err.Error()
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		status = ghErr.Response.StatusCode
+		message = ghErr.Message
+	}
+
+	switch {
+	case pr.GetMergeableState() == "dirty" || pr.Mergeable != nil && !pr.GetMergeable():
+		return fmt.Sprintf("the branch has merge conflicts with `%s`; rebase or merge the base branch and push again.", pr.GetBase().GetRef())
+	case status == http.StatusConflict:
+		return "the head branch changed while merging; the new commits will be evaluated first."
+	case pr.GetMergeableState() == "blocked" || status == http.StatusMethodNotAllowed:
+		return fmt.Sprintf("branch protection on `%s` does not allow merging yet (%s).", pr.GetBase().GetRef(), message)
+	case pr.GetMergeableState() == "behind":
+		return fmt.Sprintf("the branch is behind `%s` and branch protection requires it to be up to date.", pr.GetBase().GetRef())
+	}
+	return message
+}
+
+// handleAutoMergeLabeled reacts to login adding the auto-merge label by
+// opting the PR in and merging right away if the last evaluation allows it.
+// The label is taken off again if login lacks write access, since GitHub
+// lets triagers label PRs they may not merge. When login is the bot itself
+// the label came from "/automerge", which already recorded the opt-in.
+func (rb *ReviewBot) handleAutoMergeLabeled(ctx context.Context, owner, repo string, pr *github.PullRequest, login string) {
+	settings := rb.config.Settings.AutoMerge
+	self, err := rb.botLogin(ctx)
+	if err != nil {
+		log.Printf("Failed to handle %s label on %s/%s#%d: %v", settings.label(), owner, repo, pr.GetNumber(), err)
+		return
+	}
+	if !strings.EqualFold(login, self) {
+		allowed, err := rb.canWrite(ctx, owner, repo, login)
+		if err != nil {
+			log.Printf("Failed to check permissions of %s on %s/%s: %v", login, owner, repo, err)
+			return
+		}
+		if !allowed {
+			if _, err := rb.client.Issues.RemoveLabelForIssue(ctx, owner, repo, pr.GetNumber(), settings.label()); err != nil && !isNotFound(err) {
+				log.Printf("Failed to remove %s label from %s/%s#%d: %v", settings.label(), owner, repo, pr.GetNumber(), err)
+			}
+			body := fmt.Sprintf("@%s only users with write access can enable auto-merge; the `%s` label was removed.", login, settings.label())
+			if _, _, err := rb.client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), &github.IssueComment{Body: github.String(body)}); err != nil {
+				log.Printf("Failed to comment on %s/%s#%d: %v", owner, repo, pr.GetNumber(), err)
+			}
+			return
+		}
+		rb.autoMergeOptIns.Record(owner+"/"+repo, pr.GetNumber(), login, time.Now())
+	}
+
+	eval, ok := rb.evaluations.Get(owner+"/"+repo, pr.GetNumber())
+	if !ok || eval.HeadSHA != pr.GetHead().GetSHA() {
+		return
+	}
+	verdict := rb.checkMergePolicy(ctx, owner, repo, pr.GetNumber())
+	eval.CanMerge, eval.Reason, eval.Blockers = verdict.CanMerge, verdict.Reason, verdict.Blockers
+	rb.maybeAutoMerge(ctx, owner, repo, pr, eval)
+}
+
+// handleAutoMergeCommand opts a PR in to (or, with "cancel", out of)
+// auto-merge on behalf of login.
+func (rb *ReviewBot) handleAutoMergeCommand(ctx context.Context, owner, repo string, prNumber int, login string, args []string) {
+	settings := rb.config.Settings.AutoMerge
+	if !settings.Enabled {
+		return
+	}
+	reply := func(body string) {
+		if _, _, err := rb.client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{Body: github.String(body)}); err != nil {
+			log.Printf("Failed to comment on %s/%s#%d: %v", owner, repo, prNumber, err)
+		}
+	}
+
+	allowed, err := rb.canWrite(ctx, owner, repo, login)
+	if err != nil {
+		log.Printf("Failed to check permissions of %s on %s/%s: %v", login, owner, repo, err)
+		return
+	}
+	if !allowed {
+		reply(fmt.Sprintf("@%s only users with write access can use `/automerge`.", login))
+		return
+	}
+
+	if len(args) > 0 && args[0] == "cancel" {
+		if _, err := rb.client.Issues.RemoveLabelForIssue(ctx, owner, repo, prNumber, settings.label()); err != nil && !isNotFound(err) {
+			log.Printf("Failed to remove %s label from %s/%s#%d: %v", settings.label(), owner, repo, prNumber, err)
+			return
+		}
+		rb.autoMergeOptIns.Forget(owner+"/"+repo, prNumber)
+		if entry, _, _, ok := rb.mergeQueue.Get(owner+"/"+repo, prNumber); ok {
+			rb.mergeQueue.Remove(owner+"/"+repo, prNumber, QueueEjected, fmt.Sprintf("auto-merge was cancelled by @%s.", login))
+			rb.refreshQueuePositions(ctx, owner+"/"+repo, entry.Base, prNumber)
+		}
+		reply("Auto-merge cancelled.")
+		return
+	}
+
+	// The labeled event this causes merges the PR if it is already ready
+	rb.autoMergeOptIns.Record(owner+"/"+repo, prNumber, login, time.Now())
+	if _, _, err := rb.client.Issues.AddLabelsToIssue(ctx, owner, repo, prNumber, []string{settings.label()}); err != nil {
+		log.Printf("Failed to add %s label to %s/%s#%d: %v", settings.label(), owner, repo, prNumber, err)
+		return
+	}
+	reply(fmt.Sprintf("Auto-merge enabled: this PR will be merged (%s) once all checks pass and the merge policy is satisfied.", settings.method()))
+}
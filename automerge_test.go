@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestParseSlashCommands(t *testing.T) {
+	body := "LGTM\n/automerge\n```\n/automerge cancel\n```\n  /Retest  unit  \n/ \n"
+	want := []SlashCommand{{Name: "automerge", Args: []string{}}, {Name: "retest", Args: []string{"unit"}}}
+	if got := parseSlashCommands(body); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+type autoMergeServer struct {
+	pr       *github.PullRequest
+	merges   []github.PullRequestOptions
+	comments []string
+	deleted  []string
+	removed  []string
+	mergeErr int
+}
+
+func (s *autoMergeServer) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/collaborators/", func(w http.ResponseWriter, r *http.Request) {
+		permission := "read"
+		if strings.Contains(r.URL.Path, "/maintainer/") {
+			permission = "write"
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryPermissionLevel{Permission: github.String(permission)})
+	})
+	mux.HandleFunc("/repos/o/r/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+		s.pr.Labels = append(s.pr.Labels, &github.Label{Name: github.String("automerge")})
+		json.NewEncoder(w).Encode(s.pr.Labels)
+	})
+	mux.HandleFunc("/repos/o/r/issues/7/labels/", func(w http.ResponseWriter, r *http.Request) {
+		s.removed = append(s.removed, strings.TrimPrefix(r.URL.Path, "/repos/o/r/issues/7/labels/"))
+		s.pr.Labels = nil
+		json.NewEncoder(w).Encode([]*github.Label{})
+	})
+	mux.HandleFunc("/repos/o/r/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		var comment github.IssueComment
+		json.NewDecoder(r.Body).Decode(&comment)
+		s.comments = append(s.comments, comment.GetBody())
+		json.NewEncoder(w).Encode(&comment)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/7", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(s.pr)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/7/reviews", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestReview{review("alice", "APPROVED"), review("bob", "APPROVED")})
+	})
+	mux.HandleFunc("/repos/o/r/pulls/7/merge", func(w http.ResponseWriter, r *http.Request) {
+		var opts struct {
+			MergeMethod string `json:"merge_method"`
+			SHA         string `json:"sha"`
+		}
+		json.NewDecoder(r.Body).Decode(&opts)
+		s.merges = append(s.merges, github.PullRequestOptions{MergeMethod: opts.MergeMethod, SHA: opts.SHA})
+		if s.mergeErr != 0 {
+			w.WriteHeader(s.mergeErr)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Required status check \"e2e\" is expected."})
+			return
+		}
+		json.NewEncoder(w).Encode(&github.PullRequestMergeResult{Merged: github.Bool(true), SHA: github.String("merged")})
+	})
+	mux.HandleFunc("/repos/o/r/git/refs/heads/", func(w http.ResponseWriter, r *http.Request) {
+		s.deleted = append(s.deleted, strings.TrimPrefix(r.URL.Path, "/repos/o/r/git/refs/heads/"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func TestAutoMergeCommand(t *testing.T) {
+	repo := &github.Repository{FullName: github.String("o/r")}
+	server := &autoMergeServer{pr: &github.PullRequest{
+		Number: github.Int(7),
+		State:  github.String("open"),
+		Head:   &github.PullRequestBranch{SHA: github.String("abc123"), Ref: github.String("feature"), Repo: repo},
+		Base:   &github.PullRequestBranch{Ref: github.String("main"), Repo: repo},
+	}}
+	bot := newTestBot(t, server.mux())
+	bot.evaluations = NewEvaluationStore(NewStore(t.TempDir()))
+	bot.autoMergeOptIns = NewAutoMergeOptIns(NewStore(t.TempDir()))
+	bot.config.Settings.AutoMerge = AutoMergeSettings{Enabled: true, Method: MergeSquash, DeleteBranch: true}
+	bot.evaluations.Record(Evaluation{Repository: "o/r", PRNumber: 7, HeadSHA: "abc123", Checks: []CheckResult{{Name: "test", Status: "success"}}})
+
+	comment := func(login, body string) {
+		bot.handleIssueCommentEvent(context.Background(), &github.IssueCommentEvent{
+			Action:  github.String("created"),
+			Issue:   &github.Issue{Number: github.Int(7), PullRequestLinks: &github.PullRequestLinks{}},
+			Comment: &github.IssueComment{Body: github.String(body), User: &github.User{Login: github.String(login)}},
+			Repo:    &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+		}, time.Now())
+	}
+
+	comment("drive-by", "/automerge")
+	if len(server.merges) != 0 || len(server.comments) != 1 || !strings.Contains(server.comments[0], "only users with write access") {
+		t.Fatalf("Expected a refusal for a read-only user, got merges %v comments %v", server.merges, server.comments)
+	}
+
+	labeled := func(login string) {
+		bot.handlePullRequestEvent(context.Background(), &github.PullRequestEvent{
+			Action:      github.String("labeled"),
+			Label:       &github.Label{Name: github.String("automerge")},
+			PullRequest: server.pr,
+			Sender:      &github.User{Login: github.String(login)},
+			Repo:        &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+		}, time.Now())
+	}
+
+	// Labelling needs write access too
+	server.pr.Labels = []*github.Label{{Name: github.String("automerge")}}
+	labeled("drive-by")
+	if len(server.merges) != 0 || !reflect.DeepEqual(server.removed, []string{"automerge"}) || len(server.comments) != 2 {
+		t.Fatalf("Expected the label to be removed without merging, got merges %v removed %v comments %v", server.merges, server.removed, server.comments)
+	}
+
+	// The command only adds the label; its labeled event, sent by the bot
+	// itself, does the merge
+	comment("maintainer", "Looks good\n/automerge")
+	if len(server.merges) != 0 || !hasLabel(server.pr.Labels, "automerge") {
+		t.Fatalf("Expected the label to be added without merging, got merges %v labels %v", server.merges, server.pr.Labels)
+	}
+	if optIn, ok := bot.autoMergeOptIns.Get("o/r", 7); !ok || optIn.Login != "maintainer" {
+		t.Errorf("Expected the opt-in to be recorded for maintainer, got %+v", optIn)
+	}
+	labeled("review-bot")
+	want := []github.PullRequestOptions{{MergeMethod: MergeSquash, SHA: "abc123"}}
+	if !reflect.DeepEqual(server.merges, want) {
+		t.Errorf("Expected a squash merge pinned to the head SHA, got %+v", server.merges)
+	}
+	if !reflect.DeepEqual(server.deleted, []string{"feature"}) {
+		t.Errorf("Expected the head branch to be deleted, got %v", server.deleted)
+	}
+}
+
+func TestAutoMergeFailures(t *testing.T) {
+	repo := &github.Repository{FullName: github.String("o/r")}
+	server := &autoMergeServer{pr: &github.PullRequest{
+		Number:         github.Int(7),
+		State:          github.String("open"),
+		MergeableState: github.String("blocked"),
+		Labels:         []*github.Label{{Name: github.String("automerge")}},
+		Head:           &github.PullRequestBranch{SHA: github.String("abc123"), Ref: github.String("feature"), Repo: repo},
+		Base:           &github.PullRequestBranch{Ref: github.String("main"), Repo: repo},
+	}}
+	bot := newTestBot(t, server.mux())
+	bot.autoMergeOptIns = NewAutoMergeOptIns(NewStore(t.TempDir()))
+	bot.config.Settings.AutoMerge = AutoMergeSettings{Enabled: true}
+	eval := Evaluation{HeadSHA: "abc123", CanMerge: true, Checks: []CheckResult{{Name: "test", Status: "success"}}}
+
+	// The label is there but its labeled event hasn't been handled, so
+	// nobody with write access has opted in yet
+	bot.maybeAutoMerge(context.Background(), "o", "r", server.pr, eval)
+	if len(server.merges) != 0 {
+		t.Fatalf("Expected no merge without a recorded opt-in")
+	}
+	bot.autoMergeOptIns.Record("o/r", 7, "maintainer", time.Now())
+
+	// Not ready: a failing check
+	failing := eval
+	failing.Checks = []CheckResult{{Name: "test", Status: "failure"}}
+	bot.maybeAutoMerge(context.Background(), "o", "r", server.pr, failing)
+	if len(server.merges) != 0 {
+		t.Fatalf("Expected no merge while a check fails")
+	}
+
+	// The head moved since the evaluation
+	server.pr.Head.SHA = github.String("def456")
+	bot.maybeAutoMerge(context.Background(), "o", "r", server.pr, eval)
+	if len(server.merges) != 0 {
+		t.Fatalf("Expected no merge after the head moved")
+	}
+
+	// Branch protection refuses
+	server.pr.Head.SHA = github.String("abc123")
+	server.mergeErr = http.StatusMethodNotAllowed
+	bot.maybeAutoMerge(context.Background(), "o", "r", server.pr, eval)
+	if len(server.merges) != 1 || server.merges[0].MergeMethod != MergeMerge {
+		t.Fatalf("Expected one merge attempt with the default method, got %+v", server.merges)
+	}
+	want := "⚠️ Auto-merge failed: branch protection on `main` does not allow merging yet (Required status check \"e2e\" is expected.)."
+	if len(server.comments) != 1 || server.comments[0] != want {
+		t.Errorf("Expected comment %q, got %v", want, server.comments)
+	}
+	if len(server.deleted) != 0 {
+		t.Errorf("Expected the branch to be kept, got %v", server.deleted)
+	}
+
+	server.pr.MergeableState = github.String("dirty")
+	if reason := mergeFailureReason(server.pr, &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusMethodNotAllowed}}); !strings.HasPrefix(reason, "the branch has merge conflicts with `main`") {
+		t.Errorf("Expected a conflict explanation, got %q", reason)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// BlockerSettings configures conditions that keep a PR from merging
+// regardless of approvals: any of Labels being present, a title marked
+// work in progress ("WIP", "[WIP]", "(WIP)") when WIP is set, and review
+// threads left unresolved when UnresolvedThreads is set.
+type BlockerSettings struct {
+	Labels            []string `json:"labels"`
+	WIP               bool     `json:"wip"`
+	UnresolvedThreads bool     `json:"unresolved_threads"`
+}
+
+var wipTitle = regexp.MustCompile(`(?i)^\s*(\[wip\]|\(wip\)|wip\b)`)
+
+// mergeBlockers lists what the configured blockers find wrong with pr,
+// one entry per condition.
+func (rb *ReviewBot) mergeBlockers(ctx context.Context, owner, repo string, pr *github.PullRequest) []string {
+	settings := rb.config.Settings.Blockers
+	var blockers []string
+	for _, label := range settings.Labels {
+		if hasLabel(pr.Labels, label) {
+			blockers = append(blockers, fmt.Sprintf("Blocked by the `%s` label", label))
+		}
+	}
+	if settings.WIP && wipTitle.MatchString(pr.GetTitle()) {
+		blockers = append(blockers, "Title marks the PR as work in progress")
+	}
+	if settings.UnresolvedThreads {
+		unresolved, err := rb.unresolvedThreads(ctx, owner, repo, pr.GetNumber())
+		switch {
+		case err != nil:
+			blockers = append(blockers, fmt.Sprintf("Failed to check review threads: %v", err))
+		case unresolved == 1:
+			blockers = append(blockers, "1 unresolved review thread")
+		case unresolved > 1:
+			blockers = append(blockers, fmt.Sprintf("%d unresolved review threads", unresolved))
+		}
+	}
+	return blockers
+}
+
+// handleReviewThreadEvent re-evaluates a PR when one of its review threads
+// is resolved or reopened.
+func (rb *ReviewBot) handleReviewThreadEvent(ctx context.Context, event *github.PullRequestReviewThreadEvent) {
+	if !rb.config.Settings.Blockers.UnresolvedThreads {
+		return
+	}
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	rb.reevaluate(ctx, owner, repo, event.GetPullRequest())
+}
+
+const reviewThreadsQuery = `query($owner: String!, $repo: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $cursor) {
+        nodes { isResolved }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+
+type reviewThreadsResponse struct {
+	Data struct {
+		Repository struct {
+			PullRequest struct {
+				ReviewThreads struct {
+					Nodes []struct {
+						IsResolved bool `json:"isResolved"`
+					} `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"reviewThreads"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// unresolvedThreads counts the PR's unresolved review threads. The REST
+// API doesn't expose resolution, so this asks the GraphQL API.
+func (rb *ReviewBot) unresolvedThreads(ctx context.Context, owner, repo string, prNumber int) (int, error) {
+	unresolved := 0
+	var cursor *string
+	for {
+		body := map[string]interface{}{
+			"query": reviewThreadsQuery,
+			"variables": map[string]interface{}{
+				"owner": owner, "repo": repo, "number": prNumber, "cursor": cursor,
+			},
+		}
+		req, err := rb.client.NewRequest("POST", rb.graphQLURL(), body)
+		if err != nil {
+			return 0, err
+		}
+		var resp reviewThreadsResponse
+		if _, err := rb.client.Do(ctx, req, &resp); err != nil {
+			return 0, err
+		}
+		if len(resp.Errors) > 0 {
+			return 0, fmt.Errorf("graphql: %s", resp.Errors[0].Message)
+		}
+
+		threads := resp.Data.Repository.PullRequest.ReviewThreads
+		for _, thread := range threads.Nodes {
+			if !thread.IsResolved {
+				unresolved++
+			}
+		}
+		if !threads.PageInfo.HasNextPage {
+			return unresolved, nil
+		}
+		cursor = github.String(threads.PageInfo.EndCursor)
+	}
+}
+
+// graphQLURL derives the GraphQL endpoint from the REST base URL:
+// api.github.com/graphql, or /api/graphql on GitHub Enterprise Server
+// whose REST API lives under /api/v3.
+func (rb *ReviewBot) graphQLURL() string {
+	u := *rb.client.BaseURL
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/v3") + "/graphql"
+	return u.String()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestWIPTitle(t *testing.T) {
+	for title, want := range map[string]bool{
+		"WIP: new parser":         true,
+		"[WIP] new parser":        true,
+		"(wip) new parser":        true,
+		"  wip new parser":        true,
+		"Wipe caches on shutdown": false,
+		"feat: WIP support":       false,
+	} {
+		if got := wipTitle.MatchString(title); got != want {
+			t.Errorf("%q: expected %v, got %v", title, want, got)
+		}
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	bot := newTestBot(t, http.NewServeMux())
+	for base, want := range map[string]string{
+		"https://api.github.com/":         "https://api.github.com/graphql",
+		"https://ghe.example.com/api/v3/": "https://ghe.example.com/api/graphql",
+	} {
+		bot.client.BaseURL, _ = url.Parse(base)
+		if got := bot.graphQLURL(); got != want {
+			t.Errorf("%s: expected %s, got %s", base, want, got)
+		}
+	}
+}
+
+func TestMergeBlockers(t *testing.T) {
+	var cursors []interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Number: github.Int(1),
+			Title:  github.String("[WIP] rework billing"),
+			Head:   &github.PullRequestBranch{SHA: github.String("abc")},
+			Base:   &github.PullRequestBranch{Ref: github.String("main")},
+			Labels: []*github.Label{{Name: github.String("needs-design")}, {Name: github.String("backend")}},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestReview{{State: github.String("APPROVED")}})
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Variables["number"] != float64(1) || !strings.Contains(req.Query, "reviewThreads") {
+			t.Errorf("Unexpected GraphQL request %+v", req)
+		}
+		cursors = append(cursors, req.Variables["cursor"])
+		if req.Variables["cursor"] == nil {
+			w.Write([]byte(`{"data":{"repository":{"pullRequest":{"reviewThreads":{
+				"nodes":[{"isResolved":true},{"isResolved":false}],
+				"pageInfo":{"hasNextPage":true,"endCursor":"c1"}}}}}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"repository":{"pullRequest":{"reviewThreads":{
+			"nodes":[{"isResolved":false}],
+			"pageInfo":{"hasNextPage":false,"endCursor":"c2"}}}}}}`))
+	})
+	bot := newTestBot(t, mux)
+	bot.config.MinReviewers = 2
+	bot.config.Settings.Blockers = BlockerSettings{Labels: []string{"do-not-merge", "needs-design"}, WIP: true, UnresolvedThreads: true}
+
+	verdict := bot.checkMergePolicy(context.Background(), "o", "r", 1)
+	want := []string{
+		"Need 2 approvals, have 1 (default policy)",
+		"Blocked by the `needs-design` label",
+		"Title marks the PR as work in progress",
+		"2 unresolved review threads",
+	}
+	if verdict.CanMerge || !reflect.DeepEqual(verdict.Blockers, want) || verdict.Reason != strings.Join(want, reasonSeparator) {
+		t.Errorf("Expected blockers %q, got %+v", want, verdict)
+	}
+	if len(cursors) != 2 || cursors[1] != "c1" {
+		t.Errorf("Expected two pages of review threads, got cursors %v", cursors)
+	}
+	if got := verdict.statusDescription(); got != "4 conditions block merge" {
+		t.Errorf("Expected a short status description, got %q", got)
+	}
+
+	comment := bot.generateCommentBody(nil, verdict)
+	if !strings.Contains(comment, "⏳ **Not ready to merge**:\n- "+strings.Join(want, "\n- ")+"\n") {
+		t.Errorf("Expected each blocker on its own line, got\n%s", comment)
+	}
+}
+
+func TestStatusDescription(t *testing.T) {
+	// A single blocker is kept whole in the comment even if it contains the
+	// separator, and cut to GitHub's limit in the status
+	reason := "merge freeze: " + strings.Repeat("release; hotfix only ", 10)
+	verdict := MergeVerdict{Reason: reason, Blockers: []string{reason}}
+	if got := verdict.statusDescription(); len([]rune(got)) != maxStatusDescription || !strings.HasSuffix(got, "…") {
+		t.Errorf("Expected the description to be cut to %d characters, got %q", maxStatusDescription, got)
+	}
+	comment := (&ReviewBot{}).generateCommentBody(nil, verdict)
+	if !strings.Contains(comment, "⏳ **Not ready to merge** - "+reason+"\n") {
+		t.Errorf("Expected the full reason in the comment, got\n%s", comment)
+	}
+}
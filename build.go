@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// isDockerfile matches Dockerfile, Dockerfile.prod, api.Dockerfile and the
+// like.
+func isDockerfile(filename string) bool {
+	base := path.Base(filename)
+	lower := strings.ToLower(base)
+	return base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(lower, ".dockerfile")
+}
+
+// dockerInstruction is one instruction of a Dockerfile with continuation
+// lines joined. Line is where it starts.
+type dockerInstruction struct {
+	Line int
+	Cmd  string
+	Args []string
+}
+
+func parseDockerfile(src []byte) []dockerInstruction {
+	var instructions []dockerInstruction
+	var current strings.Builder
+	start := 0
+	for i, line := range strings.Split(string(src), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		if current.Len() > 0 && strings.HasPrefix(trimmed, "#") {
+			continue // comments may appear between continuation lines
+		}
+		if current.Len() == 0 {
+			start = i + 1
+		}
+		if strings.HasSuffix(trimmed, `\`) {
+			current.WriteString(strings.TrimSuffix(trimmed, `\`) + " ")
+			continue
+		}
+		current.WriteString(trimmed)
+
+		fields := strings.Fields(current.String())
+		current.Reset()
+		if len(fields) > 0 {
+			instructions = append(instructions, dockerInstruction{Line: start, Cmd: strings.ToUpper(fields[0]), Args: fields[1:]})
+		}
+	}
+	return instructions
+}
+
+// withoutFlags drops leading --flag arguments such as --platform or --chown.
+func withoutFlags(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		args = args[1:]
+	}
+	return args
+}
+
+// lintDockerfile checks that base images are pinned, that ADD isn't used to
+// download files and that the final stage doesn't run as root. It returns
+// errors and warnings separately.
+func lintDockerfile(filename string, src []byte) (errs, warnings []LintFinding) {
+	finding := func(line int, msg string) LintFinding {
+		return LintFinding{File: filename, Line: line, Analyzer: "dockerfile", Message: msg}
+	}
+
+	stages := make(map[string]bool)
+	finalFrom, finalUserLine := 0, 0
+	finalUser := ""
+	for _, inst := range parseDockerfile(src) {
+		switch inst.Cmd {
+		case "FROM":
+			args := withoutFlags(inst.Args)
+			if len(args) == 0 {
+				errs = append(errs, finding(inst.Line, "FROM without an image"))
+				continue
+			}
+			image := args[0]
+			if len(args) >= 3 && strings.EqualFold(args[1], "AS") {
+				stages[strings.ToLower(args[2])] = true
+			}
+			finalFrom, finalUser, finalUserLine = inst.Line, "", 0
+
+			if image == "scratch" || stages[strings.ToLower(image)] || strings.Contains(image, "$") {
+				continue
+			}
+			if strings.Contains(image, "@sha256:") {
+				continue
+			}
+			tag := ""
+			if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+				tag = image[colon+1:]
+			}
+			if tag == "" || tag == "latest" {
+				errs = append(errs, finding(inst.Line, fmt.Sprintf("base image %s is not pinned; use a version tag and digest", image)))
+			} else {
+				warnings = append(warnings, finding(inst.Line, fmt.Sprintf("base image %s is not pinned to a digest", image)))
+			}
+		case "ADD":
+			args := withoutFlags(inst.Args)
+			for i := 0; i < len(args)-1; i++ {
+				if strings.HasPrefix(args[i], "http://") || strings.HasPrefix(args[i], "https://") {
+					errs = append(errs, finding(inst.Line, fmt.Sprintf("ADD downloads %s; fetch it with a verified checksum instead", args[i])))
+				}
+			}
+		case "USER":
+			if len(inst.Args) > 0 {
+				finalUser, finalUserLine = inst.Args[0], inst.Line
+			}
+		}
+	}
+
+	if finalFrom == 0 {
+		return errs, warnings
+	}
+	user, _, _ := strings.Cut(finalUser, ":")
+	switch {
+	case finalUserLine == 0:
+		errs = append(errs, finding(finalFrom, "final stage does not set USER, so the container runs as root"))
+	case user == "root" || user == "0":
+		errs = append(errs, finding(finalUserLine, "final stage runs as root"))
+	}
+	return errs, warnings
+}
+
+// lintGoModFile flags replace directives pointing at local paths, which only
+// build on the author's machine.
+func lintGoModFile(filename string, src []byte) []LintFinding {
+	mod, err := parseGoMod(src)
+	if err != nil {
+		return []LintFinding{{File: filename, Line: 1, Analyzer: "go.mod", Message: err.Error()}}
+	}
+	var errs []LintFinding
+	for _, r := range mod.Replaces {
+		if r.isLocal() {
+			errs = append(errs, LintFinding{File: filename, Line: r.Line, Analyzer: "go.mod",
+				Message: fmt.Sprintf("replace %s => %s points to a local path", r.Old, r.New)})
+		}
+	}
+	return errs
+}
+
+var compilerMessage = regexp.MustCompile(`^(.+?\.go):(\d+)(?::\d+)?: (.*)$`)
+
+// compilerFindings turns go build/vet output into findings with paths
+// relative to the repository root. Lines that don't name a position are
+// kept without one.
+func compilerFindings(module, analyzer string, output []byte) []LintFinding {
+	var findings []LintFinding
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := compilerMessage.FindStringSubmatch(line); m != nil {
+			lineNo, _ := strconv.Atoi(m[2])
+			findings = append(findings, LintFinding{File: path.Join(module, strings.TrimPrefix(m[1], "./")), Line: lineNo, Analyzer: analyzer, Message: m[3]})
+			continue
+		}
+		findings = append(findings, LintFinding{Analyzer: analyzer, Message: line})
+	}
+	return findings
+}
+
+// compileAffected builds and vets the packages touched by the PR and checks
+// that changed go.mod files are tidy. It returns the findings and the number
+// of modules compiled.
+func (rb *ReviewBot) compileAffected(ctx context.Context, ws *Workspace, files []*github.CommitFile) ([]LintFinding, int, error) {
+	settings := rb.config.Settings.Executor
+	modules := affectedPackages(ws.Dir, files)
+	moduleDirs := sortedModules(modules)
+
+	var findings []LintFinding
+	for _, module := range moduleDirs {
+		dir := filepath.Join(ws.Dir, filepath.FromSlash(module))
+
+		for _, step := range []struct{ analyzer, verb string }{{"go build", "build"}, {"go vet", "vet"}} {
+			out, err := runSandboxed(ctx, ws, settings, dir, "go", append([]string{step.verb}, modules[module]...)...)
+			if err != nil {
+				return nil, 0, err
+			}
+			if out.TimedOut {
+				return nil, 0, fmt.Errorf("%s timed out after %s", step.analyzer, settings.timeout())
+			}
+			if out.ExitCode != 0 {
+				findings = append(findings, compilerFindings(module, step.analyzer, out.Stderr)...)
+				break // vet repeats build errors
+			}
+		}
+	}
+
+	// Tidiness last: go mod tidy rewrites the files it checks.
+	for _, file := range files {
+		if path.Base(file.GetFilename()) != "go.mod" || file.GetStatus() == "removed" || isVendored(file.GetFilename()) {
+			continue
+		}
+		module := path.Dir(file.GetFilename())
+		tidy, err := rb.goModTidy(ctx, ws, module)
+		if err != nil {
+			return nil, 0, err
+		}
+		findings = append(findings, tidy...)
+	}
+	return findings, len(moduleDirs), nil
+}
+
+func (rb *ReviewBot) goModTidy(ctx context.Context, ws *Workspace, module string) ([]LintFinding, error) {
+	settings := rb.config.Settings.Executor
+	dir := filepath.Join(ws.Dir, filepath.FromSlash(module))
+	modFile := path.Join(module, "go.mod")
+
+	before := make(map[string][]byte)
+	for _, name := range []string{"go.mod", "go.sum"} {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		before[name] = data
+	}
+
+	out, err := runSandboxed(ctx, ws, settings, dir, "go", "mod", "tidy")
+	if err != nil {
+		return nil, err
+	}
+	if out.TimedOut {
+		return nil, fmt.Errorf("go mod tidy timed out after %s", settings.timeout())
+	}
+	if out.ExitCode != 0 {
+		return []LintFinding{{File: modFile, Line: 1, Analyzer: "go mod tidy",
+			Message: strings.Join(testFailureLines(strings.Split(string(out.Stderr), "\n")), " / ")}}, nil
+	}
+
+	var findings []LintFinding
+	for _, name := range []string{"go.mod", "go.sum"} {
+		after, _ := os.ReadFile(filepath.Join(dir, name))
+		if !bytes.Equal(before[name], after) {
+			findings = append(findings, LintFinding{File: path.Join(module, name), Line: 1, Analyzer: "go mod tidy",
+				Message: "not tidy; run `go mod tidy`"})
+		}
+	}
+	return findings, nil
+}
+
+// runBuildCheck validates changed Dockerfiles and go.mod files and, with the
+// executor enabled, compiles and vets the affected packages.
+func (rb *ReviewBot) runBuildCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return CheckResult{
+			Name:    "build",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get PR files: %v", err),
+		}
+	}
+
+	var errs, warnings []LintFinding
+	buildFiles, goChanges := 0, false
+	for _, file := range files {
+		name := file.GetFilename()
+		if file.GetStatus() == "removed" || isVendored(name) {
+			continue
+		}
+		if strings.HasSuffix(name, ".go") || path.Base(name) == "go.mod" || path.Base(name) == "go.sum" {
+			goChanges = true
+		}
+		if !isDockerfile(name) && path.Base(name) != "go.mod" {
+			continue
+		}
+
+		src, err := rb.fileContentAt(ctx, owner, repo, name, pr.GetHead().GetSHA())
+		if err != nil {
+			return CheckResult{
+				Name:    "build",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to get %s at %s: %v", name, shortSHA(pr.GetHead().GetSHA()), err),
+			}
+		}
+		buildFiles++
+		if isDockerfile(name) {
+			e, w := lintDockerfile(name, src)
+			errs = append(errs, e...)
+			warnings = append(warnings, w...)
+		} else {
+			errs = append(errs, lintGoModFile(name, src)...)
+		}
+	}
+
+	modules := 0
+	if goChanges && rb.config.Settings.Executor.Enabled {
+		ws, err := rb.checkoutWorkspace(ctx, owner, repo, pr.GetHead().GetSHA())
+		if err != nil {
+			return CheckResult{
+				Name:    "build",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to check out %s: %v", shortSHA(pr.GetHead().GetSHA()), err),
+			}
+		}
+		defer ws.Close()
+
+		compileErrs, n, err := rb.compileAffected(ctx, ws, files)
+		if err != nil {
+			return CheckResult{
+				Name:    "build",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to compile: %v", err),
+			}
+		}
+		errs = append(errs, compileErrs...)
+		modules = n
+	}
+
+	if buildFiles == 0 && modules == 0 {
+		return CheckResult{
+			Name:    "build",
+			Status:  "success",
+			Message: "No build configuration changes",
+		}
+	}
+
+	var summary []string
+	if modules > 0 {
+		summary = append(summary, fmt.Sprintf("%d modules compiled", modules))
+	}
+	if buildFiles > 0 {
+		summary = append(summary, fmt.Sprintf("%d build files checked", buildFiles))
+	}
+
+	details := lintDetails(append(errs, warnings...))
+	switch {
+	case len(errs) > 0:
+		return CheckResult{
+			Name:    "build",
+			Status:  "failure",
+			Message: fmt.Sprintf("Found %d build errors (%s)", len(errs), strings.Join(summary, ", ")),
+			Details: details,
+		}
+	case len(warnings) > 0:
+		return CheckResult{
+			Name:    "build",
+			Status:  "warning",
+			Message: fmt.Sprintf("Found %d build warnings (%s)", len(warnings), strings.Join(summary, ", ")),
+			Details: details,
+		}
+	}
+	return CheckResult{
+		Name:    "build",
+		Status:  "success",
+		Message: "Build check passed (" + strings.Join(summary, ", ") + ")",
+	}
+}
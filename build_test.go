@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestLintDockerfile(t *testing.T) {
+	src := `# syntax=docker/dockerfile:1
+FROM --platform=$BUILDPLATFORM golang:1.21-alpine AS builder
+RUN apk add --no-cache git \
+    # tools for the build
+    make
+ADD https://example.com/tool.tgz /tmp/
+FROM builder AS test
+FROM alpine
+COPY --from=builder /app /app
+USER root
+`
+	errs, warnings := lintDockerfile("Dockerfile", []byte(src))
+
+	var errLines []int
+	for _, e := range errs {
+		errLines = append(errLines, e.Line)
+	}
+	if want := []int{6, 8, 10}; !reflect.DeepEqual(errLines, want) {
+		t.Errorf("Expected errors on lines %v, got %v", want, errs)
+	}
+	if len(warnings) != 1 || warnings[0].Line != 2 {
+		t.Errorf("Expected a digest warning on line 2, got %v", warnings)
+	}
+
+	pinned := "FROM alpine:3.19@sha256:abc\nUSER 1001\n"
+	if errs, warnings := lintDockerfile("Dockerfile", []byte(pinned)); len(errs)+len(warnings) != 0 {
+		t.Errorf("Expected a pinned non-root image to pass, got %v %v", errs, warnings)
+	}
+
+	noUser := "FROM alpine:3.19@sha256:abc\nUSER app\nFROM gcr.io/distroless/static:nonroot@sha256:def\n"
+	if errs, _ := lintDockerfile("Dockerfile", []byte(noUser)); len(errs) != 1 || errs[0].Line != 3 {
+		t.Errorf("Expected the final stage's missing USER to be reported, got %v", errs)
+	}
+}
+
+func TestParseGoMod(t *testing.T) {
+	src := `module example.com/m
+
+go 1.21
+
+require (
+	github.com/a/b v1.2.3
+	github.com/c/d v0.1.0 // indirect
+)
+
+require "github.com/e/f" v2.0.0+incompatible
+
+replace github.com/a/b => ../b
+
+replace (
+	github.com/c/d v0.1.0 => github.com/fork/d v0.1.1
+)
+`
+	mod, err := parseGoMod([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mod.Module != "example.com/m" || mod.Go != "1.21" {
+		t.Errorf("Unexpected module %q / go %q", mod.Module, mod.Go)
+	}
+	wantRequires := []ModRequire{
+		{Path: "github.com/a/b", Version: "v1.2.3", Line: 6},
+		{Path: "github.com/c/d", Version: "v0.1.0", Indirect: true, Line: 7},
+		{Path: "github.com/e/f", Version: "v2.0.0+incompatible", Line: 10},
+	}
+	if !reflect.DeepEqual(mod.Requires, wantRequires) {
+		t.Errorf("Expected requires %+v, got %+v", wantRequires, mod.Requires)
+	}
+	if len(mod.Replaces) != 2 || !mod.Replaces[0].isLocal() || mod.Replaces[1].isLocal() {
+		t.Errorf("Unexpected replaces %+v", mod.Replaces)
+	}
+
+	findings := lintGoModFile("go.mod", []byte(src))
+	if len(findings) != 1 || findings[0].Line != 12 {
+		t.Errorf("Expected the local replace on line 12 to be flagged, got %v", findings)
+	}
+
+	if _, err := parseGoMod([]byte("module m\nrequire (\n")); err == nil {
+		t.Error("Expected an error for an unterminated block")
+	}
+}
+
+func TestRunBuildCheck(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	archive := tarball(t, map[string]string{
+		"o-r-abc123/go.mod":     "module example.com/m\n\ngo 1.21\n",
+		"o-r-abc123/ok/ok.go":   "package ok\n\nfunc OK() int { return 1 }\n",
+		"o-r-abc123/bad/bad.go": "package bad\n\nfunc Bad() int {\n\treturn undefined\n}\n",
+		"o-r-abc123/vet/vet.go": "package vet\n\nimport \"fmt\"\n\nfunc V() {\n\tfmt.Printf(\"%d\\n\", \"x\")\n}\n",
+		"o-r-abc123/Dockerfile": "FROM alpine:3.19@sha256:abc\nUSER app\n",
+	})
+
+	var server string
+	changed := []*github.CommitFile{
+		{Filename: github.String("ok/ok.go")},
+		{Filename: github.String("bad/bad.go")},
+		{Filename: github.String("Dockerfile")},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(changed)
+	})
+	mux.HandleFunc("/repos/o/r/contents/Dockerfile", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte("FROM alpine:3.19@sha256:abc\nUSER app\n"))),
+		})
+	})
+	mux.HandleFunc("/repos/o/r/tarball/abc123", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server+"codeload/o-r-abc123.tar.gz", http.StatusFound)
+	})
+	mux.HandleFunc("/codeload/o-r-abc123.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+
+	bot := newTestBot(t, mux)
+	server = bot.client.BaseURL.String()
+	bot.config.Settings.Executor = ExecutorSettings{Enabled: true, Timeout: "2m"}
+
+	pr := &github.PullRequest{Number: github.Int(1), Head: &github.PullRequestBranch{SHA: github.String("abc123")}}
+	result := bot.runSpecificCheck(context.Background(), "o", "r", pr, "build")
+
+	if result.Status != "failure" {
+		t.Fatalf("Expected failure, got %s: %s", result.Status, result.Message)
+	}
+	if len(result.Details) != 1 || !strings.HasPrefix(result.Details[0], "`bad/bad.go:4` [go build] undefined: undefined") {
+		t.Errorf("Expected a single compile error in bad/bad.go, got %v", result.Details)
+	}
+
+	changed = []*github.CommitFile{{Filename: github.String("ok/ok.go")}, {Filename: github.String("vet/vet.go")}}
+	result = bot.runSpecificCheck(context.Background(), "o", "r", pr, "build")
+	if result.Status != "failure" || len(result.Details) != 1 || !strings.HasPrefix(result.Details[0], "`vet/vet.go:6` [go vet]") {
+		t.Errorf("Expected a vet finding in vet/vet.go, got %s: %v", result.Status, result.Details)
+	}
+
+	changed = []*github.CommitFile{{Filename: github.String("ok/ok.go")}}
+	result = bot.runSpecificCheck(context.Background(), "o", "r", pr, "build")
+	if result.Status != "success" || result.Message != "Build check passed (1 modules compiled)" {
+		t.Errorf("Expected success, got %s: %s", result.Status, result.Message)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// SlashCommand is a "/name args..." line in a PR comment.
+type SlashCommand struct {
+	Name string
+	Args []string
+}
+
+// parseSlashCommands returns the commands in body, one per line starting
+// with "/". Lines inside fenced code blocks and quotes are ignored.
+func parseSlashCommands(body string) []SlashCommand {
+	var commands []SlashCommand
+	fenced := false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "```") {
+			fenced = !fenced
+			continue
+		}
+		if fenced || !strings.HasPrefix(line, "/") {
+			continue
+		}
+		fields := strings.Fields(line[1:])
+		if len(fields) == 0 {
+			continue
+		}
+		commands = append(commands, SlashCommand{Name: strings.ToLower(fields[0]), Args: fields[1:]})
+	}
+	return commands
+}
+
+// canWrite reports whether login may push to the repository, which is what
+// commands that change a PR's fate require.
+func (rb *ReviewBot) canWrite(ctx context.Context, owner, repo, login string) (bool, error) {
+	level, _, err := rb.client.Repositories.GetPermissionLevel(ctx, owner, repo, login)
+	if err != nil {
+		return false, err
+	}
+	switch level.GetPermission() {
+	case "admin", "maintain", "write":
+		return true, nil
+	}
+	return false, nil
+}
+
+func (rb *ReviewBot) handleIssueCommentEvent(ctx context.Context, event *github.IssueCommentEvent, startTime time.Time) {
+	if event.GetAction() != "created" || !event.GetIssue().IsPullRequest() {
+		return
+	}
+	if event.GetComment().GetUser().GetType() == "Bot" {
+		return
+	}
+	commands := parseSlashCommands(event.GetComment().GetBody())
+	if len(commands) == 0 {
+		return
+	}
+
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	prNumber := event.GetIssue().GetNumber()
+	login := event.GetComment().GetUser().GetLogin()
+	for _, command := range commands {
+		switch command.Name {
+		case "automerge":
+			rb.handleAutoMergeCommand(ctx, owner, repo, prNumber, login, command.Args)
+		default:
+			continue
+		}
+		log.Printf("Handled /%s from %s on %s/%s#%d in %v", command.Name, login, owner, repo, prNumber, time.Since(startTime))
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// ConventionalSettings configures the conventional check, which validates
+// the PR title (and with Commits, every commit message) against the
+// Conventional Commits grammar (https://www.conventionalcommits.org).
+// Empty Types allows the usual set; empty Scopes allows any scope.
+//
+// When a PR removes or changes an exported Go declaration in a file
+// matching APIPaths (path.Match globs; default every non-test Go file
+// outside cmd), the title must carry a "!" or the description a
+// BREAKING CHANGE footer. Internal packages and package main have no public
+// API.
+type ConventionalSettings struct {
+	Types        []string `json:"types"`
+	Scopes       []string `json:"scopes"`
+	RequireScope bool     `json:"require_scope"`
+	Commits      bool     `json:"commits"`
+	APIPaths     []string `json:"api_paths"`
+}
+
+var defaultConventionalTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+// typeSynonyms maps common non-conventional leading words to the type they
+// most likely meant, for suggestions.
+var typeSynonyms = map[string]string{
+	"add": "feat", "adds": "feat", "added": "feat", "feature": "feat", "features": "feat", "implement": "feat", "introduce": "feat",
+	"fixed": "fix", "fixes": "fix", "bugfix": "fix", "hotfix": "fix", "bug": "fix",
+	"doc": "docs", "document": "docs", "documentation": "docs", "readme": "docs",
+	"refactored": "refactor", "refactoring": "refactor", "cleanup": "refactor",
+	"tests": "test", "testing": "test",
+	"bump": "build", "deps": "build", "dependencies": "build",
+	"update": "chore", "updated": "chore", "chores": "chore",
+	"reverts": "revert", "reverted": "revert",
+	"performance": "perf", "optimize": "perf",
+}
+
+func (s ConventionalSettings) validate() error {
+	for _, t := range s.Types {
+		if !conventionalType.MatchString(t) {
+			return fmt.Errorf("bad type %q", t)
+		}
+	}
+	return validatePatterns(s.APIPaths)
+}
+
+func (s ConventionalSettings) types() []string {
+	if len(s.Types) > 0 {
+		return s.Types
+	}
+	return defaultConventionalTypes
+}
+
+var (
+	conventionalType   = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	conventionalHeader = regexp.MustCompile(`^(\w[\w-]*)(?:\(([^()]*)\))?(!)?:( ?)(.*)$`)
+	breakingFooter     = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: \S`)
+)
+
+// ConventionalHeader is a parsed commit header.
+type ConventionalHeader struct {
+	Type        string
+	Scope       string
+	Breaking    bool
+	Description string
+}
+
+// parseConventional checks header against the grammar and settings. It
+// returns the problems found and, where one can be guessed, a corrected
+// header.
+func parseConventional(settings ConventionalSettings, header string) (ConventionalHeader, []string, string) {
+	header = strings.TrimSpace(header)
+	m := conventionalHeader.FindStringSubmatch(header)
+	if m == nil {
+		word, rest, _ := strings.Cut(header, " ")
+		word = strings.TrimRight(word, ":")
+		suggestion := ""
+		if t := suggestType(settings, word); t != "" && rest != "" {
+			suggestion = t + ": " + lowerFirst(rest)
+		}
+		return ConventionalHeader{}, []string{`missing "type: description" prefix`}, suggestion
+	}
+
+	h := ConventionalHeader{Type: m[1], Scope: m[2], Breaking: m[3] == "!", Description: strings.TrimSpace(m[5])}
+	var problems []string
+	fixed := h
+	if !containsString(settings.types(), h.Type) {
+		if t := suggestType(settings, h.Type); t != "" {
+			fixed.Type = t
+			problems = append(problems, fmt.Sprintf("unknown type %q", h.Type))
+		} else {
+			problems = append(problems, fmt.Sprintf("unknown type %q (allowed: %s)", h.Type, strings.Join(settings.types(), ", ")))
+		}
+	}
+	switch {
+	case m[2] == "" && strings.Contains(header, "()"):
+		problems = append(problems, "empty scope")
+	case h.Scope == "" && settings.RequireScope:
+		problems = append(problems, "missing scope")
+	case h.Scope != "" && len(settings.Scopes) > 0 && !containsString(settings.Scopes, h.Scope):
+		problems = append(problems, fmt.Sprintf("unknown scope %q (allowed: %s)", h.Scope, strings.Join(settings.Scopes, ", ")))
+	}
+	if m[4] == "" && m[5] != "" {
+		problems = append(problems, `missing space after ":"`)
+	}
+	if h.Description == "" {
+		problems = append(problems, "empty description")
+	}
+	if len(problems) == 0 || fixed.Description == "" {
+		return h, problems, ""
+	}
+	return h, problems, fixed.String()
+}
+
+func (h ConventionalHeader) String() string {
+	s := h.Type
+	if h.Scope != "" {
+		s += "(" + h.Scope + ")"
+	}
+	if h.Breaking {
+		s += "!"
+	}
+	return s + ": " + h.Description
+}
+
+// suggestType guesses the allowed type word was meant to be.
+func suggestType(settings ConventionalSettings, word string) string {
+	word = strings.ToLower(word)
+	if containsString(settings.types(), word) {
+		return word
+	}
+	if t, ok := typeSynonyms[word]; ok && containsString(settings.types(), t) {
+		return t
+	}
+	return ""
+}
+
+func lowerFirst(s string) string {
+	if len(s) > 1 && s[0] >= 'A' && s[0] <= 'Z' && !(s[1] >= 'A' && s[1] <= 'Z') {
+		return string(s[0]+'a'-'A') + s[1:]
+	}
+	return s
+}
+
+// exportedDecl matches a diff line declaring an exported top-level Go
+// function, method, type, var or const.
+var exportedDecl = regexp.MustCompile(`^[-+](?:func (?:\([^)]*\) )?|type |var |const )([A-Z]\w*)`)
+
+// packageClause matches a patch line holding the package clause.
+var packageClause = regexp.MustCompile(`^[ +-]package (\w+)`)
+
+// apiFile reports whether filename can hold public API: a non-test Go file
+// outside internal packages and cmd, matching APIPaths if set.
+func apiFile(settings ConventionalSettings, filename string) bool {
+	if !strings.HasSuffix(filename, ".go") || strings.HasSuffix(filename, "_test.go") || isVendored(filename) {
+		return false
+	}
+	if strings.HasPrefix(filename, "internal/") || strings.Contains(filename, "/internal/") {
+		return false
+	}
+	if len(settings.APIPaths) > 0 {
+		return matchesAny(settings.APIPaths, filename)
+	}
+	return path.Dir(filename) != "cmd" && !strings.HasPrefix(filename, "cmd/")
+}
+
+// declHeader is the part of a declaration line that makes up the API: the
+// signature of a function, without the body, or the name and type of a var
+// or const, without the value.
+func declHeader(line string) string {
+	line, _, _ = strings.Cut(line[1:], "//")
+	if !strings.HasPrefix(line, "func ") {
+		line, _, _ = strings.Cut(line, "=")
+	}
+	return strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), "{")), " ")
+}
+
+// publicAPIChanges returns the exported declarations the patches remove or
+// whose signature they change, as "`Name` in `file`", and the Go files
+// they delete outright. A declaration re-added with the same signature
+// anywhere in its package, such as one moved to another file or with only
+// its body edited, is not a change.
+func publicAPIChanges(settings ConventionalSettings, files []*github.CommitFile) map[string][]string {
+	readded := make(map[string]bool)
+	for _, file := range files {
+		for _, line := range strings.Split(file.GetPatch(), "\n") {
+			if strings.HasPrefix(line, "+") && exportedDecl.MatchString(line) {
+				readded[path.Dir(file.GetFilename())+" "+declHeader(line)] = true
+			}
+		}
+	}
+
+	changes := make(map[string][]string)
+	for _, file := range files {
+		filename := file.GetFilename()
+		if !apiFile(settings, filename) {
+			continue
+		}
+		var changed []string
+		for _, line := range strings.Split(file.GetPatch(), "\n") {
+			m := exportedDecl.FindStringSubmatch(line)
+			if m == nil || !strings.HasPrefix(line, "-") || readded[path.Dir(filename)+" "+declHeader(line)] {
+				continue
+			}
+			changed = append(changed, fmt.Sprintf("`%s` in `%s`", m[1], filename))
+		}
+		if file.GetStatus() == "removed" && changed == nil {
+			changed = append(changed, fmt.Sprintf("`%s` removed", filename))
+		}
+		if changed != nil {
+			changes[filename] = changed
+		}
+	}
+	return changes
+}
+
+// goPackageName returns the package a changed Go file belongs to, from its
+// patch if that shows the package clause and otherwise from the file
+// itself, at the base commit if the PR deletes it.
+func (rb *ReviewBot) goPackageName(ctx context.Context, owner, repo string, pr *github.PullRequest, file *github.CommitFile) (string, error) {
+	for _, line := range strings.Split(file.GetPatch(), "\n") {
+		if m := packageClause.FindStringSubmatch(line); m != nil {
+			return m[1], nil
+		}
+	}
+	ref := pr.GetHead().GetSHA()
+	if file.GetStatus() == "removed" {
+		ref = pr.GetBase().GetSHA()
+	}
+	src, err := rb.fileContentAt(ctx, owner, repo, file.GetFilename(), ref)
+	if err != nil {
+		return "", err
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), file.GetFilename(), src, parser.PackageClauseOnly)
+	if err != nil {
+		return "", err
+	}
+	return f.Name.Name, nil
+}
+
+func (rb *ReviewBot) runConventionalCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	settings := rb.config.Settings.Conventional
+	var details []string
+
+	title, problems, suggestion := parseConventional(settings, pr.GetTitle())
+	if len(problems) > 0 {
+		details = append(details, conventionalDetail("PR title", pr.GetTitle(), problems, suggestion))
+	}
+
+	checked := 0
+	if settings.Commits {
+		commits, err := rb.listPRCommits(ctx, owner, repo, pr.GetNumber())
+		if err != nil {
+			return CheckResult{Name: "conventional", Status: "error", Message: fmt.Sprintf("Failed to list commits: %v", err)}
+		}
+		for _, c := range commits {
+			if len(c.Parents) > 1 {
+				continue
+			}
+			checked++
+			header, _, _ := strings.Cut(c.GetCommit().GetMessage(), "\n")
+			if _, problems, suggestion := parseConventional(settings, header); len(problems) > 0 {
+				details = append(details, conventionalDetail("commit "+shortSHA(c.GetSHA()), header, problems, suggestion))
+			}
+		}
+	}
+
+	if !title.Breaking && !breakingFooter.MatchString(pr.GetBody()) {
+		files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+		if err != nil {
+			return CheckResult{Name: "conventional", Status: "error", Message: fmt.Sprintf("Failed to list changed files: %v", err)}
+		}
+		changes := publicAPIChanges(settings, files)
+		var api []string
+		for _, file := range files {
+			changed, ok := changes[file.GetFilename()]
+			if !ok {
+				continue
+			}
+			// Commands have no importable API
+			pkg, err := rb.goPackageName(ctx, owner, repo, pr, file)
+			if err != nil {
+				log.Printf("Failed to read the package of %s in %s/%s#%d: %v", file.GetFilename(), owner, repo, pr.GetNumber(), err)
+			}
+			if pkg != "main" {
+				api = append(api, changed...)
+			}
+		}
+		if len(api) > 0 {
+			detail := fmt.Sprintf("public API changed (%s) but the title has no breaking-change marker", strings.Join(capDetails(api, 5), ", "))
+			if len(problems) == 0 {
+				title.Breaking = true
+				detail += fmt.Sprintf("; try `%s`", title)
+			} else {
+				detail += `; add "!" before the ":" or a BREAKING CHANGE footer to the description`
+			}
+			details = append(details, detail)
+		}
+	}
+
+	if len(details) > 0 {
+		return CheckResult{
+			Name:    "conventional",
+			Status:  "failure",
+			Message: fmt.Sprintf("%d Conventional Commits violations", len(details)),
+			Details: capDetails(details, maxCheckDetails),
+		}
+	}
+	message := "PR title follows Conventional Commits"
+	if settings.Commits {
+		message = fmt.Sprintf("PR title and %d commits follow Conventional Commits", checked)
+	}
+	return CheckResult{Name: "conventional", Status: "success", Message: message}
+}
+
+func conventionalDetail(what, header string, problems []string, suggestion string) string {
+	detail := fmt.Sprintf("%s `%s`: %s", what, header, strings.Join(problems, ", "))
+	if suggestion != "" {
+		detail += fmt.Sprintf("; try `%s`", suggestion)
+	}
+	return detail
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestParseConventional(t *testing.T) {
+	settings := ConventionalSettings{Scopes: []string{"api", "ui"}}
+	tests := []struct {
+		header     string
+		problems   []string
+		suggestion string
+	}{
+		{"feat(api): add paging", nil, ""},
+		{"fix!: drop legacy flag", nil, ""},
+		{"Fix crash on empty config", []string{`missing "type: description" prefix`}, "fix: crash on empty config"},
+		{"Added: OAuth login", []string{`unknown type "Added"`}, "feat: OAuth login"},
+		{"Something else entirely", []string{`missing "type: description" prefix`}, ""},
+		{"feature(ui): dark mode", []string{`unknown type "feature"`}, "feat(ui): dark mode"},
+		{"feat(db): migrate", []string{`unknown scope "db" (allowed: api, ui)`}, "feat(db): migrate"},
+		{"fix:typo", []string{`missing space after ":"`}, "fix: typo"},
+		{"docs: ", []string{"empty description"}, ""},
+	}
+	for _, tt := range tests {
+		_, problems, suggestion := parseConventional(settings, tt.header)
+		if !reflect.DeepEqual(problems, tt.problems) || suggestion != tt.suggestion {
+			t.Errorf("%q: expected %v %q, got %v %q", tt.header, tt.problems, tt.suggestion, problems, suggestion)
+		}
+	}
+
+	settings.RequireScope = true
+	if _, problems, _ := parseConventional(settings, "feat: add paging"); !reflect.DeepEqual(problems, []string{"missing scope"}) {
+		t.Errorf("Expected a missing scope, got %v", problems)
+	}
+}
+
+func TestPublicAPIChanges(t *testing.T) {
+	patch := "@@ -1,6 +1,6 @@\n package client\n-func (c *Client) Get(id string) error {\n+func (c *Client) Get(ctx context.Context, id string) error {\n-type Option int\n-func helper() {}\n+func NewThing() {}\n"
+	files := map[string][]string{
+		"client/client.go":        {"`Get` in `client/client.go`", "`Option` in `client/client.go`"},
+		"client/client_test.go":   nil,
+		"internal/store/store.go": nil,
+		"cmd/tool/main.go":        nil,
+	}
+	for filename, want := range files {
+		file := &github.CommitFile{Filename: github.String(filename), Patch: github.String(patch)}
+		if got := publicAPIChanges(ConventionalSettings{}, []*github.CommitFile{file})[filename]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", filename, want, got)
+		}
+	}
+
+	file := &github.CommitFile{Filename: github.String("client/client.go"), Patch: github.String(patch)}
+	if got := publicAPIChanges(ConventionalSettings{APIPaths: []string{"pkg/*/*.go"}}, []*github.CommitFile{file}); len(got) != 0 {
+		t.Errorf("Expected files outside api_paths to be ignored, got %v", got)
+	}
+	file.Filename = github.String("internal/store/store.go")
+	if got := publicAPIChanges(ConventionalSettings{APIPaths: []string{"internal/..."}}, []*github.CommitFile{file}); len(got) != 0 {
+		t.Errorf("Expected internal packages to be ignored, got %v", got)
+	}
+
+	// Moving a declaration within its package or editing its body or value
+	// leaves the API alone
+	moved := []*github.CommitFile{
+		{Filename: github.String("client/client.go"), Patch: github.String("@@ -10,7 +10,3 @@\n-func (c *Client) Close() error {\n-\treturn nil\n-}\n-var Timeout = time.Second\n+var Timeout = time.Minute\n-func Dial(addr string) {\n+func Dial(addr string) { // connects\n")},
+		{Filename: github.String("client/close.go"), Status: github.String("added"), Patch: github.String("@@ -0,0 +1,5 @@\n+package client\n+\n+func (c *Client) Close() error {\n+\treturn nil\n+}\n")},
+		{Filename: github.String("server/server.go"), Patch: github.String("@@ -1 +1 @@\n+func (c *Client) Close() error {\n")},
+	}
+	if got := publicAPIChanges(ConventionalSettings{}, moved); len(got) != 0 {
+		t.Errorf("Expected moved and edited declarations to be ignored, got %v", got)
+	}
+	moved[1].Filename = github.String("server/close.go")
+	want := map[string][]string{"client/client.go": {"`Close` in `client/client.go`"}}
+	if got := publicAPIChanges(ConventionalSettings{}, moved); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected a declaration moved to another package to count, got %v", got)
+	}
+}
+
+func TestRunConventionalCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/commits", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			json.NewEncoder(w).Encode([]*github.RepositoryCommit{
+				{SHA: github.String("3333333333"), Commit: &github.Commit{Message: github.String("wip")}},
+			})
+			return
+		}
+		w.Header().Set("Link", `<https://api.github.com/repos/o/r/pulls/1/commits?page=2>; rel="next"`)
+		json.NewEncoder(w).Encode([]*github.RepositoryCommit{
+			{SHA: github.String("1111111111"), Commit: &github.Commit{Message: github.String("feat: add client\n\nbody")}},
+			{SHA: github.String("2222222222"), Commit: &github.Commit{Message: github.String("Merge branch 'main'")}, Parents: []*github.Commit{{}, {}}},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{
+			{Filename: github.String("client.go"), Patch: github.String("@@ -1 +1 @@\n-func Dial(addr string) *Conn\n+func Dial(ctx context.Context, addr string) *Conn\n")},
+			{Filename: github.String("tool.go"), Patch: github.String("@@ -8 +8 @@\n-func Run(args []string) error {\n+func Run(ctx context.Context, args []string) error {\n")},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/contents/", func(w http.ResponseWriter, r *http.Request) {
+		src := "package client\n"
+		if strings.HasSuffix(r.URL.Path, "/tool.go") {
+			src = "package main\n"
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(src))),
+		})
+	})
+
+	bot := newTestBot(t, mux)
+	bot.config.Settings.Conventional = ConventionalSettings{Commits: true}
+	pr := &github.PullRequest{Number: github.Int(1), Title: github.String("feat(client): take a context")}
+
+	result := bot.runSpecificCheck(context.Background(), "o", "r", pr, "conventional")
+	if result.Status != "failure" || len(result.Details) != 2 {
+		t.Fatalf("Expected 2 violations, got %s: %v", result.Status, result.Details)
+	}
+	if !strings.HasPrefix(result.Details[0], "commit 3333333 `wip`: missing") {
+		t.Errorf("Unexpected commit detail %q", result.Details[0])
+	}
+	if want := "public API changed (`Dial` in `client.go`) but the title has no breaking-change marker; try `feat(client)!: take a context`"; result.Details[1] != want {
+		t.Errorf("Expected %q, got %q", want, result.Details[1])
+	}
+
+	bot.config.Settings.Conventional.Commits = false
+	pr.Body = github.String("Callers must pass a context.\n\nBREAKING CHANGE: Dial takes a context")
+	result = bot.runSpecificCheck(context.Background(), "o", "r", pr, "conventional")
+	if result.Status != "success" || result.Message != "PR title follows Conventional Commits" {
+		t.Errorf("Expected success with a breaking-change footer, got %s: %s %v", result.Status, result.Message, result.Details)
+	}
+}
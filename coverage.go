@@ -0,0 +1,426 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// CoverageSettings configures the coverage check. Profiles come from the
+// test executor (the default), which tests the packages the PR touches in
+// each module at base and head, or, with Source "artifact", from a GitHub
+// Actions artifact named Artifact containing the Go cover profile Profile.
+//
+// The check fails when total coverage drops by more than MaxDrop percentage
+// points or when fewer than MinChangedLines percent of the added lines that
+// contain statements are covered (0 disables that rule).
+type CoverageSettings struct {
+	Source          string  `json:"source"`
+	Artifact        string  `json:"artifact"`
+	Profile         string  `json:"profile"`
+	MaxDrop         float64 `json:"max_drop"`
+	MinChangedLines float64 `json:"min_changed_lines"`
+}
+
+const (
+	CoverageFromExecutor = "executor"
+	CoverageFromArtifact = "artifact"
+)
+
+func (s CoverageSettings) validate() error {
+	switch s.Source {
+	case "", CoverageFromExecutor, CoverageFromArtifact:
+	default:
+		return fmt.Errorf("unknown source %q", s.Source)
+	}
+	if s.MaxDrop < 0 || s.MinChangedLines < 0 || s.MinChangedLines > 100 {
+		return fmt.Errorf("thresholds must be percentages")
+	}
+	return nil
+}
+
+func (s CoverageSettings) artifactName() string {
+	if s.Artifact != "" {
+		return s.Artifact
+	}
+	return "coverage"
+}
+
+func (s CoverageSettings) profileName() string {
+	if s.Profile != "" {
+		return s.Profile
+	}
+	return "coverage.out"
+}
+
+// coverBlock is one line of a Go cover profile.
+type coverBlock struct {
+	StartLine, EndLine int
+	Statements         int
+	Count              int
+}
+
+// CoverageProfile is a parsed Go cover profile keyed by the file names it
+// records (import path plus file name).
+type CoverageProfile map[string][]coverBlock
+
+// parseCoverProfile reads the output of `go test -coverprofile`. Blocks
+// reported more than once, as happens with -coverpkg, are merged.
+func parseCoverProfile(r io.Reader) (CoverageProfile, error) {
+	type blockKey struct {
+		file string
+		pos  string
+	}
+	index := make(map[blockKey]int)
+	profile := make(CoverageProfile)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+
+		// file.go:12.34,15.2 3 1
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("line %d: malformed cover profile entry", lineNo)
+		}
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: malformed cover profile entry", lineNo)
+		}
+		file, pos := line[:colon], fields[0]
+		start, end, ok := strings.Cut(pos, ",")
+		if !ok {
+			return nil, fmt.Errorf("line %d: malformed position %q", lineNo, pos)
+		}
+		startLine, err1 := strconv.Atoi(strings.SplitN(start, ".", 2)[0])
+		endLine, err2 := strconv.Atoi(strings.SplitN(end, ".", 2)[0])
+		statements, err3 := strconv.Atoi(fields[1])
+		count, err4 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return nil, fmt.Errorf("line %d: malformed cover profile entry", lineNo)
+		}
+
+		key := blockKey{file, pos}
+		if i, ok := index[key]; ok {
+			profile[file][i].Count += count
+			continue
+		}
+		index[key] = len(profile[file])
+		profile[file] = append(profile[file], coverBlock{StartLine: startLine, EndLine: endLine, Statements: statements, Count: count})
+	}
+	return profile, scanner.Err()
+}
+
+// Total returns the percentage of statements covered.
+func (p CoverageProfile) Total() float64 {
+	var covered, total int
+	for file := range p {
+		c, t := p.statements(file)
+		covered += c
+		total += t
+	}
+	return percent(covered, total)
+}
+
+func (p CoverageProfile) statements(file string) (covered, total int) {
+	for _, block := range p[file] {
+		total += block.Statements
+		if block.Count > 0 {
+			covered += block.Statements
+		}
+	}
+	return covered, total
+}
+
+// file finds the profile entry for a repository-relative path. Profiles name
+// files by import path, so the match is on the path suffix.
+func (p CoverageProfile) file(repoPath string) (string, bool) {
+	if _, ok := p[repoPath]; ok {
+		return repoPath, true
+	}
+	best := ""
+	for name := range p {
+		if strings.HasSuffix(name, "/"+repoPath) && (best == "" || len(name) < len(best)) {
+			best = name
+		}
+	}
+	return best, best != ""
+}
+
+// FileCoverage returns the coverage of repoPath, and false if the profile
+// has no statements for it.
+func (p CoverageProfile) FileCoverage(repoPath string) (float64, bool) {
+	name, ok := p.file(repoPath)
+	if !ok {
+		return 0, false
+	}
+	covered, total := p.statements(name)
+	return percent(covered, total), total > 0
+}
+
+// LineCoverage counts how many of lines fall inside a statement block of
+// repoPath and how many of those were executed.
+func (p CoverageProfile) LineCoverage(repoPath string, lines map[int]bool) (covered, coverable int) {
+	name, ok := p.file(repoPath)
+	if !ok {
+		return 0, 0
+	}
+	for line := range lines {
+		inBlock, hit := false, false
+		for _, block := range p[name] {
+			if line >= block.StartLine && line <= block.EndLine && block.Statements > 0 {
+				inBlock = true
+				hit = hit || block.Count > 0
+			}
+		}
+		if inBlock {
+			coverable++
+			if hit {
+				covered++
+			}
+		}
+	}
+	return covered, coverable
+}
+
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
+
+// coverageProfile fetches or produces the cover profile for sha. The
+// executor only covers the packages files touch, which is empty when there
+// are none.
+func (rb *ReviewBot) coverageProfile(ctx context.Context, owner, repo, sha string, files []*github.CommitFile) (CoverageProfile, error) {
+	settings := rb.config.Settings.Coverage
+	if settings.Source == CoverageFromArtifact {
+		return rb.coverageFromArtifact(ctx, owner, repo, sha)
+	}
+
+	ws, err := rb.checkoutWorkspace(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Close()
+
+	profile := make(CoverageProfile)
+	modules := affectedPackages(ws.Dir, files)
+	for i, module := range sortedModules(modules) {
+		out := filepath.Join(ws.root, "tmp", fmt.Sprintf("coverage-%d.out", i))
+		dir := filepath.Join(ws.Dir, filepath.FromSlash(module))
+		// Failing tests still leave a profile behind; the test check reports them.
+		args := append([]string{"test", "-coverprofile=" + out}, modules[module]...)
+		result, err := runSandboxed(ctx, ws, rb.config.Settings.Executor, dir, "go", args...)
+		if err != nil {
+			return nil, err
+		}
+		if result.TimedOut {
+			return nil, fmt.Errorf("go test timed out after %s", rb.config.Settings.Executor.timeout())
+		}
+		f, err := os.Open(out)
+		if err != nil {
+			return nil, fmt.Errorf("go test produced no profile for `%s`: %s", module, strings.Join(testFailureLines(strings.Split(string(result.Stderr), "\n")), " / "))
+		}
+		moduleProfile, err := parseCoverProfile(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		// Profiles name files by import path, so modules don't collide
+		for file, blocks := range moduleProfile {
+			profile[file] = append(profile[file], blocks...)
+		}
+	}
+	return profile, nil
+}
+
+// coverageFromArtifact downloads the coverage artifact uploaded by a
+// workflow run for sha.
+func (rb *ReviewBot) coverageFromArtifact(ctx context.Context, owner, repo, sha string) (CoverageProfile, error) {
+	settings := rb.config.Settings.Coverage
+	runs, _, err := rb.client.Actions.ListRepositoryWorkflowRuns(ctx, owner, repo, &github.ListWorkflowRunsOptions{
+		HeadSHA:     sha,
+		ListOptions: github.ListOptions{PerPage: 100},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing workflow runs: %w", err)
+	}
+
+	for _, run := range runs.WorkflowRuns {
+		artifacts, _, err := rb.client.Actions.ListWorkflowRunArtifacts(ctx, owner, repo, run.GetID(), &github.ListOptions{PerPage: 100})
+		if err != nil {
+			return nil, fmt.Errorf("listing artifacts: %w", err)
+		}
+		for _, artifact := range artifacts.Artifacts {
+			if artifact.GetName() != settings.artifactName() || artifact.GetExpired() {
+				continue
+			}
+			data, err := rb.downloadArtifact(ctx, owner, repo, artifact.GetID())
+			if err != nil {
+				return nil, err
+			}
+			return profileFromZip(data, settings.profileName())
+		}
+	}
+	return nil, fmt.Errorf("no %q artifact found for %s", settings.artifactName(), shortSHA(sha))
+}
+
+func (rb *ReviewBot) downloadArtifact(ctx context.Context, owner, repo string, id int64) ([]byte, error) {
+	link, _, err := rb.client.Actions.DownloadArtifact(ctx, owner, repo, id, 1)
+	if err != nil {
+		return nil, fmt.Errorf("getting artifact link: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := rb.client.Client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading artifact: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading artifact: unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, rb.config.Settings.Executor.maxArchiveBytes()))
+}
+
+func profileFromZip(data []byte, name string) (CoverageProfile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("reading artifact: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return parseCoverProfile(rc)
+	}
+	return nil, fmt.Errorf("artifact has no %s", name)
+}
+
+// runCoverageCheck compares coverage between the PR's base and head.
+func (rb *ReviewBot) runCoverageCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	settings := rb.config.Settings.Coverage
+	if settings.Source != CoverageFromArtifact && !rb.config.Settings.Executor.Enabled {
+		return CheckResult{
+			Name:    "coverage",
+			Status:  "skipped",
+			Message: "Coverage needs the test executor or a coverage artifact",
+		}
+	}
+
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return CheckResult{
+			Name:    "coverage",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get PR files: %v", err),
+		}
+	}
+
+	base, err := rb.coverageProfile(ctx, owner, repo, pr.GetBase().GetSHA(), files)
+	if err != nil {
+		return CheckResult{
+			Name:    "coverage",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get base coverage: %v", err),
+		}
+	}
+	head, err := rb.coverageProfile(ctx, owner, repo, pr.GetHead().GetSHA(), files)
+	if err != nil {
+		return CheckResult{
+			Name:    "coverage",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get head coverage: %v", err),
+		}
+	}
+	if len(base) == 0 && len(head) == 0 {
+		return CheckResult{
+			Name:    "coverage",
+			Status:  "skipped",
+			Message: "No Go packages affected by this PR",
+		}
+	}
+
+	return coverageResult(settings, base, head, files)
+}
+
+func coverageResult(settings CoverageSettings, base, head CoverageProfile, files []*github.CommitFile) CheckResult {
+	baseTotal, headTotal := base.Total(), head.Total()
+	delta := headTotal - baseTotal
+
+	var details []string
+	changedCovered, changedCoverable := 0, 0
+	sort.Slice(files, func(i, j int) bool { return files[i].GetFilename() < files[j].GetFilename() })
+	for _, file := range files {
+		name := file.GetFilename()
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		before, hadBefore := base.FileCoverage(name)
+		after, hasAfter := head.FileCoverage(name)
+		switch {
+		case hadBefore && hasAfter:
+			details = append(details, fmt.Sprintf("`%s` %.1f%% → %.1f%% (%+.1f)", name, before, after, after-before))
+		case hasAfter:
+			details = append(details, fmt.Sprintf("`%s` %.1f%% (new)", name, after))
+		case hadBefore && file.GetStatus() == "removed":
+			details = append(details, fmt.Sprintf("`%s` removed (was %.1f%%)", name, before))
+		}
+
+		if added := addedLines(file.GetPatch()); added != nil {
+			covered, coverable := head.LineCoverage(name, added)
+			changedCovered += covered
+			changedCoverable += coverable
+		}
+	}
+
+	message := fmt.Sprintf("Coverage %.1f%% (%+.1f)", headTotal, delta)
+	changed := percent(changedCovered, changedCoverable)
+	if changedCoverable > 0 {
+		message += fmt.Sprintf(", %.1f%% of changed lines covered", changed)
+	}
+
+	var problems []string
+	if -delta > settings.MaxDrop {
+		problems = append(problems, fmt.Sprintf("coverage dropped by %.2f points (max %.2f)", -delta, settings.MaxDrop))
+	}
+	if settings.MinChangedLines > 0 && changedCoverable > 0 && changed < settings.MinChangedLines {
+		problems = append(problems, fmt.Sprintf("changed lines are %.1f%% covered (min %.1f%%)", changed, settings.MinChangedLines))
+	}
+
+	status := "success"
+	if len(problems) > 0 {
+		status = "failure"
+		message += ": " + strings.Join(problems, "; ")
+	}
+	return CheckResult{
+		Name:    "coverage",
+		Status:  status,
+		Message: message,
+		Details: capDetails(details, maxCheckDetails),
+	}
+}
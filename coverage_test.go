@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const baseProfile = `mode: set
+example.com/m/a/a.go:3.14,5.2 2 1
+example.com/m/a/a.go:7.14,9.2 2 0
+example.com/m/b/b.go:3.14,4.2 1 1
+`
+
+const headProfile = `mode: set
+example.com/m/a/a.go:3.14,5.2 2 1
+example.com/m/a/a.go:7.14,9.2 2 0
+example.com/m/a/a.go:11.14,14.2 3 0
+example.com/m/b/b.go:3.14,4.2 1 1
+example.com/m/b/b.go:3.14,4.2 1 0
+`
+
+func mustParseProfile(t *testing.T, profile string) CoverageProfile {
+	t.Helper()
+	p, err := parseCoverProfile(strings.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParseCoverProfile(t *testing.T) {
+	head := mustParseProfile(t, headProfile)
+	if got := len(head["example.com/m/b/b.go"]); got != 1 {
+		t.Errorf("Expected duplicate blocks to be merged, got %d blocks", got)
+	}
+	if got := head.Total(); fmt.Sprintf("%.1f", got) != "37.5" {
+		t.Errorf("Expected 37.5%% total coverage, got %.1f", got)
+	}
+	if got, ok := head.FileCoverage("a/a.go"); !ok || fmt.Sprintf("%.1f", got) != "28.6" {
+		t.Errorf("Expected a/a.go to be 28.6%% covered, got %.1f (%v)", got, ok)
+	}
+
+	covered, coverable := head.LineCoverage("a/a.go", map[int]bool{4: true, 10: true, 12: true})
+	if covered != 1 || coverable != 2 {
+		t.Errorf("Expected 1 of 2 coverable lines covered, got %d of %d", covered, coverable)
+	}
+
+	if _, err := parseCoverProfile(strings.NewReader("mode: set\nnonsense\n")); err == nil {
+		t.Error("Expected an error for a malformed profile")
+	}
+}
+
+func TestCoverageResult(t *testing.T) {
+	base := mustParseProfile(t, baseProfile)
+	head := mustParseProfile(t, headProfile)
+	files := []*github.CommitFile{
+		{Filename: github.String("a/a.go"), Patch: github.String("@@ -10,0 +11,4 @@\n+func g() {\n+\tx()\n+\ty()\n+}")},
+		{Filename: github.String("a/a_test.go")},
+	}
+
+	result := coverageResult(CoverageSettings{MaxDrop: 5}, base, head, files)
+	if result.Status != "failure" || !strings.Contains(result.Message, "coverage dropped by 22.50 points") {
+		t.Errorf("Expected a drop failure, got %s: %s", result.Status, result.Message)
+	}
+	if want := []string{"`a/a.go` 50.0% → 28.6% (-21.4)"}; !reflect.DeepEqual(result.Details, want) {
+		t.Errorf("Expected details %v, got %v", want, result.Details)
+	}
+
+	// The limit is exact; no rounding lets a slightly larger drop through
+	if result := coverageResult(CoverageSettings{MaxDrop: 22.49}, base, head, files); result.Status != "failure" {
+		t.Errorf("Expected a drop just over the limit to fail, got %s: %s", result.Status, result.Message)
+	}
+
+	result = coverageResult(CoverageSettings{MaxDrop: 25, MinChangedLines: 50}, base, head, files)
+	if result.Status != "failure" || !strings.Contains(result.Message, "changed lines are 0.0% covered") {
+		t.Errorf("Expected a changed-lines failure, got %s: %s", result.Status, result.Message)
+	}
+
+	result = coverageResult(CoverageSettings{MaxDrop: 25}, base, head, files)
+	if result.Status != "success" {
+		t.Errorf("Expected success within thresholds, got %s: %s", result.Status, result.Message)
+	}
+}
+
+func TestCoverageCheckFromArtifacts(t *testing.T) {
+	profiles := map[string]string{"base1": baseProfile, "head1": baseProfile}
+	var server string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{{Filename: github.String("b/b.go"), Patch: github.String("@@ -3 +3 @@\n-\told()\n+\tnew()")}})
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		sha := r.URL.Query().Get("head_sha")
+		json.NewEncoder(w).Encode(&github.WorkflowRuns{WorkflowRuns: []*github.WorkflowRun{{ID: github.Int64(int64(len(sha)))}, {ID: github.Int64(map[string]int64{"base1": 10, "head1": 20}[sha])}}})
+	})
+	mux.HandleFunc("/repos/o/r/actions/runs/", func(w http.ResponseWriter, r *http.Request) {
+		var artifacts []*github.Artifact
+		switch r.URL.Path {
+		case "/repos/o/r/actions/runs/10/artifacts":
+			artifacts = []*github.Artifact{{ID: github.Int64(100), Name: github.String("coverage")}}
+		case "/repos/o/r/actions/runs/20/artifacts":
+			artifacts = []*github.Artifact{{ID: github.Int64(200), Name: github.String("coverage")}}
+		}
+		json.NewEncoder(w).Encode(&github.ArtifactList{Artifacts: artifacts})
+	})
+	mux.HandleFunc("/repos/o/r/actions/artifacts/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server+"blob/"+strings.Split(r.URL.Path, "/")[6], http.StatusFound)
+	})
+	mux.HandleFunc("/blob/", func(w http.ResponseWriter, r *http.Request) {
+		sha := map[string]string{"/blob/100": "base1", "/blob/200": "head1"}[r.URL.Path]
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		f, _ := zw.Create("coverage.out")
+		f.Write([]byte(profiles[sha]))
+		zw.Close()
+		w.Write(buf.Bytes())
+	})
+
+	bot := newTestBot(t, mux)
+	server = bot.client.BaseURL.String()
+	bot.config.Settings.Coverage = CoverageSettings{Source: CoverageFromArtifact}
+
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Base:   &github.PullRequestBranch{SHA: github.String("base1")},
+		Head:   &github.PullRequestBranch{SHA: github.String("head1")},
+	}
+	result := bot.runSpecificCheck(context.Background(), "o", "r", pr, "coverage")
+	if result.Status != "success" || result.Message != "Coverage 60.0% (+0.0), 100.0% of changed lines covered" {
+		t.Errorf("Expected unchanged coverage, got %s: %s", result.Status, result.Message)
+	}
+}
+
+func TestCoverageCheckFromExecutor(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	tree := map[string]string{
+		"go.mod":            "module example.com/m\n\ngo 1.21\n",
+		"a/a.go":            "package a\n\nfunc A() int {\n\treturn 1\n}\n",
+		"a/a_test.go":       "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) { A() }\n",
+		"b/b.go":            "package b\n\nfunc B() int {\n\treturn 2\n}\n",
+		"tools/go.mod":      "module example.com/tools\n\ngo 1.21\n",
+		"tools/t.go":        "package tools\n\nfunc T() int {\n\treturn 3\n}\n",
+		"tools/t_test.go":   "package tools\n\nimport \"testing\"\n\nfunc TestT(t *testing.T) { T() }\n",
+		"tools/x/x.go":      "package x\n\nfunc X() int {\n\treturn 4\n}\n",
+		"tools/x/x_test.go": "package x\n",
+	}
+	archives := make(map[string][]byte)
+	for _, sha := range []string{"base1", "head1"} {
+		files := make(map[string]string)
+		for name, content := range tree {
+			files["o-r-"+sha+"/"+name] = content
+		}
+		archives[sha] = tarball(t, files)
+	}
+
+	var server string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{
+			{Filename: github.String("a/a.go"), Patch: github.String("@@ -4 +4 @@\n-\treturn 0\n+\treturn 1")},
+			{Filename: github.String("tools/t.go")},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/tarball/", func(w http.ResponseWriter, r *http.Request) {
+		sha := strings.TrimPrefix(r.URL.Path, "/repos/o/r/tarball/")
+		http.Redirect(w, r, server+"codeload/"+sha, http.StatusFound)
+	})
+	mux.HandleFunc("/codeload/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archives[strings.TrimPrefix(r.URL.Path, "/codeload/")])
+	})
+
+	bot := newTestBot(t, mux)
+	server = bot.client.BaseURL.String()
+	bot.config.Settings.Executor = ExecutorSettings{Enabled: true, Timeout: "2m"}
+
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Base:   &github.PullRequestBranch{SHA: github.String("base1")},
+		Head:   &github.PullRequestBranch{SHA: github.String("head1")},
+	}
+	// b and tools/x are untested but untouched, so they don't count
+	result := bot.runSpecificCheck(context.Background(), "o", "r", pr, "coverage")
+	if result.Status != "success" || result.Message != "Coverage 100.0% (+0.0), 100.0% of changed lines covered" {
+		t.Errorf("Expected full coverage of the touched packages, got %s: %s %v", result.Status, result.Message, result.Details)
+	}
+}
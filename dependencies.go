@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// DependencySettings is the policy for modules a PR adds or upgrades.
+// Allow and Deny are module path patterns: path.Match globs, or a prefix
+// ending in "/..." that matches the module and everything below it. When
+// Allow is non-empty, new modules must match it. Licenses are SPDX IDs and
+// apply to the direct requirements a PR adds.
+type DependencySettings struct {
+	Allow           []string `json:"allow"`
+	Deny            []string `json:"deny"`
+	AllowedLicenses []string `json:"allowed_licenses"`
+	DeniedLicenses  []string `json:"denied_licenses"`
+}
+
+func (s DependencySettings) validate() error {
+	if err := validatePatterns(s.Allow); err != nil {
+		return err
+	}
+	return validatePatterns(s.Deny)
+}
+
+// matchesModule reports whether module matches any of patterns.
+func matchesModule(patterns []string, module string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+			if module == prefix || strings.HasPrefix(module, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, module); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Kinds of dependency change.
+const (
+	DepAdded      = "added"
+	DepRemoved    = "removed"
+	DepUpgraded   = "upgraded"
+	DepDowngraded = "downgraded"
+)
+
+// DependencyChange is one module whose requirement changed between base
+// and head. FromModule is set when the module moved to a new major version
+// path.
+type DependencyChange struct {
+	GoMod      string
+	Module     string
+	Kind       string
+	FromModule string
+	From       string
+	To         string
+	Indirect   bool
+	License    string
+	Notes      []string
+}
+
+var majorSuffix = regexp.MustCompile(`/v([2-9]|[1-9][0-9]+)$`)
+
+func modulePathBase(module string) string {
+	return majorSuffix.ReplaceAllString(module, "")
+}
+
+// diffGoMod compares the requirements of two go.mod files. A module that
+// moved to a new major version path (example.com/x to example.com/x/v2) is
+// reported as one upgrade.
+func diffGoMod(goMod string, base, head *GoMod) []DependencyChange {
+	before := make(map[string]ModRequire)
+	for _, r := range base.Requires {
+		before[r.Path] = r
+	}
+	after := make(map[string]ModRequire)
+	for _, r := range head.Requires {
+		after[r.Path] = r
+	}
+
+	var changes []DependencyChange
+	removed := make(map[string]ModRequire)
+	for p, r := range before {
+		if _, ok := after[p]; !ok {
+			removed[modulePathBase(p)] = r
+		}
+	}
+
+	for _, r := range head.Requires {
+		old, existed := before[r.Path]
+		if !existed {
+			if prev, ok := removed[modulePathBase(r.Path)]; ok {
+				delete(removed, modulePathBase(r.Path))
+				changes = append(changes, DependencyChange{GoMod: goMod, Module: r.Path, Kind: DepUpgraded, FromModule: prev.Path, From: prev.Version, To: r.Version, Indirect: r.Indirect})
+				continue
+			}
+			changes = append(changes, DependencyChange{GoMod: goMod, Module: r.Path, Kind: DepAdded, To: r.Version, Indirect: r.Indirect})
+			continue
+		}
+		if old.Version == r.Version {
+			continue
+		}
+		kind := DepUpgraded
+		if semver.Compare(r.Version, old.Version) < 0 {
+			kind = DepDowngraded
+		}
+		changes = append(changes, DependencyChange{GoMod: goMod, Module: r.Path, Kind: kind, From: old.Version, To: r.Version, Indirect: r.Indirect})
+	}
+	for _, r := range removed {
+		changes = append(changes, DependencyChange{GoMod: goMod, Module: r.Path, Kind: DepRemoved, From: r.Version, Indirect: r.Indirect})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Module < changes[j].Module })
+	return changes
+}
+
+// licenseRepo maps a module path to the GitHub repository that hosts it.
+func licenseRepo(module string) (string, string, bool) {
+	parts := strings.Split(modulePathBase(module), "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "github.com":
+		return parts[1], parts[2], true
+	case len(parts) >= 3 && parts[0] == "golang.org" && parts[1] == "x":
+		return "golang", parts[2], true
+	case len(parts) == 2 && parts[0] == "gopkg.in":
+		// gopkg.in/yaml.v3 lives at github.com/go-yaml/yaml
+		name, _, _ := strings.Cut(parts[1], ".")
+		return "go-" + name, name, true
+	case len(parts) == 3 && parts[0] == "gopkg.in":
+		name, _, _ := strings.Cut(parts[2], ".")
+		return parts[1], name, true
+	}
+	return "", "", false
+}
+
+// moduleLicense returns the SPDX ID GitHub detects for module's
+// repository, "NONE" when it has no license and "" when it can't tell.
+func (rb *ReviewBot) moduleLicense(ctx context.Context, module string) (string, error) {
+	owner, repo, ok := licenseRepo(module)
+	if !ok {
+		return "", nil
+	}
+	license, _, err := rb.client.Repositories.License(ctx, owner, repo)
+	if isNotFound(err) {
+		return "NONE", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return license.GetLicense().GetSPDXID(), nil
+}
+
+func isNotFound(err error) bool {
+	var ghErr *github.ErrorResponse
+	return errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound
+}
+
+// applyDependencyPolicy annotates change with notes and reports whether it
+// violates the policy (failure) or only deserves attention (warning).
+func applyDependencyPolicy(settings DependencySettings, change *DependencyChange) (failure, warning bool) {
+	if change.Kind == DepRemoved {
+		return false, false
+	}
+
+	if matchesModule(settings.Deny, change.Module) {
+		change.Notes = append(change.Notes, "denied")
+		failure = true
+	} else if change.Kind == DepAdded && len(settings.Allow) > 0 && !matchesModule(settings.Allow, change.Module) {
+		change.Notes = append(change.Notes, "not on allow list")
+		failure = true
+	}
+
+	if change.Kind == DepUpgraded && (change.FromModule != "" || semver.Major(change.To) != semver.Major(change.From)) {
+		change.Notes = append(change.Notes, "major version")
+		warning = true
+	}
+	if module.IsPseudoVersion(change.To) {
+		change.Notes = append(change.Notes, "pseudo-version")
+		warning = true
+	}
+
+	licensed := change.Kind == DepAdded && !change.Indirect
+	if licensed && (len(settings.AllowedLicenses) > 0 || len(settings.DeniedLicenses) > 0) {
+		switch {
+		case change.License == "" || change.License == "NOASSERTION":
+			change.Notes = append(change.Notes, "license unknown")
+			warning = true
+		case containsString(settings.DeniedLicenses, change.License),
+			len(settings.AllowedLicenses) > 0 && !containsString(settings.AllowedLicenses, change.License):
+			change.Notes = append(change.Notes, "license "+change.License+" not allowed")
+			failure = true
+		}
+	}
+	return failure, warning
+}
+
+// goModAt parses filename at ref. A file that doesn't exist there parses
+// as an empty go.mod.
+func (rb *ReviewBot) goModAt(ctx context.Context, owner, repo, filename, ref string) (*GoMod, error) {
+	src, err := rb.fileContentAt(ctx, owner, repo, filename, ref)
+	if isNotFound(err) {
+		return &GoMod{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseGoMod(src)
+}
+
+// runDependenciesCheck reviews the module requirements a PR changes.
+func (rb *ReviewBot) runDependenciesCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	settings := rb.config.Settings.Dependencies
+
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return CheckResult{
+			Name:    "dependencies",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get PR files: %v", err),
+		}
+	}
+
+	var changes []DependencyChange
+	for _, file := range files {
+		name := file.GetFilename()
+		if path.Base(name) != "go.mod" || isVendored(name) {
+			continue
+		}
+
+		// A renamed go.mod has to be read from its old path at base.
+		basePath := name
+		if file.GetPreviousFilename() != "" {
+			basePath = file.GetPreviousFilename()
+		}
+		base, err := rb.goModAt(ctx, owner, repo, basePath, pr.GetBase().GetSHA())
+		if err != nil {
+			return CheckResult{
+				Name:    "dependencies",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to read %s at base: %v", basePath, err),
+			}
+		}
+		head := &GoMod{}
+		if file.GetStatus() != "removed" {
+			head, err = rb.goModAt(ctx, owner, repo, name, pr.GetHead().GetSHA())
+			if err != nil {
+				return CheckResult{
+					Name:    "dependencies",
+					Status:  "error",
+					Message: fmt.Sprintf("Failed to read %s at head: %v", name, err),
+				}
+			}
+		}
+		changes = append(changes, diffGoMod(name, base, head)...)
+	}
+
+	if len(changes) == 0 {
+		return CheckResult{
+			Name:    "dependencies",
+			Status:  "success",
+			Message: "No dependency changes",
+		}
+	}
+
+	licenses := make(map[string]string)
+	failures, warnings := 0, 0
+	counts := make(map[string]int)
+	for i := range changes {
+		change := &changes[i]
+		counts[change.Kind]++
+		if change.Kind == DepAdded && !change.Indirect {
+			license, ok := licenses[change.Module]
+			if !ok {
+				// An unknown license is flagged by the policy, not fatal
+				if license, err = rb.moduleLicense(ctx, change.Module); err != nil {
+					log.Printf("Failed to look up the license of %s: %v", change.Module, err)
+				}
+				licenses[change.Module] = license
+			}
+			change.License = license
+		}
+
+		failure, warning := applyDependencyPolicy(settings, change)
+		if failure {
+			failures++
+		} else if warning {
+			warnings++
+		}
+	}
+
+	var summary []string
+	for _, kind := range []string{DepAdded, DepUpgraded, DepDowngraded, DepRemoved} {
+		if counts[kind] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	message := "Dependencies: " + strings.Join(summary, ", ")
+
+	status := "success"
+	switch {
+	case failures > 0:
+		status = "failure"
+		message += fmt.Sprintf("; %d violate the dependency policy", failures)
+	case warnings > 0:
+		status = "warning"
+		message += fmt.Sprintf("; %d need attention", warnings)
+	}
+	return CheckResult{
+		Name:    "dependencies",
+		Status:  status,
+		Message: message,
+		Table:   dependencyTable(changes),
+	}
+}
+
+func dependencyTable(changes []DependencyChange) *CheckTable {
+	multipleGoMods := false
+	for _, change := range changes {
+		if change.GoMod != changes[0].GoMod {
+			multipleGoMods = true
+		}
+	}
+
+	table := &CheckTable{Header: []string{"Module", "Change", "From", "To", "License", "Notes"}}
+	if multipleGoMods {
+		table.Header = append([]string{"go.mod"}, table.Header...)
+	}
+	for _, change := range changes {
+		module := "`" + change.Module + "`"
+		if change.Indirect {
+			module += " (indirect)"
+		}
+		from := change.From
+		if change.FromModule != "" {
+			from = "`" + change.FromModule + "`@" + from
+		}
+		row := []string{module, change.Kind, from, change.To, change.License, strings.Join(change.Notes, ", ")}
+		if multipleGoMods {
+			row = append([]string{change.GoMod}, row...)
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const baseGoMod = `module example.com/m
+
+go 1.21
+
+require (
+	github.com/a/lib v1.4.0
+	github.com/b/old v0.3.0
+	github.com/c/major v1.9.0
+	github.com/d/down v1.2.0 // indirect
+)
+`
+
+const headGoMod = `module example.com/m
+
+go 1.21
+
+require (
+	github.com/a/lib v1.5.0
+	github.com/c/major/v2 v2.0.1
+	github.com/d/down v1.1.0 // indirect
+	github.com/e/new v0.0.0-20240102030405-0123456789ab
+	github.com/evil/pkg v1.0.0
+)
+`
+
+func TestDiffGoMod(t *testing.T) {
+	base, _ := parseGoMod([]byte(baseGoMod))
+	head, _ := parseGoMod([]byte(headGoMod))
+
+	var got []string
+	for _, c := range diffGoMod("go.mod", base, head) {
+		got = append(got, c.Module+" "+c.Kind+" "+c.FromModule+"@"+c.From+" -> "+c.To)
+	}
+	want := []string{
+		"github.com/a/lib upgraded @v1.4.0 -> v1.5.0",
+		"github.com/b/old removed @v0.3.0 -> ",
+		"github.com/c/major/v2 upgraded github.com/c/major@v1.9.0 -> v2.0.1",
+		"github.com/d/down downgraded @v1.2.0 -> v1.1.0",
+		"github.com/e/new added @ -> v0.0.0-20240102030405-0123456789ab",
+		"github.com/evil/pkg added @ -> v1.0.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestDiffGoModPrerelease(t *testing.T) {
+	base, _ := parseGoMod([]byte("module m\n\nrequire github.com/a/lib v1.0.0-rc.9\n"))
+	head, _ := parseGoMod([]byte("module m\n\nrequire github.com/a/lib v1.0.0-rc.10\n"))
+	changes := diffGoMod("go.mod", base, head)
+	if len(changes) != 1 || changes[0].Kind != DepUpgraded {
+		t.Errorf("Expected rc.9 to rc.10 to be an upgrade, got %+v", changes)
+	}
+}
+
+func TestDependencyPolicy(t *testing.T) {
+	settings := DependencySettings{
+		Allow:           []string{"github.com/e/...", "github.com/evil/*"},
+		Deny:            []string{"github.com/evil/..."},
+		AllowedLicenses: []string{"MIT", "Apache-2.0"},
+	}
+	tests := []struct {
+		change           DependencyChange
+		failure, warning bool
+		notes            []string
+	}{
+		{DependencyChange{Module: "github.com/evil/pkg", Kind: DepAdded, To: "v1.0.0", License: "MIT"}, true, false, []string{"denied"}},
+		{DependencyChange{Module: "github.com/x/y", Kind: DepAdded, To: "v1.0.0", License: "MIT"}, true, false, []string{"not on allow list"}},
+		{DependencyChange{Module: "github.com/e/new", Kind: DepAdded, To: "v0.0.0-20240102030405-0123456789ab", License: "GPL-3.0"}, true, true, []string{"pseudo-version", "license GPL-3.0 not allowed"}},
+		{DependencyChange{Module: "github.com/c/major/v2", Kind: DepUpgraded, FromModule: "github.com/c/major", From: "v1.9.0", To: "v2.0.1", License: "MIT"}, false, true, []string{"major version"}},
+		{DependencyChange{Module: "github.com/a/lib", Kind: DepUpgraded, From: "v1.4.0", To: "v1.5.0", License: ""}, false, false, nil},
+		{DependencyChange{Module: "github.com/e/lib", Kind: DepAdded, To: "v1.0.0", License: ""}, false, true, []string{"license unknown"}},
+		{DependencyChange{Module: "github.com/e/dep", Kind: DepAdded, To: "v1.0.0", Indirect: true, License: "GPL-3.0"}, false, false, nil},
+		{DependencyChange{Module: "github.com/b/old", Kind: DepRemoved, From: "v0.3.0"}, false, false, nil},
+	}
+	for _, tt := range tests {
+		change := tt.change
+		failure, warning := applyDependencyPolicy(settings, &change)
+		if failure != tt.failure || warning != tt.warning || !reflect.DeepEqual(change.Notes, tt.notes) {
+			t.Errorf("%s: expected failure=%v warning=%v notes=%v, got %v %v %v", change.Module, tt.failure, tt.warning, tt.notes, failure, warning, change.Notes)
+		}
+	}
+}
+
+func TestRunDependenciesCheck(t *testing.T) {
+	contents := map[string]string{"base1": baseGoMod, "head1": headGoMod}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{{Filename: github.String("go.mod"), Status: github.String("modified")}})
+	})
+	mux.HandleFunc("/repos/o/r/contents/go.mod", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(contents[r.URL.Query().Get("ref")]))),
+		})
+	})
+	mux.HandleFunc("/repos/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/e/new/license" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+			return
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryLicense{License: &github.License{SPDXID: github.String("MIT")}})
+	})
+
+	bot := newTestBot(t, mux)
+	bot.config.Settings.Dependencies = DependencySettings{Deny: []string{"github.com/evil/..."}}
+
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Base:   &github.PullRequestBranch{SHA: github.String("base1")},
+		Head:   &github.PullRequestBranch{SHA: github.String("head1")},
+	}
+	result := bot.runSpecificCheck(context.Background(), "o", "r", pr, "dependencies")
+
+	if result.Status != "failure" || result.Message != "Dependencies: 2 added, 2 upgraded, 1 downgraded, 1 removed; 1 violate the dependency policy" {
+		t.Fatalf("Unexpected result %s: %s", result.Status, result.Message)
+	}
+	if result.Table == nil || len(result.Table.Rows) != 6 {
+		t.Fatalf("Expected a table with 6 rows, got %+v", result.Table)
+	}
+
+	comment := bot.generateCommentBody([]CheckResult{result}, MergeVerdict{})
+	for _, want := range []string{
+		"#### dependencies\n\n| Module | Change | From | To | License | Notes |\n| --- | --- | --- | --- | --- | --- |\n",
+		"| `github.com/c/major/v2` | upgraded | `github.com/c/major`@v1.9.0 | v2.0.1 |  | major version |",
+		"| `github.com/e/new` | added |  | v0.0.0-20240102030405-0123456789ab | NONE | pseudo-version |",
+		"| `github.com/evil/pkg` | added |  | v1.0.0 | MIT | denied |",
+	} {
+		if !strings.Contains(comment, want) {
+			t.Errorf("Expected comment to contain %q, got:\n%s", want, comment)
+		}
+	}
+}
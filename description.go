@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// DescriptionSettings tunes the description check. By default it requires
+// the PR body to reference at least one open issue, with a closing keyword
+// ("Fixes #12") or a link ("acme/api#12", an issue URL), and every heading
+// of the repository's pull request template to be present and filled in.
+// Plain "#12" mentions are left alone, as they may point at anything.
+// NoIssue and NoTemplate turn either part off; Headings, when set, are the
+// required headings instead of the template's.
+type DescriptionSettings struct {
+	NoIssue    bool     `json:"no_issue"`
+	NoTemplate bool     `json:"no_template"`
+	Headings   []string `json:"headings"`
+}
+
+var prTemplatePaths = []string{
+	".github/PULL_REQUEST_TEMPLATE.md", ".github/pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md", "pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md", "docs/pull_request_template.md",
+}
+
+var (
+	issueRef = regexp.MustCompile(`(?i)(?:\b(close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+)?` +
+		`(?:https?://github\.com/([\w.-]+)/([\w.-]+)/issues/(\d+)|(?:([\w.-]+)/([\w.-]+))?#(\d+))\b`)
+	htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	mdHeading   = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*\s*$`)
+)
+
+// IssueRef is an issue referenced from a PR description.
+type IssueRef struct {
+	Owner   string
+	Repo    string
+	Number  int
+	Closing bool
+}
+
+func (r IssueRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+}
+
+// short drops the repository when it is owner/repo.
+func (r IssueRef) short(owner, repo string) string {
+	if strings.EqualFold(r.Owner, owner) && strings.EqualFold(r.Repo, repo) {
+		return fmt.Sprintf("#%d", r.Number)
+	}
+	return r.String()
+}
+
+// parseIssueRefs returns the issues body references with a closing keyword
+// or a link, in order of first mention. "Fixes #12" refers to owner/repo;
+// a bare "#12" is only a mention and is skipped, as is an owner/repo#12
+// that is really the tail of a URL such as https://example.com/foo/bar#12.
+func parseIssueRefs(body, owner, repo string) []IssueRef {
+	body = htmlComment.ReplaceAllString(body, "")
+	var refs []IssueRef
+	seen := make(map[string]int)
+	for _, loc := range issueRef.FindAllStringSubmatchIndex(body, -1) {
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = body[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		// m[5] is the owner of an owner/repo#N reference
+		if start := loc[10]; start > 0 && body[start-1] == '/' {
+			continue
+		}
+		ref := IssueRef{Owner: owner, Repo: repo, Closing: m[1] != ""}
+		switch {
+		case m[4] != "":
+			ref.Owner, ref.Repo, ref.Number = m[2], m[3], atoi(m[4])
+		case m[5] != "":
+			ref.Owner, ref.Repo, ref.Number = m[5], m[6], atoi(m[7])
+		case !ref.Closing:
+			continue
+		default:
+			ref.Number = atoi(m[7])
+		}
+		if i, ok := seen[strings.ToLower(ref.String())]; ok {
+			refs[i].Closing = refs[i].Closing || ref.Closing
+			continue
+		}
+		seen[strings.ToLower(ref.String())] = len(refs)
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+func descriptionProblems(n int) string {
+	if n == 1 {
+		return "1 description problem"
+	}
+	return fmt.Sprintf("%d description problems", n)
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// markdownSections splits markdown into its headings and the text under
+// each, ignoring headings inside fenced code blocks and HTML comments.
+// Heading keys are lower-cased.
+func markdownSections(md string) (headings []string, sections map[string]string) {
+	sections = make(map[string]string)
+	current := ""
+	var text strings.Builder
+	flush := func() {
+		if current != "" {
+			sections[current] = strings.TrimSpace(text.String())
+		}
+		text.Reset()
+	}
+
+	fenced := false
+	for _, line := range strings.Split(htmlComment.ReplaceAllString(md, ""), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+		}
+		if m := mdHeading.FindStringSubmatch(strings.TrimSpace(line)); m != nil && !fenced {
+			flush()
+			current = strings.ToLower(m[1])
+			if _, ok := sections[current]; !ok {
+				headings = append(headings, m[1])
+			}
+			continue
+		}
+		text.WriteString(line + "\n")
+	}
+	flush()
+	return headings, sections
+}
+
+// templateProblems reports the required headings that body lacks or left as
+// the template had them.
+func templateProblems(template, body string, required []string) []string {
+	templateHeadings, placeholders := markdownSections(template)
+	if len(required) == 0 {
+		required = templateHeadings
+	}
+	_, sections := markdownSections(body)
+
+	var problems []string
+	for _, heading := range required {
+		key := strings.ToLower(strings.TrimSpace(strings.TrimLeft(heading, "# ")))
+		text, ok := sections[key]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("missing section %q", heading))
+		case text == "" || text == placeholders[key]:
+			problems = append(problems, fmt.Sprintf("section %q is empty", heading))
+		}
+	}
+	return problems
+}
+
+func (rb *ReviewBot) runDescriptionCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	settings := rb.config.Settings.Description
+	var details, summary []string
+
+	if !settings.NoIssue {
+		var open []string
+		closes := true
+		for _, ref := range parseIssueRefs(pr.GetBody(), owner, repo) {
+			if ref.Owner == owner && ref.Repo == repo && ref.Number == pr.GetNumber() {
+				continue
+			}
+			issue, _, err := rb.client.Issues.Get(ctx, ref.Owner, ref.Repo, ref.Number)
+			switch {
+			case isNotFound(err):
+				details = append(details, fmt.Sprintf("%s does not exist", ref.short(owner, repo)))
+			case err != nil:
+				return CheckResult{Name: "description", Status: "error", Message: fmt.Sprintf("Failed to look up %s: %v", ref, err)}
+			case issue.IsPullRequest():
+				details = append(details, fmt.Sprintf("%s is a pull request, not an issue", ref.short(owner, repo)))
+			case issue.GetState() != "open":
+				details = append(details, fmt.Sprintf("%s is closed", ref.short(owner, repo)))
+			default:
+				open = append(open, ref.short(owner, repo))
+				closes = closes && ref.Closing
+			}
+		}
+		if len(open) == 0 && len(details) == 0 {
+			details = append(details, `no linked issue; reference one with a closing keyword (e.g. "Fixes #123") or a link`)
+		}
+		if len(open) > 0 {
+			verb := "references"
+			if closes {
+				verb = "closes"
+			}
+			summary = append(summary, verb+" "+strings.Join(capDetails(open, 3), ", "))
+		}
+	}
+
+	if !settings.NoTemplate {
+		template, err := rb.pullRequestTemplate(ctx, owner, repo, pr.GetBase().GetRef())
+		if err != nil {
+			return CheckResult{Name: "description", Status: "error", Message: fmt.Sprintf("Failed to read the pull request template: %v", err)}
+		}
+		if template != "" || len(settings.Headings) > 0 {
+			problems := templateProblems(template, pr.GetBody(), settings.Headings)
+			details = append(details, problems...)
+			if len(problems) == 0 {
+				summary = append(summary, "fills in the template")
+			}
+		}
+	}
+
+	if len(details) > 0 {
+		return CheckResult{
+			Name:    "description",
+			Status:  "failure",
+			Message: descriptionProblems(len(details)),
+			Details: capDetails(details, maxCheckDetails),
+		}
+	}
+	message := "Description is complete"
+	if len(summary) > 0 {
+		message = "Description " + strings.Join(summary, " and ")
+	}
+	return CheckResult{Name: "description", Status: "success", Message: message}
+}
+
+// pullRequestTemplate returns the repository's pull request template at
+// ref, or "" if it has none.
+func (rb *ReviewBot) pullRequestTemplate(ctx context.Context, owner, repo, ref string) (string, error) {
+	for _, name := range prTemplatePaths {
+		src, err := rb.fileContentAt(ctx, owner, repo, name, ref)
+		if err == nil {
+			return string(src), nil
+		}
+		if !isNotFound(err) {
+			return "", fmt.Errorf("reading %s: %w", name, err)
+		}
+	}
+	return "", nil
+}
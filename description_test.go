@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestParseIssueRefs(t *testing.T) {
+	body := "Fixes #12 and resolves acme/web#3.\n" +
+		"See https://github.com/acme/api/issues/7, #12 again and #5.\n" +
+		"<!-- e.g. Closes #999 -->\n" +
+		"Not an issue: https://github.com/acme/api/pull/8\n" +
+		"Nor is this: fixes https://example.com/foo/bar#12"
+	want := []IssueRef{
+		{Owner: "acme", Repo: "api", Number: 12, Closing: true},
+		{Owner: "acme", Repo: "web", Number: 3, Closing: true},
+		{Owner: "acme", Repo: "api", Number: 7},
+	}
+	if got := parseIssueRefs(body, "acme", "api"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestTemplateProblems(t *testing.T) {
+	template := "## Summary\n<!-- What does this change? -->\n\n## Testing\n- [ ] unit tests\n\n## Rollout\n"
+	body := "## Summary\nAdds retries:\n```\n## Rollout\n```\n\n### testing\n- [ ] unit tests\n"
+	want := []string{`section "Testing" is empty`, `missing section "Rollout"`}
+	if got := templateProblems(template, body, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := templateProblems("", body, []string{"## Summary"}); len(got) != 0 {
+		t.Errorf("Expected configured headings to be satisfied, got %q", got)
+	}
+}
+
+func TestRunDescriptionCheck(t *testing.T) {
+	issues := map[string]*github.Issue{
+		"/repos/o/r/issues/1": {Number: github.Int(1), State: github.String("open")},
+		"/repos/o/r/issues/2": {Number: github.Int(2), State: github.String("closed")},
+		"/repos/o/r/issues/3": {Number: github.Int(3), State: github.String("open"), PullRequestLinks: &github.PullRequestLinks{}},
+	}
+	template := "## Summary\n\n## Testing\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/issues/", func(w http.ResponseWriter, r *http.Request) {
+		issue, ok := issues[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(issue)
+	})
+	mux.HandleFunc("/repos/o/r/contents/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/contents/.github/pull_request_template.md" || r.URL.Query().Get("ref") != "main" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(template))),
+		})
+	})
+	bot := newTestBot(t, mux)
+	pr := &github.PullRequest{Number: github.Int(10), Base: &github.PullRequestBranch{Ref: github.String("main")}}
+
+	pr.Body = github.String("## Summary\nAdds retries. Fixes #1\n\n## Testing\nUnit tests.")
+	result := bot.runDescriptionCheck(context.Background(), "o", "r", pr)
+	if result.Status != "success" || result.Message != "Description closes #1 and fills in the template" {
+		t.Errorf("Expected success, got %+v", result)
+	}
+
+	pr.Body = github.String("## Summary\nSee o/r#2, o/r#3, fixes #4 and #10.\n")
+	result = bot.runDescriptionCheck(context.Background(), "o", "r", pr)
+	want := []string{"#2 is closed", "#3 is a pull request, not an issue", "#4 does not exist", `missing section "Testing"`}
+	if result.Status != "failure" || result.Message != "4 description problems" || !reflect.DeepEqual(result.Details, want) {
+		t.Errorf("Expected failures %q, got %+v", want, result)
+	}
+
+	// Plain mentions are not issue links
+	pr.Body = github.String("Follow-up to #2, see #99.")
+	bot.config.Settings.Description.NoTemplate = true
+	result = bot.runDescriptionCheck(context.Background(), "o", "r", pr)
+	if result.Status != "failure" || len(result.Details) != 1 || !strings.HasPrefix(result.Details[0], "no linked issue") {
+		t.Errorf("Expected a missing issue, got %+v", result)
+	}
+}
+
+func TestEditedDescriptionReruns(t *testing.T) {
+	pr := &github.PullRequest{
+		Number: github.Int(10),
+		State:  github.String("open"),
+		Body:   github.String("Fixes #1"),
+		Head:   &github.PullRequestBranch{SHA: github.String("abc")},
+		Base:   &github.PullRequestBranch{Ref: github.String("main")},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.Issue{Number: github.Int(1), State: github.String("open")})
+	})
+	mux.HandleFunc("/repos/o/r/pulls/10", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(pr)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/10/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("/repos/o/r/statuses/abc", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/repos/o/r/issues/10/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+	bot := newTestBot(t, mux)
+	bot.evaluations = NewEvaluationStore(NewStore(t.TempDir()))
+	bot.config.RequiredChecks = []string{"test", "description"}
+	bot.config.Settings.Description.NoTemplate = true
+	bot.evaluations.Record(Evaluation{Repository: "o/r", PRNumber: 10, HeadSHA: "abc", Checks: []CheckResult{
+		{Name: "test", Status: "success", Message: "All tests passed"},
+		{Name: "description", Status: "failure", Message: "1 description problem"},
+	}})
+
+	bot.handlePullRequestEvent(context.Background(), &github.PullRequestEvent{
+		Action:      github.String("edited"),
+		PullRequest: pr,
+		Changes:     &github.EditChange{Body: &github.EditBody{From: github.String("")}},
+		Repo:        &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+	}, time.Now())
+
+	eval, _ := bot.evaluations.Get("o/r", 10)
+	if len(eval.Checks) != 2 || eval.Checks[0].Message != "All tests passed" || eval.Checks[1].Status != "success" {
+		t.Errorf("Expected only the description check to rerun, got %+v", eval.Checks)
+	}
+
+	// Results for an older head are not kept
+	pr.Head.SHA = github.String("def")
+	mux.HandleFunc("/repos/o/r/statuses/def", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	bot.handlePullRequestEvent(context.Background(), &github.PullRequestEvent{
+		Action:      github.String("edited"),
+		PullRequest: pr,
+		Changes:     &github.EditChange{Body: &github.EditBody{From: github.String("")}},
+		Repo:        &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}},
+	}, time.Now())
+
+	eval, _ = bot.evaluations.Get("o/r", 10)
+	if len(eval.Checks) != 2 || eval.HeadSHA != "def" || eval.Checks[0].Message == "All tests passed" {
+		t.Errorf("Expected every check to run for the new head, got %+v", eval)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/digest.txt.tmpl templates/digest.html.tmpl
+var digestTemplates embed.FS
+
+var digestFuncs = map[string]interface{}{"join": strings.Join}
+
+var (
+	digestText = template.Must(template.New("digest.txt.tmpl").Funcs(digestFuncs).ParseFS(digestTemplates, "templates/digest.txt.tmpl"))
+	digestHTML = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(digestFuncs).ParseFS(digestTemplates, "templates/digest.html.tmpl"))
+)
+
+// DigestSettings configures the scheduled e-mail digest. Schedule is a
+// standard five-field cron expression evaluated in TimeZone (UTC when empty).
+type DigestSettings struct {
+	Schedule string           `json:"schedule"`
+	TimeZone string           `json:"time_zone"`
+	From     string           `json:"from"`
+	Subject  string           `json:"subject"`
+	Watchers []DigestWatchers `json:"watchers"`
+}
+
+// DigestWatchers subscribes e-mail addresses to the repositories matching
+// Repos.
+type DigestWatchers struct {
+	Repos  []string `json:"repos"`
+	Emails []string `json:"emails"`
+}
+
+type SMTPSettings struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DigestPR is a pull request listed in a digest.
+type DigestPR struct {
+	Evaluation
+	FailingChecks []CheckResult
+}
+
+// DigestRepo groups one repository's PRs by the reason they need attention.
+// A PR can appear in more than one group.
+type DigestRepo struct {
+	Repository     string
+	Blocked        []DigestPR
+	Failing        []DigestPR
+	StaleApprovals []DigestPR
+}
+
+type Digest struct {
+	Recipient   string
+	GeneratedAt time.Time
+	Repos       []DigestRepo
+}
+
+// buildDigests groups open evaluations into one digest per watcher e-mail.
+// Repositories with nothing to report are left out, as are watchers whose
+// digest would be empty.
+func buildDigests(evals []Evaluation, watchers []DigestWatchers, now time.Time) []Digest {
+	repos := make(map[string]*DigestRepo)
+	var order []string
+	for _, eval := range evals {
+		if eval.State != PROpen {
+			continue
+		}
+
+		pr := DigestPR{Evaluation: eval, FailingChecks: eval.failingChecks()}
+		blocked := !eval.CanMerge
+		failing := len(pr.FailingChecks) > 0
+		stale := len(eval.StaleApprovals) > 0
+		if !blocked && !failing && !stale {
+			continue
+		}
+
+		repo, ok := repos[eval.Repository]
+		if !ok {
+			repo = &DigestRepo{Repository: eval.Repository}
+			repos[eval.Repository] = repo
+			order = append(order, eval.Repository)
+		}
+		if blocked {
+			repo.Blocked = append(repo.Blocked, pr)
+		}
+		if failing {
+			repo.Failing = append(repo.Failing, pr)
+		}
+		if stale {
+			repo.StaleApprovals = append(repo.StaleApprovals, pr)
+		}
+	}
+	sort.Strings(order)
+
+	digests := make(map[string]*Digest)
+	var recipients []string
+	for _, repository := range order {
+		seen := make(map[string]bool)
+		for _, w := range watchers {
+			if !matchesAny(w.Repos, repository) {
+				continue
+			}
+			for _, email := range w.Emails {
+				if seen[email] {
+					continue
+				}
+				seen[email] = true
+
+				digest, ok := digests[email]
+				if !ok {
+					digest = &Digest{Recipient: email, GeneratedAt: now}
+					digests[email] = digest
+					recipients = append(recipients, email)
+				}
+				digest.Repos = append(digest.Repos, *repos[repository])
+			}
+		}
+	}
+
+	sort.Strings(recipients)
+	result := make([]Digest, 0, len(recipients))
+	for _, email := range recipients {
+		result = append(result, *digests[email])
+	}
+	return result
+}
+
+func (d Digest) prCount() int {
+	seen := make(map[string]bool)
+	for _, repo := range d.Repos {
+		for _, group := range [][]DigestPR{repo.Blocked, repo.Failing, repo.StaleApprovals} {
+			for _, pr := range group {
+				seen[pr.key()] = true
+			}
+		}
+	}
+	return len(seen)
+}
+
+// renderDigest produces the plain-text and HTML bodies for d.
+func renderDigest(d Digest) (string, string, error) {
+	var text, html bytes.Buffer
+	if err := digestText.Execute(&text, d); err != nil {
+		return "", "", fmt.Errorf("rendering text digest: %w", err)
+	}
+	if err := digestHTML.Execute(&html, d); err != nil {
+		return "", "", fmt.Errorf("rendering HTML digest: %w", err)
+	}
+	return text.String(), html.String(), nil
+}
+
+// composeEmail builds a multipart/alternative message so clients that can't
+// show HTML fall back to the text part.
+func composeEmail(from, to, subject, text, html string, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n", writer.Boundary())
+	fmt.Fprintf(&msg, "\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func (rb *ReviewBot) sendMail(to string, msg []byte) error {
+	settings := rb.config.Settings.SMTP
+	port := settings.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := settings.Host + ":" + strconv.Itoa(port)
+
+	var auth smtp.Auth
+	if settings.Username != "" {
+		auth = smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)
+	}
+	return smtp.SendMail(addr, auth, rb.config.Settings.Digest.From, []string{to}, msg)
+}
+
+// sendDigests e-mails every watcher a digest of the PRs that need attention
+// in their repositories and returns how many were sent.
+func (rb *ReviewBot) sendDigests(ctx context.Context) (int, error) {
+	settings := rb.config.Settings.Digest
+	if rb.config.Settings.SMTP.Host == "" || settings.From == "" {
+		return 0, fmt.Errorf("digest e-mail is not configured")
+	}
+
+	_, span := tracer().Start(ctx, "sendDigests")
+	defer span.End()
+
+	now := time.Now().UTC()
+	digests := buildDigests(rb.evaluations.List(), settings.Watchers, now)
+
+	sent := 0
+	var failures []string
+	for _, digest := range digests {
+		text, html, err := renderDigest(digest)
+		if err != nil {
+			return sent, err
+		}
+
+		subject := settings.Subject
+		if subject == "" {
+			subject = fmt.Sprintf("Review Bot digest: %d pull requests need attention", digest.prCount())
+		}
+		msg, err := composeEmail(settings.From, digest.Recipient, subject, text, html, now)
+		if err != nil {
+			return sent, err
+		}
+
+		if err := rb.sendMail(digest.Recipient, msg); err != nil {
+			log.Printf("Failed to send digest to %s: %v", digest.Recipient, err)
+			failures = append(failures, digest.Recipient)
+			continue
+		}
+		sent++
+	}
+
+	log.Printf("Sent %d digest e-mails", sent)
+	if len(failures) > 0 {
+		err := fmt.Errorf("failed to send digest to %s", strings.Join(failures, ", "))
+		recordSpanError(span, err)
+		return sent, err
+	}
+	return sent, nil
+}
+
+// handleSendDigest sends the digest immediately, outside its schedule.
+func (rb *ReviewBot) handleSendDigest(w http.ResponseWriter, r *http.Request) {
+	sent, err := rb.sendDigests(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	status := http.StatusOK
+	response := map[string]interface{}{"sent": sent}
+	if err != nil {
+		status = http.StatusBadGateway
+		response["error"] = err.Error()
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
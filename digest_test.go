@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var digestEvaluations = []Evaluation{
+	{Repository: "acme/api", PRNumber: 1, Title: "Needs reviews", URL: "https://github.com/acme/api/pull/1",
+		State: PROpen, CanMerge: false, Reason: "Need 2 approvals, have 1"},
+	{Repository: "acme/api", PRNumber: 2, Title: "Broken build", URL: "https://github.com/acme/api/pull/2",
+		State: PROpen, CanMerge: true, Checks: []CheckResult{{Name: "build", Status: "failure", Message: "Build failed"}}},
+	{Repository: "acme/web", PRNumber: 3, Title: "Pushed after approval", URL: "https://github.com/acme/web/pull/3",
+		State: PROpen, CanMerge: true, StaleApprovals: []string{"octocat"}},
+	{Repository: "acme/web", PRNumber: 4, Title: "All good", State: PROpen, CanMerge: true},
+	{Repository: "acme/web", PRNumber: 5, Title: "Merged", State: PRMerged, CanMerge: false},
+}
+
+func TestBuildDigests(t *testing.T) {
+	watchers := []DigestWatchers{
+		{Repos: []string{"acme/*"}, Emails: []string{"lead@acme.test"}},
+		{Repos: []string{"acme/web"}, Emails: []string{"web@acme.test", "lead@acme.test"}},
+	}
+
+	digests := buildDigests(digestEvaluations, watchers, time.Now())
+	if len(digests) != 2 {
+		t.Fatalf("Expected 2 digests, got %d", len(digests))
+	}
+
+	lead, web := digests[0], digests[1]
+	if lead.Recipient != "lead@acme.test" || len(lead.Repos) != 2 {
+		t.Errorf("Expected lead to get both repositories once, got %s with %d repos", lead.Recipient, len(lead.Repos))
+	}
+	if web.Recipient != "web@acme.test" || len(web.Repos) != 1 || web.Repos[0].Repository != "acme/web" {
+		t.Errorf("Expected web team to get acme/web only, got %+v", web)
+	}
+
+	api := lead.Repos[0]
+	if len(api.Blocked) != 1 || api.Blocked[0].PRNumber != 1 {
+		t.Errorf("Expected PR #1 to be blocked, got %+v", api.Blocked)
+	}
+	if len(api.Failing) != 1 || api.Failing[0].PRNumber != 2 {
+		t.Errorf("Expected PR #2 to be failing, got %+v", api.Failing)
+	}
+	if len(web.Repos[0].StaleApprovals) != 1 || len(web.Repos[0].Blocked) != 0 {
+		t.Errorf("Expected only the stale approval for acme/web (merged PR excluded), got %+v", web.Repos[0])
+	}
+	if lead.prCount() != 3 {
+		t.Errorf("Expected lead digest to cover 3 PRs, got %d", lead.prCount())
+	}
+}
+
+func TestEvaluationsWithoutStateAreOpen(t *testing.T) {
+	store := NewStore(t.TempDir())
+	legacy := map[string]Evaluation{"acme/api#1": {Repository: "acme/api", PRNumber: 1, Reason: "Need 2 approvals, have 1"}}
+	if err := store.Save(evaluationsStoreName, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	evals := NewEvaluationStore(store).List()
+	if len(evals) != 1 || evals[0].State != PROpen {
+		t.Fatalf("Expected the evaluation to load as open, got %+v", evals)
+	}
+	if digests := buildDigests(evals, []DigestWatchers{{Repos: []string{"acme/*"}, Emails: []string{"lead@acme.test"}}}, time.Now()); len(digests) != 1 {
+		t.Errorf("Expected the blocked PR in a digest, got %+v", digests)
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	digests := buildDigests(digestEvaluations, []DigestWatchers{{Repos: []string{"*/*"}, Emails: []string{"a@acme.test"}}}, time.Now())
+	text, html, err := renderDigest(digests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Blocked by merge policy", "#1 Needs reviews - Need 2 approvals, have 1", "#2 Broken build - build", "octocat"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected text digest to contain %q:\n%s", want, text)
+		}
+	}
+	for _, want := range []string{`<a href="https://github.com/acme/api/pull/2">`, "<strong>build</strong>: Build failed", "Stale approvals"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected HTML digest to contain %q:\n%s", want, html)
+		}
+	}
+}
+
+// smtpSink is a minimal SMTP server that accepts every message.
+type smtpSink struct {
+	mu       sync.Mutex
+	messages map[string]string
+}
+
+func startSMTPSink(t *testing.T) (*smtpSink, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sink := &smtpSink{messages: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(conn)
+		}
+	}()
+	return sink, listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 sink ready")
+	var rcpt string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			rcpt = strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages[rcpt] = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSendDigestsOverSMTP(t *testing.T) {
+	sink, port := startSMTPSink(t)
+
+	bot := NewReviewBot(NewConfig())
+	bot.evaluations = NewEvaluationStore(NewStore(t.TempDir()))
+	for _, eval := range digestEvaluations {
+		bot.evaluations.Record(eval)
+	}
+	bot.config.Settings.SMTP = SMTPSettings{Host: "127.0.0.1", Port: port}
+	bot.config.Settings.Digest = DigestSettings{
+		From:     "review-bot@acme.test",
+		Watchers: []DigestWatchers{{Repos: []string{"acme/api"}, Emails: []string{"api@acme.test"}}},
+	}
+
+	sent, err := bot.sendDigests(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Fatalf("Expected 1 digest, got %d", sent)
+	}
+
+	msg := sink.messages["api@acme.test"]
+	for _, want := range []string{
+		"From: review-bot@acme.test",
+		"Subject: Review Bot digest: 2 pull requests need attention",
+		"Content-Type: multipart/alternative",
+		"Content-Type: text/plain",
+		"Content-Type: text/html",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected message to contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := parseSchedule("0 8 * * 1-5", "Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saturday 2024-06-01 -> next run is Monday 08:00 Berlin time (06:00 UTC)
+	next := schedule.Next(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, 6, 3, 6, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("Expected next run at %v, got %v", want, next.UTC())
+	}
+
+	if _, err := parseSchedule("not a cron", ""); err == nil {
+		t.Error("Expected invalid schedule to be rejected")
+	}
+}
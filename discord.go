@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Discord webhook embed colours.
+const (
+	discordGreen  = 0x2ECC71
+	discordOrange = 0xE67E22
+	discordRed    = 0xE74C3C
+)
+
+type DiscordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []DiscordEmbed `json:"embeds"`
+}
+
+type DiscordEmbed struct {
+	Title       string              `json:"title"`
+	URL         string              `json:"url,omitempty"`
+	Description string              `json:"description"`
+	Color       int                 `json:"color"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// discordMessage renders eval as a Discord embed. Discord caps embed titles
+// at 256 characters, field values at 1024 and the number of fields at 25.
+func discordMessage(eval Evaluation) DiscordMessage {
+	verdict, color := "✅ **Ready to merge**", discordGreen
+	if !eval.CanMerge {
+		verdict, color = "⏳ **Not ready to merge**", discordOrange
+	}
+	if !eval.mergeReady() && eval.CanMerge {
+		color = discordRed
+	}
+
+	description := fmt.Sprintf("%s — %s", verdict, eval.Reason)
+	if eval.Author != "" {
+		description += "\nOpened by **" + eval.Author + "**"
+	}
+
+	embed := DiscordEmbed{
+		Title:       truncate(summaryTitle(eval), 256),
+		URL:         eval.URL,
+		Description: truncate(description, 4096),
+		Color:       color,
+	}
+	for i, check := range eval.Checks {
+		if i == 25 {
+			break
+		}
+		// Discord rejects embeds with empty field values
+		value := check.Message
+		if value == "" {
+			value = check.Status
+		}
+		embed.Fields = append(embed.Fields, DiscordEmbedField{
+			Name:   checkEmoji(check.Status) + " " + check.Name,
+			Value:  truncate(value, 1024),
+			Inline: true,
+		})
+	}
+	if eval.HeadSHA != "" {
+		embed.Footer = &DiscordEmbedFooter{Text: "Head " + shortSHA(eval.HeadSHA)}
+	}
+	if !eval.EvaluatedAt.IsZero() {
+		embed.Timestamp = eval.EvaluatedAt.Format(time.RFC3339)
+	}
+
+	return DiscordMessage{Username: "Review Bot", Embeds: []DiscordEmbed{embed}}
+}
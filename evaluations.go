@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const evaluationsStoreName = "evaluations"
+
+// Pull request states tracked on evaluations.
+const (
+	PROpen   = "open"
+	PRClosed = "closed"
+	PRMerged = "merged"
+)
+
+// Evaluation is the bot's latest verdict on a pull request.
+type Evaluation struct {
+	Repository string        `json:"repository"`
+	PRNumber   int           `json:"pr_number"`
+	Title      string        `json:"title"`
+	URL        string        `json:"url"`
+	Author     string        `json:"author"`
+	HeadSHA    string        `json:"head_sha"`
+	State      string        `json:"state"`
+	Checks     []CheckResult `json:"checks"`
+	CanMerge   bool          `json:"can_merge"`
+	Reason     string        `json:"reason"`
+	// Blockers lists the conditions that kept the PR from merging.
+	Blockers []string `json:"blockers,omitempty"`
+	// StaleApprovals lists reviewers whose approval predates the head commit.
+	StaleApprovals []string `json:"stale_approvals,omitempty"`
+	// LabelsAdded and LabelsRemoved are the autolabel changes made by the
+	// run that produced this evaluation.
+	LabelsAdded   []string  `json:"labels_added,omitempty"`
+	LabelsRemoved []string  `json:"labels_removed,omitempty"`
+	EvaluatedAt   time.Time `json:"evaluated_at"`
+}
+
+func (e Evaluation) key() string {
+	return fmt.Sprintf("%s#%d", e.Repository, e.PRNumber)
+}
+
+// verdict is the merge verdict the evaluation recorded.
+func (e Evaluation) verdict() MergeVerdict {
+	return MergeVerdict{CanMerge: e.CanMerge, Reason: e.Reason, Blockers: e.Blockers, StaleApprovals: e.StaleApprovals}
+}
+
+// failingChecks returns the checks that failed or errored.
+func (e Evaluation) failingChecks() []CheckResult {
+	var failed []CheckResult
+	for _, check := range e.Checks {
+		if check.Status == "failure" || check.Status == "error" {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// mergeReady reports whether the policy allows merging and no check failed.
+func (e Evaluation) mergeReady() bool {
+	if !e.CanMerge {
+		return false
+	}
+	for _, check := range e.Checks {
+		if check.Status == "failure" {
+			return false
+		}
+	}
+	return true
+}
+
+// EvaluationChange pairs a new evaluation with the one it replaced.
+type EvaluationChange struct {
+	Current     Evaluation
+	Previous    Evaluation
+	HadPrevious bool
+}
+
+// notable reports whether the change is worth telling people about: a first
+// evaluation, or a change in merge readiness or any check status.
+func (c EvaluationChange) notable() bool {
+	return !c.HadPrevious ||
+		c.Previous.CanMerge != c.Current.CanMerge ||
+		!sameCheckStatuses(c.Previous.Checks, c.Current.Checks)
+}
+
+// EvaluationStore keeps the most recent evaluation per pull request so that
+// integrations can tell what changed between runs.
+type EvaluationStore struct {
+	mu          sync.Mutex
+	store       *Store
+	evaluations map[string]Evaluation
+}
+
+func NewEvaluationStore(store *Store) *EvaluationStore {
+	es := &EvaluationStore{
+		store:       store,
+		evaluations: make(map[string]Evaluation),
+	}
+	if err := store.Load(evaluationsStoreName, &es.evaluations); err != nil {
+		log.Printf("Failed to load evaluations: %v", err)
+	}
+	// Evaluations recorded before states were tracked are of open PRs
+	for key, eval := range es.evaluations {
+		if eval.State == "" {
+			eval.State = PROpen
+			es.evaluations[key] = eval
+		}
+	}
+	return es
+}
+
+// Record saves eval and returns the evaluation it replaced, if any. When eval
+// carries no check results (e.g. a review-triggered re-evaluation) the
+// previous results are kept.
+func (es *EvaluationStore) Record(eval Evaluation) (Evaluation, bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	previous, found := es.evaluations[eval.key()]
+	if len(eval.Checks) == 0 && found {
+		eval.Checks = previous.Checks
+	}
+	if eval.State == "" {
+		eval.State = PROpen
+	}
+	es.evaluations[eval.key()] = eval
+
+	es.saveLocked()
+	return previous, found
+}
+
+// MarkClosed records that a pull request was closed (or merged) so it drops
+// out of reports about open work.
+func (es *EvaluationStore) MarkClosed(repository string, prNumber int, merged bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	key := Evaluation{Repository: repository, PRNumber: prNumber}.key()
+	eval, found := es.evaluations[key]
+	if !found {
+		return
+	}
+	eval.State = PRClosed
+	if merged {
+		eval.State = PRMerged
+	}
+	es.evaluations[key] = eval
+	es.saveLocked()
+}
+
+// Get returns the latest evaluation of a pull request.
+func (es *EvaluationStore) Get(repository string, prNumber int) (Evaluation, bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	eval, found := es.evaluations[Evaluation{Repository: repository, PRNumber: prNumber}.key()]
+	return eval, found
+}
+
+// List returns all evaluations ordered by repository and PR number.
+func (es *EvaluationStore) List() []Evaluation {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	evals := make([]Evaluation, 0, len(es.evaluations))
+	for _, eval := range es.evaluations {
+		evals = append(evals, eval)
+	}
+	sort.Slice(evals, func(i, j int) bool {
+		if evals[i].Repository != evals[j].Repository {
+			return evals[i].Repository < evals[j].Repository
+		}
+		return evals[i].PRNumber < evals[j].PRNumber
+	})
+	return evals
+}
+
+func (es *EvaluationStore) saveLocked() {
+	if err := es.store.Save(evaluationsStoreName, es.evaluations); err != nil {
+		log.Printf("Failed to persist evaluations: %v", err)
+	}
+}
+
+// listReviews returns all reviews of a pull request, following pagination.
+func (rb *ReviewBot) listReviews(ctx context.Context, owner, repo string, prNumber int) ([]*github.PullRequestReview, error) {
+	var all []*github.PullRequestReview
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := rb.client.PullRequests.ListReviews(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, reviews...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// latestReviews returns each reviewer's latest review that isn't a comment,
+// keyed by login.
+func latestReviews(reviews []*github.PullRequestReview) map[string]*github.PullRequestReview {
+	latest := make(map[string]*github.PullRequestReview)
+	for _, review := range reviews {
+		// Comments don't change a reviewer's verdict
+		if review.GetState() == "COMMENTED" {
+			continue
+		}
+		latest[review.GetUser().GetLogin()] = review
+	}
+	return latest
+}
+
+// approvalCount returns the number of reviewers whose latest review is an
+// approval.
+func approvalCount(reviews []*github.PullRequestReview) int {
+	approvals := 0
+	for _, review := range latestReviews(reviews) {
+		if review.GetState() == "APPROVED" {
+			approvals++
+		}
+	}
+	return approvals
+}
+
+// staleApprovals returns the reviewers whose latest review is an approval of
+// a commit other than head.
+func staleApprovals(reviews []*github.PullRequestReview, head string) []string {
+	var stale []string
+	for login, review := range latestReviews(reviews) {
+		if review.GetState() == "APPROVED" && review.GetCommitID() != head {
+			stale = append(stale, login)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/gorilla/mux"
+)
+
+// FreezeSettings configures merge freezes. While a freeze covers a PR's
+// repository and base branch its merge policy is not satisfied, so
+// ci/review-bot stays pending with the reason "merge freeze".
+//
+// Windows recur (Schedule, a cron expression for when the freeze starts,
+// plus Duration) or happen once (From to To, as "2006-01-02 15:04",
+// "2006-01-02" or RFC 3339), evaluated in TimeZone. Further freezes can be
+// started and stopped ad hoc through the admin API. A PR carrying
+// OverrideLabel, added by a user with write access, may merge regardless;
+// every such override is written to the audit log.
+type FreezeSettings struct {
+	Windows       []FreezeWindow `json:"windows"`
+	OverrideLabel string         `json:"override_label"`
+}
+
+// FreezeWindow is a configured freeze. Repos ("owner/repo" globs) and
+// Branches (base-branch globs, "**" crossing "/") narrow it; empty means
+// everywhere.
+type FreezeWindow struct {
+	Name     string   `json:"name"`
+	Reason   string   `json:"reason"`
+	Schedule string   `json:"schedule"`
+	Duration string   `json:"duration"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	TimeZone string   `json:"time_zone"`
+	Repos    []string `json:"repos"`
+	Branches []string `json:"branches"`
+}
+
+func (s FreezeSettings) validate() error {
+	names := make(map[string]bool)
+	for i, w := range s.Windows {
+		if w.Name == "" {
+			return fmt.Errorf("window %d has no name", i)
+		}
+		if names[w.Name] {
+			return fmt.Errorf("duplicate window name %q", w.Name)
+		}
+		names[w.Name] = true
+		if _, err := w.active(time.Now()); err != nil {
+			return fmt.Errorf("window %q: %w", w.Name, err)
+		}
+		if err := validatePatterns(w.Repos); err != nil {
+			return fmt.Errorf("window %q: %w", w.Name, err)
+		}
+		if err := validateGlobs(w.Branches); err != nil {
+			return fmt.Errorf("window %q: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s FreezeSettings) overrideLabel() string {
+	if s.OverrideLabel != "" {
+		return s.OverrideLabel
+	}
+	return "emergency-merge"
+}
+
+// active returns the freeze the window imposes at now, if any.
+func (w FreezeWindow) active(now time.Time) (*Freeze, error) {
+	loc := time.UTC
+	if w.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(w.TimeZone); err != nil {
+			return nil, err
+		}
+	}
+	freeze := &Freeze{ID: "window:" + w.Name, Name: w.Name, Reason: w.Reason, Repos: w.Repos, Branches: w.Branches}
+
+	switch {
+	case w.Schedule != "" && (w.From != "" || w.To != ""):
+		return nil, fmt.Errorf("set either schedule or from and to, not both")
+	case w.Schedule != "":
+		schedule, err := parseSchedule(w.Schedule, w.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("a schedule needs a positive duration")
+		}
+		// The latest start within one duration of now, if any
+		start := schedule.Next(now.Add(-duration))
+		if start.After(now) {
+			return nil, nil
+		}
+		freeze.StartedAt, freeze.Until = start, start.Add(duration)
+	case w.From != "" && w.To != "":
+		from, err := parseFreezeTime(w.From, loc)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseFreezeTime(w.To, loc)
+		if err != nil {
+			return nil, err
+		}
+		if !to.After(from) {
+			return nil, fmt.Errorf("to must be after from")
+		}
+		if now.Before(from) || !now.Before(to) {
+			return nil, nil
+		}
+		freeze.StartedAt, freeze.Until = from, to
+	default:
+		return nil, fmt.Errorf("needs a schedule and duration, or from and to")
+	}
+	return freeze, nil
+}
+
+func parseFreezeTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// Freeze is a freeze in effect, from a window or started ad hoc. A zero
+// Until lasts until it is stopped.
+type Freeze struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Repos     []string  `json:"repos,omitempty"`
+	Branches  []string  `json:"branches,omitempty"`
+	StartedBy string    `json:"started_by,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Until     time.Time `json:"until,omitempty"`
+}
+
+func (f Freeze) covers(repository, base string) bool {
+	if len(f.Repos) > 0 && !matchesAny(f.Repos, repository) {
+		return false
+	}
+	return len(f.Branches) == 0 || matchesAnyGlob(f.Branches, base)
+}
+
+func (f Freeze) reason() string {
+	switch {
+	case f.Reason != "":
+		return "merge freeze: " + f.Reason
+	case f.Name != "":
+		return "merge freeze: " + f.Name
+	}
+	return "merge freeze"
+}
+
+// Freeze audit actions.
+const (
+	FreezeStarted    = "started"
+	FreezeStopped    = "stopped"
+	FreezeOverridden = "overridden"
+)
+
+// FreezeAuditEntry records who started, stopped or overrode a freeze.
+type FreezeAuditEntry struct {
+	At         time.Time `json:"at"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor,omitempty"`
+	FreezeID   string    `json:"freeze_id"`
+	Repository string    `json:"repository,omitempty"`
+	PRNumber   int       `json:"pr_number,omitempty"`
+}
+
+const (
+	freezesStoreName = "freezes"
+	freezeAuditLimit = 1000
+)
+
+// FreezeLog holds ad-hoc freezes and the audit log.
+type FreezeLog struct {
+	mu    sync.Mutex
+	store *Store
+	state freezeState
+	wake  chan struct{}
+}
+
+type freezeState struct {
+	AdHoc []Freeze           `json:"ad_hoc"`
+	Audit []FreezeAuditEntry `json:"audit"`
+}
+
+func NewFreezeLog(store *Store) *FreezeLog {
+	fl := &FreezeLog{store: store, wake: make(chan struct{}, 1)}
+	if err := store.Load(freezesStoreName, &fl.state); err != nil {
+		log.Printf("Failed to load freezes: %v", err)
+	}
+	return fl
+}
+
+// Start begins an ad-hoc freeze and returns it with its ID.
+func (fl *FreezeLog) Start(freeze Freeze) (Freeze, error) {
+	id, err := newEventID()
+	if err != nil {
+		return Freeze{}, err
+	}
+	freeze.ID = id
+
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.pruneLocked(freeze.StartedAt)
+	fl.state.AdHoc = append(fl.state.AdHoc, freeze)
+	fl.auditLocked(FreezeAuditEntry{At: freeze.StartedAt, Action: FreezeStarted, Actor: freeze.StartedBy, FreezeID: id})
+	fl.notify()
+	return freeze, nil
+}
+
+// Stop ends an ad-hoc freeze. It reports whether the freeze existed.
+func (fl *FreezeLog) Stop(id, actor string, now time.Time) bool {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	for i, freeze := range fl.state.AdHoc {
+		if freeze.ID == id {
+			fl.state.AdHoc = append(fl.state.AdHoc[:i], fl.state.AdHoc[i+1:]...)
+			fl.auditLocked(FreezeAuditEntry{At: now, Action: FreezeStopped, Actor: actor, FreezeID: id})
+			fl.notify()
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns the ad-hoc freezes in effect at now, forgetting those that
+// have ended.
+func (fl *FreezeLog) Active(now time.Time) []Freeze {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	if fl.pruneLocked(now) {
+		fl.saveLocked()
+	}
+	return append([]Freeze(nil), fl.state.AdHoc...)
+}
+
+// pruneLocked drops the ad-hoc freezes that ended before now and reports
+// whether there were any.
+func (fl *FreezeLog) pruneLocked(now time.Time) bool {
+	var active []Freeze
+	for _, freeze := range fl.state.AdHoc {
+		if freeze.Until.IsZero() || now.Before(freeze.Until) {
+			active = append(active, freeze)
+		}
+	}
+	pruned := len(active) != len(fl.state.AdHoc)
+	fl.state.AdHoc = active
+	return pruned
+}
+
+// Record adds an entry to the audit log.
+func (fl *FreezeLog) Record(entry FreezeAuditEntry) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.auditLocked(entry)
+}
+
+// RecordOverride audits entry, an override of freeze, unless the same PR
+// was already recorded overriding it since it started.
+func (fl *FreezeLog) RecordOverride(entry FreezeAuditEntry, freeze Freeze) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	for _, e := range fl.state.Audit {
+		if e.Action == FreezeOverridden && e.FreezeID == freeze.ID && e.Repository == entry.Repository &&
+			e.PRNumber == entry.PRNumber && !e.At.Before(freeze.StartedAt) {
+			return
+		}
+	}
+	fl.auditLocked(entry)
+}
+
+// Audit returns the audit log, oldest first.
+func (fl *FreezeLog) Audit() []FreezeAuditEntry {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	return append([]FreezeAuditEntry(nil), fl.state.Audit...)
+}
+
+func (fl *FreezeLog) auditLocked(entry FreezeAuditEntry) {
+	entry.At = entry.At.UTC()
+	fl.state.Audit = append(fl.state.Audit, entry)
+	if len(fl.state.Audit) > freezeAuditLimit {
+		fl.state.Audit = fl.state.Audit[len(fl.state.Audit)-freezeAuditLimit:]
+	}
+	fl.saveLocked()
+}
+
+func (fl *FreezeLog) saveLocked() {
+	if err := fl.store.Save(freezesStoreName, fl.state); err != nil {
+		log.Printf("Failed to persist freezes: %v", err)
+	}
+}
+
+func (fl *FreezeLog) notify() {
+	select {
+	case fl.wake <- struct{}{}:
+	default:
+	}
+}
+
+// activeFreezes returns every freeze in effect at now.
+func (rb *ReviewBot) activeFreezes(now time.Time) []Freeze {
+	var active []Freeze
+	for _, w := range rb.config.Settings.Freeze.Windows {
+		freeze, err := w.active(now)
+		if err != nil {
+			log.Printf("Freeze window %q: %v", w.Name, err)
+			continue
+		}
+		if freeze != nil {
+			active = append(active, *freeze)
+		}
+	}
+	return append(active, rb.freezes.Active(now)...)
+}
+
+// freezeFor returns the freeze covering PRs to base in repository at now.
+func (rb *ReviewBot) freezeFor(repository, base string, now time.Time) (Freeze, bool) {
+	for _, freeze := range rb.activeFreezes(now) {
+		if freeze.covers(repository, base) {
+			return freeze, true
+		}
+	}
+	return Freeze{}, false
+}
+
+// frozen reports whether pr may not merge because of a freeze, honouring
+// the override label. A label added before the freeze started is audited,
+// without an actor, the first time it lets the PR through.
+func (rb *ReviewBot) frozen(repository string, pr *github.PullRequest, now time.Time) (Freeze, bool) {
+	freeze, ok := rb.freezeFor(repository, pr.GetBase().GetRef(), now)
+	if !ok {
+		return Freeze{}, false
+	}
+	if hasLabel(pr.Labels, rb.config.Settings.Freeze.overrideLabel()) {
+		rb.freezes.RecordOverride(FreezeAuditEntry{
+			At:         now,
+			Action:     FreezeOverridden,
+			FreezeID:   freeze.ID,
+			Repository: repository,
+			PRNumber:   pr.GetNumber(),
+		}, freeze)
+		return Freeze{}, false
+	}
+	return freeze, true
+}
+
+// handleFreezeOverride audits the override label being added to a frozen
+// PR and lets it through. Like the auto-merge label it needs write access;
+// otherwise it is taken off again, whether or not a freeze is in effect, so
+// it can't be left waiting for the next one.
+func (rb *ReviewBot) handleFreezeOverride(ctx context.Context, owner, repo string, pr *github.PullRequest, actor string) {
+	label := rb.config.Settings.Freeze.overrideLabel()
+	allowed, err := rb.canWrite(ctx, owner, repo, actor)
+	if err != nil {
+		log.Printf("Failed to check permissions of %s on %s/%s: %v", actor, owner, repo, err)
+		return
+	}
+	if !allowed {
+		if _, err := rb.client.Issues.RemoveLabelForIssue(ctx, owner, repo, pr.GetNumber(), label); err != nil && !isNotFound(err) {
+			log.Printf("Failed to remove %s label from %s/%s#%d: %v", label, owner, repo, pr.GetNumber(), err)
+		}
+		body := fmt.Sprintf("@%s only users with write access can override a merge freeze; the `%s` label was removed.", actor, label)
+		if _, _, err := rb.client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), &github.IssueComment{Body: github.String(body)}); err != nil {
+			log.Printf("Failed to comment on %s/%s#%d: %v", owner, repo, pr.GetNumber(), err)
+		}
+		return
+	}
+
+	freeze, ok := rb.freezeFor(owner+"/"+repo, pr.GetBase().GetRef(), time.Now())
+	if !ok {
+		return
+	}
+	rb.freezes.Record(FreezeAuditEntry{
+		At:         time.Now(),
+		Action:     FreezeOverridden,
+		Actor:      actor,
+		FreezeID:   freeze.ID,
+		Repository: owner + "/" + repo,
+		PRNumber:   pr.GetNumber(),
+	})
+	log.Printf("%s overrode freeze %s on %s/%s#%d", actor, freeze.ID, owner, repo, pr.GetNumber())
+	rb.reevaluate(ctx, owner, repo, pr)
+}
+
+// watchFreezes re-evaluates open PRs whenever a freeze starts or ends so
+// their status follows it.
+func (rb *ReviewBot) watchFreezes(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	last := freezeKey(rb.activeFreezes(time.Now()))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-rb.freezes.wake:
+		}
+		if key := freezeKey(rb.activeFreezes(time.Now())); key != last {
+			last = key
+			rb.reevaluateOpenPRs(ctx)
+		}
+	}
+}
+
+func freezeKey(freezes []Freeze) string {
+	ids := make([]string, len(freezes))
+	for i, freeze := range freezes {
+		ids[i] = freeze.ID + "@" + freeze.StartedAt.String()
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func (rb *ReviewBot) reevaluateOpenPRs(ctx context.Context) {
+	for _, eval := range rb.evaluations.List() {
+		if eval.State != PROpen {
+			continue
+		}
+		owner, repo, _ := strings.Cut(eval.Repository, "/")
+		pr, _, err := rb.client.PullRequests.Get(ctx, owner, repo, eval.PRNumber)
+		if err != nil {
+			log.Printf("Failed to get %s#%d: %v", eval.Repository, eval.PRNumber, err)
+			continue
+		}
+		if pr.GetState() == "open" {
+			rb.reevaluate(ctx, owner, repo, pr)
+		}
+	}
+}
+
+// handleFreezes lists the freezes in effect and the configured windows.
+func (rb *ReviewBot) handleFreezes(w http.ResponseWriter, r *http.Request) {
+	active := rb.activeFreezes(time.Now())
+	if active == nil {
+		active = []Freeze{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active":         active,
+		"windows":        rb.config.Settings.Freeze.Windows,
+		"override_label": rb.config.Settings.Freeze.overrideLabel(),
+	})
+}
+
+// FreezeRequest starts an ad-hoc freeze. Duration (e.g. "4h") or Until
+// (RFC 3339) end it automatically; otherwise it lasts until stopped.
+type FreezeRequest struct {
+	Reason   string   `json:"reason"`
+	Repos    []string `json:"repos"`
+	Branches []string `json:"branches"`
+	Duration string   `json:"duration"`
+	Until    string   `json:"until"`
+	By       string   `json:"by"`
+}
+
+func (rb *ReviewBot) handleStartFreeze(w http.ResponseWriter, r *http.Request) {
+	var req FreezeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid freeze request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePatterns(req.Repos); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateGlobs(req.Branches); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	freeze := Freeze{Reason: req.Reason, Repos: req.Repos, Branches: req.Branches, StartedBy: req.By, StartedAt: now}
+	switch {
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid duration", http.StatusBadRequest)
+			return
+		}
+		freeze.Until = now.Add(d)
+	case req.Until != "":
+		until, err := time.Parse(time.RFC3339, req.Until)
+		if err != nil || !until.After(now) {
+			http.Error(w, "Invalid until; expected a future RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		freeze.Until = until
+	}
+
+	freeze, err := rb.freezes.Start(freeze)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Merge freeze %s started by %q: %s", freeze.ID, req.By, freeze.reason())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(freeze)
+}
+
+func (rb *ReviewBot) handleStopFreeze(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !rb.freezes.Stop(id, r.URL.Query().Get("by"), time.Now()) {
+		http.Error(w, "No such freeze", http.StatusNotFound)
+		return
+	}
+	log.Printf("Merge freeze %s stopped", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rb *ReviewBot) handleFreezeAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rb.freezes.Audit())
+}
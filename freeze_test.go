@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/gorilla/mux"
+)
+
+func TestFreezeWindowActive(t *testing.T) {
+	weekend := FreezeWindow{Name: "weekend", Schedule: "0 18 * * FRI", Duration: "62h"}
+	for _, tc := range []struct {
+		at     time.Time
+		active bool
+	}{
+		{time.Date(2024, 3, 1, 17, 59, 0, 0, time.UTC), false}, // Friday
+		{time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC), true}, // Sunday
+		{time.Date(2024, 3, 4, 7, 59, 0, 0, time.UTC), true}, // Monday
+		{time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC), false},
+		{time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC), false}, // Wednesday
+	} {
+		freeze, err := weekend.active(tc.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (freeze != nil) != tc.active {
+			t.Errorf("At %v expected active=%v, got %+v", tc.at, tc.active, freeze)
+		}
+		if freeze != nil && !freeze.Until.Equal(time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)) {
+			t.Errorf("Expected the freeze to last until Monday 08:00, got %v", freeze.Until)
+		}
+	}
+
+	release := FreezeWindow{Name: "release", From: "2024-03-10", To: "2024-03-12 12:00", TimeZone: "UTC", Reason: "1.4 release"}
+	if freeze, _ := release.active(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)); freeze == nil || freeze.reason() != "merge freeze: 1.4 release" {
+		t.Errorf("Expected the release freeze, got %+v", freeze)
+	}
+	if freeze, _ := release.active(time.Date(2024, 3, 12, 12, 0, 0, 0, time.UTC)); freeze != nil {
+		t.Errorf("Expected the release freeze to be over, got %+v", freeze)
+	}
+
+	for _, settings := range []FreezeSettings{
+		{Windows: []FreezeWindow{{Schedule: "@daily", Duration: "1h"}}},
+		{Windows: []FreezeWindow{{Name: "a", Schedule: "@daily"}}},
+		{Windows: []FreezeWindow{{Name: "a", Schedule: "@daily", Duration: "1h", From: "2024-01-01"}}},
+		{Windows: []FreezeWindow{{Name: "a", From: "2024-01-02", To: "2024-01-01"}}},
+		{Windows: []FreezeWindow{{Name: "a", From: "soon", To: "2024-01-01"}}},
+		{Windows: []FreezeWindow{{Name: "a", From: "2024-01-01", To: "2024-01-02", TimeZone: "Mars/Olympus"}}},
+	} {
+		if err := settings.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", settings.Windows)
+		}
+	}
+}
+
+func TestFreezeBlocksMergeUnlessOverridden(t *testing.T) {
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		State:  github.String("open"),
+		Head:   &github.PullRequestBranch{SHA: github.String("abc")},
+		Base:   &github.PullRequestBranch{Ref: github.String("release/1.4")},
+	}
+	var statuses []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(pr)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.PullRequestReview{review("alice", "APPROVED"), review("bob", "APPROVED")})
+	})
+	mux.HandleFunc("/repos/o/r/statuses/abc", func(w http.ResponseWriter, r *http.Request) {
+		var status github.RepoStatus
+		json.NewDecoder(r.Body).Decode(&status)
+		statuses = append(statuses, status.GetState()+": "+status.GetDescription())
+		json.NewEncoder(w).Encode(&status)
+	})
+	var comments, removed []string
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`[]`))
+			return
+		}
+		var comment github.IssueComment
+		json.NewDecoder(r.Body).Decode(&comment)
+		comments = append(comments, comment.GetBody())
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/repos/o/r/collaborators/", func(w http.ResponseWriter, r *http.Request) {
+		permission := "triage"
+		if strings.Contains(r.URL.Path, "/oncall/") {
+			permission = "maintain"
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryPermissionLevel{Permission: github.String(permission)})
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels/", func(w http.ResponseWriter, r *http.Request) {
+		removed = append(removed, strings.TrimPrefix(r.URL.Path, "/repos/o/r/issues/1/labels/"))
+		pr.Labels = nil
+		w.Write([]byte(`[]`))
+	})
+
+	bot := newTestBot(t, mux)
+	store := NewStore(t.TempDir())
+	bot.evaluations = NewEvaluationStore(store)
+	bot.freezes = NewFreezeLog(store)
+	freeze, err := bot.freezes.Start(Freeze{Reason: "1.4 release", Repos: []string{"o/*"}, Branches: []string{"release/**"}, StartedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if verdict := bot.checkMergePolicy(context.Background(), "o", "r", 1); verdict.CanMerge || verdict.Reason != "merge freeze: 1.4 release" {
+		t.Errorf("Expected the freeze to block merging, got %+v", verdict)
+	}
+	if _, frozen := bot.freezeFor("o/r", "main", time.Now()); frozen {
+		t.Error("Expected main to be outside the freeze")
+	}
+
+	// Triagers can label but not override
+	pr.Labels = []*github.Label{{Name: github.String("emergency-merge")}}
+	bot.handleFreezeOverride(context.Background(), "o", "r", pr, "triager")
+	if len(statuses) != 0 || len(removed) != 1 || removed[0] != "emergency-merge" || len(comments) != 1 || !strings.Contains(comments[0], "only users with write access") {
+		t.Errorf("Expected the label to be removed, got statuses %v removed %v comments %v", statuses, removed, comments)
+	}
+	if audit := bot.freezes.Audit(); len(audit) != 1 {
+		t.Errorf("Expected no override in the audit log, got %+v", audit)
+	}
+
+	pr.Labels = []*github.Label{{Name: github.String("emergency-merge")}}
+	bot.handleFreezeOverride(context.Background(), "o", "r", pr, "oncall")
+	if len(statuses) != 1 || statuses[0] != "success: All checks passed - ready to merge" {
+		t.Errorf("Expected the override to let the PR through, got %v", statuses)
+	}
+	audit := bot.freezes.Audit()
+	if len(audit) != 2 || audit[1].Action != FreezeOverridden || audit[1].Actor != "oncall" || audit[1].FreezeID != freeze.ID || audit[1].PRNumber != 1 {
+		t.Errorf("Expected the override to be audited, got %+v", audit)
+	}
+
+	// A label left over from an earlier freeze is audited once per freeze
+	bot.freezes.Stop(freeze.ID, "alice", time.Now())
+	next, err := bot.freezes.Start(Freeze{Reason: "1.5 release", StartedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if verdict := bot.checkMergePolicy(context.Background(), "o", "r", 1); !verdict.CanMerge {
+			t.Errorf("Expected the override label to let the PR through, got %+v", verdict)
+		}
+	}
+	audit = bot.freezes.Audit()
+	if len(audit) != 5 || audit[4].Action != FreezeOverridden || audit[4].Actor != "" || audit[4].FreezeID != next.ID || audit[4].PRNumber != 1 {
+		t.Errorf("Expected the carried-over override to be audited once, got %+v", audit)
+	}
+}
+
+func TestFreezeLogPrunesEnded(t *testing.T) {
+	store := NewStore(t.TempDir())
+	fl := NewFreezeLog(store)
+	now := time.Now()
+	ended, _ := fl.Start(Freeze{Reason: "incident", StartedAt: now, Until: now.Add(time.Hour)})
+	open, _ := fl.Start(Freeze{Reason: "release", StartedAt: now})
+
+	if active := fl.Active(now.Add(2 * time.Hour)); len(active) != 1 || active[0].ID != open.ID {
+		t.Errorf("Expected only the open-ended freeze to be active, got %+v", active)
+	}
+	if adHoc := NewFreezeLog(store).state.AdHoc; len(adHoc) != 1 || adHoc[0].ID != open.ID {
+		t.Errorf("Expected %s to be forgotten, got %+v", ended.ID, adHoc)
+	}
+}
+
+func TestFreezeAPI(t *testing.T) {
+	bot := newTestBot(t, http.NewServeMux())
+	bot.freezes = NewFreezeLog(NewStore(t.TempDir()))
+	bot.config.AdminToken = "admin"
+
+	r := mux.NewRouter()
+	r.HandleFunc("/freezes", bot.handleFreezes).Methods("GET")
+	r.HandleFunc("/admin/freezes", bot.requireAdmin(bot.handleStartFreeze)).Methods("POST")
+	r.HandleFunc("/admin/freezes/audit", bot.requireAdmin(bot.handleFreezeAudit)).Methods("GET")
+	r.HandleFunc("/admin/freezes/{id}", bot.requireAdmin(bot.handleStopFreeze)).Methods("DELETE")
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer admin")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("POST", "/admin/freezes", `{"reason":"incident","duration":"soon"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a bad duration to be rejected, got %d", rr.Code)
+	}
+	rr := do("POST", "/admin/freezes", `{"reason":"incident","repos":["o/r"],"duration":"2h","by":"alice"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	var started Freeze
+	json.NewDecoder(rr.Body).Decode(&started)
+	if started.ID == "" || started.Until.Sub(started.StartedAt) != 2*time.Hour {
+		t.Errorf("Expected a two hour freeze, got %+v", started)
+	}
+
+	var listed struct {
+		Active []Freeze `json:"active"`
+	}
+	json.NewDecoder(do("GET", "/freezes", "").Body).Decode(&listed)
+	if len(listed.Active) != 1 || listed.Active[0].ID != started.ID {
+		t.Errorf("Expected the freeze to be listed, got %+v", listed.Active)
+	}
+
+	if rr := do("DELETE", "/admin/freezes/"+started.ID+"?by=bob", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if rr := do("DELETE", "/admin/freezes/"+started.ID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected a second stop to 404, got %d", rr.Code)
+	}
+
+	var audit []FreezeAuditEntry
+	json.NewDecoder(do("GET", "/admin/freezes/audit", "").Body).Decode(&audit)
+	if len(audit) != 2 || audit[0].Action != FreezeStarted || audit[0].Actor != "alice" || audit[1].Action != FreezeStopped || audit[1].Actor != "bob" {
+		t.Errorf("Expected start and stop in the audit log, got %+v", audit)
+	}
+}
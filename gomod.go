@@ -0,0 +1,72 @@
+package main
+
+import "golang.org/x/mod/modfile"
+
+// GoMod is the subset of a go.mod file the checks care about.
+type GoMod struct {
+	Module    string
+	Go        string
+	Toolchain string
+	Requires  []ModRequire
+	Replaces  []ModReplace
+}
+
+type ModRequire struct {
+	Path     string
+	Version  string
+	Indirect bool
+	Line     int
+}
+
+// ModReplace is a replace directive. NewVersion is empty when New is a
+// local directory.
+type ModReplace struct {
+	Old        string
+	OldVersion string
+	New        string
+	NewVersion string
+	Line       int
+}
+
+// isLocal reports whether the replacement points at a directory rather than
+// a module version.
+func (r ModReplace) isLocal() bool {
+	return r.NewVersion == "" && modfile.IsDirectoryPath(r.New)
+}
+
+// parseGoMod parses the module, go, toolchain, require and replace
+// directives of a go.mod file.
+func parseGoMod(data []byte) (*GoMod, error) {
+	file, err := modfile.Parse("go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	mod := &GoMod{}
+	if file.Module != nil {
+		mod.Module = file.Module.Mod.Path
+	}
+	if file.Go != nil {
+		mod.Go = file.Go.Version
+	}
+	if file.Toolchain != nil {
+		mod.Toolchain = file.Toolchain.Name
+	}
+	for _, r := range file.Require {
+		mod.Requires = append(mod.Requires, ModRequire{
+			Path:     r.Mod.Path,
+			Version:  r.Mod.Version,
+			Indirect: r.Indirect,
+			Line:     r.Syntax.Start.Line,
+		})
+	}
+	for _, r := range file.Replace {
+		mod.Replaces = append(mod.Replaces, ModReplace{
+			Old:        r.Old.Path,
+			OldVersion: r.Old.Version,
+			New:        r.New.Path,
+			NewVersion: r.New.Version,
+			Line:       r.Syntax.Start.Line,
+		})
+	}
+	return mod, nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// maxFailureLines caps the output kept for each failed test or package.
+const maxFailureLines = 20
+
+// testEvent is one line of `go test -json` output (see `go doc test2json`).
+type testEvent struct {
+	Action      string
+	Package     string
+	Test        string
+	Output      string
+	Elapsed     float64
+	ImportPath  string
+	FailedBuild string
+}
+
+// TestFailure is a failed test, or a package that failed outside any test
+// (a build error or a panic in TestMain), in which case Test is empty.
+type TestFailure struct {
+	Test   string   `json:"test,omitempty"`
+	Output []string `json:"output,omitempty"`
+}
+
+// PackageResult summarises one package in a `go test -json` run. Status is
+// pass, fail or skip.
+type PackageResult struct {
+	Package  string        `json:"package"`
+	Status   string        `json:"status"`
+	Elapsed  float64       `json:"elapsed"`
+	Failures []TestFailure `json:"failures,omitempty"`
+}
+
+// parseTestJSON reads `go test -json` output and returns per-package results
+// in the order the packages finished. Lines that aren't JSON (build errors
+// from older toolchains) are returned separately.
+func parseTestJSON(r io.Reader) ([]PackageResult, []string, error) {
+	var (
+		results   []PackageResult
+		other     []string
+		testOut   = make(map[string][]string)
+		pkgOut    = make(map[string][]string)
+		buildOut  = make(map[string][]string)
+		failed    = make(map[string][]TestFailure)
+		finalized = make(map[string]bool)
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var event testEvent
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &event) != nil {
+			if text := strings.TrimSpace(string(line)); text != "" {
+				other = append(other, text)
+			}
+			continue
+		}
+
+		key := event.Package + "\x00" + event.Test
+		switch event.Action {
+		case "build-output":
+			buildOut[event.ImportPath] = appendOutput(buildOut[event.ImportPath], event.Output)
+		case "output":
+			if event.Test != "" {
+				testOut[key] = appendOutput(testOut[key], event.Output)
+			} else {
+				pkgOut[event.Package] = appendOutput(pkgOut[event.Package], event.Output)
+			}
+		case "pass", "fail", "skip":
+			if event.Test != "" {
+				if event.Action == "fail" {
+					failed[event.Package] = append(failed[event.Package], TestFailure{Test: event.Test, Output: testFailureLines(testOut[key])})
+				}
+				delete(testOut, key)
+				continue
+			}
+			if finalized[event.Package] {
+				continue
+			}
+			finalized[event.Package] = true
+
+			result := PackageResult{Package: event.Package, Status: event.Action, Elapsed: event.Elapsed, Failures: failed[event.Package]}
+			if event.Action == "fail" && len(result.Failures) == 0 {
+				output := pkgOut[event.Package]
+				if event.FailedBuild != "" {
+					output = buildOut[event.FailedBuild]
+				}
+				result.Failures = []TestFailure{{Output: testFailureLines(output)}}
+			}
+			results = append(results, result)
+		}
+	}
+	return results, other, scanner.Err()
+}
+
+func appendOutput(lines []string, output string) []string {
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return lines
+	}
+	return append(lines, output)
+}
+
+// testFailureLines drops go test's own framing ("=== RUN", "--- FAIL",
+// "FAIL", "ok") and keeps at most maxFailureLines of what remains.
+func testFailureLines(lines []string) []string {
+	var kept []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "FAIL" || trimmed == "PASS" ||
+			strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") ||
+			strings.HasPrefix(trimmed, "FAIL\t") || strings.HasPrefix(trimmed, "ok  \t") ||
+			strings.HasPrefix(trimmed, "exit status ") {
+			continue
+		}
+		if len(kept) == maxFailureLines {
+			kept = append(kept, "...")
+			break
+		}
+		kept = append(kept, trimmed)
+	}
+	return kept
+}
+
+// affectedPackages maps each Go module in the workspace touched by the PR to
+// the package patterns (relative to the module root) to test. A changed
+// go.mod or go.sum means the whole module is retested.
+func affectedPackages(root string, files []*github.CommitFile) map[string][]string {
+	patterns := make(map[string]map[string]bool)
+	add := func(module, pattern string) {
+		if patterns[module] == nil {
+			patterns[module] = make(map[string]bool)
+		}
+		patterns[module][pattern] = true
+	}
+
+	for _, file := range files {
+		name := file.GetFilename()
+		if isVendored(name) && path.Base(name) != "go.sum" {
+			continue
+		}
+		dir := path.Dir(name)
+		module, ok := moduleRoot(root, dir)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case path.Base(name) == "go.mod" || path.Base(name) == "go.sum":
+			add(module, "./...")
+		case strings.HasSuffix(name, ".go") && !strings.Contains("/"+dir+"/", "/testdata/"):
+			if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(dir))); err != nil || !info.IsDir() {
+				continue // the package was deleted
+			}
+			pattern := "."
+			switch {
+			case dir == module:
+			case module == ".":
+				pattern = "./" + dir
+			default:
+				pattern = "./" + strings.TrimPrefix(dir, module+"/")
+			}
+			add(module, pattern)
+		}
+	}
+
+	result := make(map[string][]string)
+	for module, set := range patterns {
+		if set["./..."] {
+			result[module] = []string{"./..."}
+			continue
+		}
+		for pattern := range set {
+			result[module] = append(result[module], pattern)
+		}
+		sort.Strings(result[module])
+	}
+	return result
+}
+
+// sortedModules returns the module directories of affectedPackages' result
+// in a stable order.
+func sortedModules(modules map[string][]string) []string {
+	dirs := make([]string, 0, len(modules))
+	for module := range modules {
+		dirs = append(dirs, module)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// moduleRoot returns the nearest directory at or above dir (slash-separated,
+// relative to root) that contains a go.mod.
+func moduleRoot(root, dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(dir), "go.mod")); err == nil {
+			return dir, true
+		}
+		if dir == "." || dir == "/" {
+			return "", false
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// runGoTestCheck runs `go test -json` for the packages the PR touches in a
+// sandboxed checkout of its head commit.
+func (rb *ReviewBot) runGoTestCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	settings := rb.config.Settings.Executor
+
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return CheckResult{
+			Name:    "test",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get PR files: %v", err),
+		}
+	}
+
+	ws, err := rb.checkoutWorkspace(ctx, owner, repo, pr.GetHead().GetSHA())
+	if err != nil {
+		return CheckResult{
+			Name:    "test",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to check out %s: %v", shortSHA(pr.GetHead().GetSHA()), err),
+		}
+	}
+	defer ws.Close()
+
+	modules := affectedPackages(ws.Dir, files)
+	if len(modules) == 0 {
+		return CheckResult{
+			Name:    "test",
+			Status:  "skipped",
+			Message: "No Go packages affected by this PR",
+		}
+	}
+	args := []string{"test", "-json"}
+	if settings.CPUs > 0 {
+		args = append(args, fmt.Sprintf("-p=%d", settings.CPUs))
+	}
+
+	var results []PackageResult
+	var details []string
+	for _, module := range sortedModules(modules) {
+		dir := filepath.Join(ws.Dir, filepath.FromSlash(module))
+		out, err := runSandboxed(ctx, ws, settings, dir, "go", append(args, modules[module]...)...)
+		if err != nil {
+			return CheckResult{
+				Name:    "test",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to run go test: %v", err),
+			}
+		}
+		if out.TimedOut {
+			return CheckResult{
+				Name:    "test",
+				Status:  "error",
+				Message: fmt.Sprintf("go test timed out after %s", settings.timeout()),
+			}
+		}
+
+		pkgs, other, err := parseTestJSON(bytes.NewReader(out.Stdout))
+		if err != nil {
+			return CheckResult{
+				Name:    "test",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to parse go test output: %v", err),
+			}
+		}
+		results = append(results, pkgs...)
+
+		// go test failing without reporting any package means it never got
+		// as far as running one (a bad go.mod, a resource limit, ...).
+		if out.ExitCode != 0 && !anyFailed(pkgs) {
+			output := testFailureLines(append(other, strings.Split(string(out.Stderr), "\n")...))
+			details = append(details, fmt.Sprintf("`%s`: go test exited with status %d: %s", module, out.ExitCode, strings.Join(output, " / ")))
+		}
+	}
+
+	passed, skipped, failedPkgs := 0, 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case "pass":
+			passed++
+		case "skip":
+			skipped++
+		case "fail":
+			failedPkgs++
+			for _, failure := range result.Failures {
+				details = append(details, testFailureDetail(result.Package, failure))
+			}
+		}
+	}
+
+	if failedPkgs > 0 || len(details) > 0 {
+		return CheckResult{
+			Name:    "test",
+			Status:  "failure",
+			Message: fmt.Sprintf("%d of %d packages failed", failedPkgs, len(results)),
+			Details: capDetails(details, maxCheckDetails),
+		}
+	}
+	message := fmt.Sprintf("%d packages passed", passed)
+	if skipped > 0 {
+		message += fmt.Sprintf(" (%d without tests)", skipped)
+	}
+	return CheckResult{
+		Name:    "test",
+		Status:  "success",
+		Message: message,
+	}
+}
+
+func anyFailed(results []PackageResult) bool {
+	for _, result := range results {
+		if result.Status == "fail" {
+			return true
+		}
+	}
+	return false
+}
+
+func testFailureDetail(pkg string, failure TestFailure) string {
+	what := "build or setup failed"
+	if failure.Test != "" {
+		what = failure.Test + " failed"
+	}
+	if len(failure.Output) == 0 {
+		return fmt.Sprintf("`%s` %s", pkg, what)
+	}
+	return fmt.Sprintf("`%s` %s: %s", pkg, what, strings.Join(failure.Output, " / "))
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestParseTestJSON(t *testing.T) {
+	output := strings.Join([]string{
+		`{"Action":"start","Package":"example.com/m/a"}`,
+		`{"Action":"run","Package":"example.com/m/a","Test":"TestOK"}`,
+		`{"Action":"output","Package":"example.com/m/a","Test":"TestOK","Output":"=== RUN   TestOK\n"}`,
+		`{"Action":"pass","Package":"example.com/m/a","Test":"TestOK","Elapsed":0}`,
+		`{"Action":"run","Package":"example.com/m/a","Test":"TestBad"}`,
+		`{"Action":"output","Package":"example.com/m/a","Test":"TestBad","Output":"=== RUN   TestBad\n"}`,
+		`{"Action":"output","Package":"example.com/m/a","Test":"TestBad","Output":"    a_test.go:9: got 1, want 2\n"}`,
+		`{"Action":"output","Package":"example.com/m/a","Test":"TestBad","Output":"--- FAIL: TestBad (0.00s)\n"}`,
+		`{"Action":"fail","Package":"example.com/m/a","Test":"TestBad","Elapsed":0}`,
+		`{"Action":"fail","Package":"example.com/m/a","Elapsed":0.01}`,
+		`{"ImportPath":"example.com/m/b [example.com/m/b.test]","Action":"build-output","Output":"b/b.go:3:1: syntax error\n"}`,
+		`{"ImportPath":"example.com/m/b [example.com/m/b.test]","Action":"build-fail"}`,
+		`{"Action":"fail","Package":"example.com/m/b","Elapsed":0,"FailedBuild":"example.com/m/b [example.com/m/b.test]"}`,
+		`{"Action":"skip","Package":"example.com/m/c","Elapsed":0}`,
+		`go: downloading example.com/dep v1.0.0`,
+	}, "\n")
+
+	results, other, err := parseTestJSON(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PackageResult{
+		{Package: "example.com/m/a", Status: "fail", Elapsed: 0.01, Failures: []TestFailure{{Test: "TestBad", Output: []string{"a_test.go:9: got 1, want 2"}}}},
+		{Package: "example.com/m/b", Status: "fail", Failures: []TestFailure{{Output: []string{"b/b.go:3:1: syntax error"}}}},
+		{Package: "example.com/m/c", Status: "skip"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Expected %+v, got %+v", want, results)
+	}
+	if len(other) != 1 {
+		t.Errorf("Expected the non-JSON line to be kept, got %v", other)
+	}
+}
+
+func TestAffectedPackages(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"go.mod", "a/a.go", "tools/go.mod", "tools/gen/gen.go", "docs/x.md"} {
+		writeFile(t, filepath.Join(root, name), "")
+	}
+	files := []*github.CommitFile{
+		{Filename: github.String("main.go")},
+		{Filename: github.String("a/a_test.go")},
+		{Filename: github.String("gone/gone.go")},
+		{Filename: github.String("a/testdata/x.go")},
+		{Filename: github.String("tools/gen/gen.go")},
+		{Filename: github.String("docs/x.md")},
+	}
+	want := map[string][]string{".": {".", "./a"}, "tools": {"./gen"}}
+	if got := affectedPackages(root, files); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	files = append(files, &github.CommitFile{Filename: github.String("go.sum")})
+	if got := affectedPackages(root, files)["."]; !reflect.DeepEqual(got, []string{"./..."}) {
+		t.Errorf("Expected a go.sum change to test ./..., got %v", got)
+	}
+}
+
+func TestExtractTarRejectsEscapes(t *testing.T) {
+	archive := tarball(t, map[string]string{"prefix/ok.txt": "ok", "prefix/../../evil.txt": "bad"})
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := extractTar(gz, dest, 1, 1<<20); err == nil {
+		t.Error("Expected an error for an entry outside the workspace")
+	}
+}
+
+func TestExecutorRunAs(t *testing.T) {
+	for _, settings := range []ExecutorSettings{
+		{Enabled: true},
+		{Enabled: true, RunAs: "nobody"},
+		{Enabled: true, RunAs: "65534"},
+	} {
+		if err := settings.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", settings)
+		}
+	}
+	if err := (ExecutorSettings{Enabled: true, SameUser: true}).validate(); err != nil {
+		t.Errorf("Expected same_user to be accepted, got %v", err)
+	}
+
+	// Untrusted runs don't share caches
+	shared := &Workspace{Dir: "/work/a/src", root: "/work/a"}
+	for _, tt := range []struct {
+		settings ExecutorSettings
+		want     string
+	}{
+		{ExecutorSettings{SameUser: true, CacheDir: "/cache"}, "GOCACHE=/cache/build"},
+		{ExecutorSettings{RunAs: "65534:65534", CacheDir: "/cache"}, "GOCACHE=/work/a/cache/build"},
+	} {
+		if env := sandboxEnv(shared, tt.settings); !containsString(env, tt.want) {
+			t.Errorf("%+v: expected %s in %v", tt.settings, tt.want, env)
+		}
+	}
+
+	if os.Geteuid() != 0 {
+		t.Skip("switching users needs root")
+	}
+	root, err := os.MkdirTemp("", "review-bot-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	ws := &Workspace{Dir: filepath.Join(root, "src"), root: root}
+	if err := os.Mkdir(ws.Dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	settings := ExecutorSettings{Enabled: true, RunAs: "65534:65534", CacheDir: filepath.Join(root, "shared")}
+	if err := handOver(ws, settings); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(settings.CacheDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the shared cache to be left alone, got %v", err)
+	}
+
+	result, err := runSandboxed(context.Background(), ws, settings, ws.Dir, "/bin/sh", "-c", "id -u && touch out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 || strings.TrimSpace(string(result.Stdout)) != "65534" {
+		t.Errorf("Expected the command to run as 65534, got %d %q %q", result.ExitCode, result.Stdout, result.Stderr)
+	}
+}
+
+func TestRunGoTestCheck(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	archive := tarball(t, map[string]string{
+		"o-r-abc123/go.mod":        "module example.com/m\n\ngo 1.21\n",
+		"o-r-abc123/ok/ok.go":      "package ok\n",
+		"o-r-abc123/ok/ok_test.go": "package ok\n\nimport \"testing\"\n\nfunc TestOK(t *testing.T) {}\n",
+		"o-r-abc123/bad/bad_test.go": "package bad\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\n" +
+			"func TestNoSecrets(t *testing.T) {\n\tif os.Getenv(\"GITHUB_TOKEN\") != \"\" {\n\t\tt.Fatal(\"token leaked\")\n\t}\n}\n\n" +
+			"func TestBad(t *testing.T) {\n\tt.Fatal(\"boom\")\n}\n",
+	})
+
+	var server string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{
+			{Filename: github.String("ok/ok.go")},
+			{Filename: github.String("bad/bad_test.go")},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/tarball/abc123", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server+"codeload/o-r-abc123.tar.gz", http.StatusFound)
+	})
+	mux.HandleFunc("/codeload/o-r-abc123.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+
+	bot := newTestBot(t, mux)
+	server = bot.client.BaseURL.String()
+	bot.config.Settings.Executor = ExecutorSettings{Enabled: true, Timeout: "2m", CPUs: 2, CPUSeconds: 300, MemoryMB: 2048}
+
+	pr := &github.PullRequest{Number: github.Int(1), Head: &github.PullRequestBranch{SHA: github.String("abc123")}}
+	result := bot.runSpecificCheck(context.Background(), "o", "r", pr, "test")
+
+	if result.Status != "failure" || result.Message != "1 of 2 packages failed" {
+		t.Fatalf("Expected 1 of 2 packages to fail, got %s: %s %v", result.Status, result.Message, result.Details)
+	}
+	if want := []string{"`example.com/m/bad` TestBad failed: bad_test.go:15: boom"}; !reflect.DeepEqual(result.Details, want) {
+		t.Errorf("Expected details %v, got %v", want, result.Details)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tarball builds a gzipped tar archive of files.
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
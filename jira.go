@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Lifecycle stages at which the bot touches linked Jira issues.
+const (
+	JiraOpened     = "opened"
+	JiraMergeReady = "merge_ready"
+	JiraMerged     = "merged"
+)
+
+// JiraSettings configures the Jira integration. Transitions maps a stage
+// (opened, merge_ready, merged) to the name of the Jira status the issue
+// should be moved to; stages without an entry leave the status alone.
+type JiraSettings struct {
+	BaseURL     string            `json:"base_url"`
+	User        string            `json:"user"`
+	Token       string            `json:"token"`
+	Projects    []string          `json:"projects"`
+	Transitions map[string]string `json:"transitions"`
+}
+
+func (s JiraSettings) enabled() bool {
+	return s.BaseURL != "" && s.Token != ""
+}
+
+var jiraKeyPattern = regexp.MustCompile(`\b[A-Z][A-Z0-9_]+-[1-9][0-9]*\b`)
+
+// extractJiraKeys returns the distinct issue keys mentioned in texts, in
+// order of first appearance. Keys are matched case-sensitively, as Jira
+// writes them, so "utf-8" in prose is not a key. When projects is non-empty
+// only keys from those projects are returned, which also filters out
+// look-alikes such as "UTF-8".
+func extractJiraKeys(projects []string, texts ...string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, text := range texts {
+		for _, key := range jiraKeyPattern.FindAllString(text, -1) {
+			if seen[key] {
+				continue
+			}
+			project := key[:strings.LastIndex(key, "-")]
+			if len(projects) > 0 && !containsString(projects, project) {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// JiraClient is a minimal client for the Jira REST API v2.
+type JiraClient struct {
+	baseURL string
+	user    string
+	token   string
+	http    *http.Client
+}
+
+func NewJiraClient(settings JiraSettings) *JiraClient {
+	return &JiraClient{
+		baseURL: strings.TrimRight(settings.BaseURL, "/"),
+		user:    settings.User,
+		token:   settings.Token,
+		http: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: tracedTransport(http.DefaultTransport),
+		},
+	}
+}
+
+// JiraError is returned for non-2xx responses.
+type JiraError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *JiraError) Error() string {
+	return fmt.Sprintf("jira responded with %d: %s", e.StatusCode, e.Body)
+}
+
+func (jc *JiraClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, jc.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Jira Cloud uses e-mail + API token; Server/Data Center personal access
+	// tokens are sent as bearer tokens.
+	if jc.user != "" {
+		req.SetBasicAuth(jc.user, jc.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+jc.token)
+	}
+
+	resp, err := jc.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return &JiraError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// IssueExists reports whether key refers to an issue visible to the bot.
+func (jc *JiraClient) IssueExists(ctx context.Context, key string) (bool, error) {
+	err := jc.do(ctx, http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(key)+"?fields=status", nil, nil)
+	if jerr, ok := err.(*JiraError); ok && jerr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// AddRemoteLink links the issue to a pull request. The PR URL is used as the
+// global ID so repeated calls update the same link instead of adding more.
+func (jc *JiraClient) AddRemoteLink(ctx context.Context, key, prURL, title string) error {
+	link := map[string]interface{}{
+		"globalId": prURL,
+		"object": map[string]interface{}{
+			"url":   prURL,
+			"title": title,
+			"icon": map[string]string{
+				"url16x16": "https://github.com/favicon.ico",
+				"title":    "GitHub",
+			},
+		},
+	}
+	return jc.do(ctx, http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(key)+"/remotelink", link, nil)
+}
+
+func (jc *JiraClient) AddComment(ctx context.Context, key, body string) error {
+	return jc.do(ctx, http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(key)+"/comment", map[string]string{"body": body}, nil)
+}
+
+// TransitionTo moves the issue to the status named status using whichever
+// available transition leads there. It is a no-op if no transition does,
+// which covers issues that are already in (or past) that status.
+func (jc *JiraClient) TransitionTo(ctx context.Context, key, status string) error {
+	var available struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	path := "/rest/api/2/issue/" + url.PathEscape(key) + "/transitions"
+	if err := jc.do(ctx, http.MethodGet, path, nil, &available); err != nil {
+		return err
+	}
+
+	for _, transition := range available.Transitions {
+		if strings.EqualFold(transition.To.Name, status) || strings.EqualFold(transition.Name, status) {
+			return jc.do(ctx, http.MethodPost, path, map[string]interface{}{
+				"transition": map[string]string{"id": transition.ID},
+			}, nil)
+		}
+	}
+	log.Printf("No Jira transition to %q available for %s", status, key)
+	return nil
+}
+
+// jiraKeysForPR collects issue keys from the PR title, head branch and
+// commit messages.
+func (rb *ReviewBot) jiraKeysForPR(ctx context.Context, owner, repo string, pr *github.PullRequest) ([]string, error) {
+	commits, err := rb.listPRCommits(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return nil, err
+	}
+	texts := []string{pr.GetTitle(), pr.GetHead().GetRef()}
+	for _, commit := range commits {
+		texts = append(texts, commit.GetCommit().GetMessage())
+	}
+	return extractJiraKeys(rb.config.Settings.Jira.Projects, texts...), nil
+}
+
+// syncJira links pr to every issue it mentions and, for stages other than
+// plain updates, comments on and transitions those issues. stage is empty
+// for pushes that should only refresh links.
+func (rb *ReviewBot) syncJira(ctx context.Context, owner, repo string, pr *github.PullRequest, stage string) {
+	settings := rb.config.Settings.Jira
+	if !settings.enabled() {
+		return
+	}
+
+	ctx, span := tracer().Start(ctx, "syncJira")
+	defer span.End()
+
+	keys, err := rb.jiraKeysForPR(ctx, owner, repo, pr)
+	if err != nil {
+		recordSpanError(span, err)
+		log.Printf("Failed to collect Jira keys for %s/%s#%d: %v", owner, repo, pr.GetNumber(), err)
+		return
+	}
+
+	jira := NewJiraClient(settings)
+	title := fmt.Sprintf("%s/%s#%d: %s", owner, repo, pr.GetNumber(), pr.GetTitle())
+	for _, key := range keys {
+		if err := jira.AddRemoteLink(ctx, key, pr.GetHTMLURL(), title); err != nil {
+			log.Printf("Failed to link %s to %s: %v", key, pr.GetHTMLURL(), err)
+			continue
+		}
+		if stage == "" {
+			continue
+		}
+
+		if err := jira.AddComment(ctx, key, jiraComment(stage, title, pr.GetHTMLURL())); err != nil {
+			log.Printf("Failed to comment on %s: %v", key, err)
+		}
+		if status := settings.Transitions[stage]; status != "" {
+			if err := jira.TransitionTo(ctx, key, status); err != nil {
+				log.Printf("Failed to transition %s to %q: %v", key, status, err)
+			}
+		}
+	}
+}
+
+func jiraComment(stage, title, prURL string) string {
+	switch stage {
+	case JiraOpened:
+		return fmt.Sprintf("Pull request opened: [%s|%s]", title, prURL)
+	case JiraMergeReady:
+		return fmt.Sprintf("Pull request is ready to merge: [%s|%s]", title, prURL)
+	case JiraMerged:
+		return fmt.Sprintf("Pull request merged: [%s|%s]", title, prURL)
+	default:
+		return fmt.Sprintf("Pull request updated: [%s|%s]", title, prURL)
+	}
+}
+
+// runJiraCheck requires the PR to reference at least one existing Jira
+// issue. Enable it by adding "jira" to REQUIRED_CHECKS.
+func (rb *ReviewBot) runJiraCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	settings := rb.config.Settings.Jira
+	if !settings.enabled() {
+		return CheckResult{
+			Name:    "jira",
+			Status:  "skipped",
+			Message: "Jira integration is not configured",
+		}
+	}
+
+	keys, err := rb.jiraKeysForPR(ctx, owner, repo, pr)
+	if err != nil {
+		return CheckResult{
+			Name:    "jira",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get PR commits: %v", err),
+		}
+	}
+	if len(keys) == 0 {
+		return CheckResult{
+			Name:    "jira",
+			Status:  "failure",
+			Message: "No Jira issue key found in the title, branch name or commit messages",
+		}
+	}
+
+	jira := NewJiraClient(settings)
+	var valid, unknown []string
+	for _, key := range keys {
+		exists, err := jira.IssueExists(ctx, key)
+		if err != nil {
+			return CheckResult{
+				Name:    "jira",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to look up %s: %v", key, err),
+			}
+		}
+		if exists {
+			valid = append(valid, key)
+		} else {
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(valid) == 0 {
+		return CheckResult{
+			Name:    "jira",
+			Status:  "failure",
+			Message: fmt.Sprintf("Referenced Jira issues do not exist: %s", strings.Join(unknown, ", ")),
+		}
+	}
+	return CheckResult{
+		Name:    "jira",
+		Status:  "success",
+		Message: fmt.Sprintf("Linked to %s", strings.Join(valid, ", ")),
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestExtractJiraKeys(t *testing.T) {
+	keys := extractJiraKeys(nil, "ABC-12: fix retries", "feature/DEF-7-retries", "Refs XY_Z-3 and ABC-12, not utf-8")
+	if want := []string{"ABC-12", "DEF-7", "XY_Z-3"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected %v, got %v", want, keys)
+	}
+
+	keys = extractJiraKeys([]string{"ABC"}, "Switch to UTF-8 for ABC-4")
+	if want := []string{"ABC-4"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected project filter to yield %v, got %v", want, keys)
+	}
+}
+
+// jiraStub is a tiny in-memory Jira that records the calls it receives.
+type jiraStub struct {
+	mu          sync.Mutex
+	issues      map[string]bool
+	links       map[string]string
+	comments    map[string][]string
+	transitions map[string]string
+}
+
+func newJiraStub(t *testing.T, issues ...string) (*jiraStub, *httptest.Server) {
+	stub := &jiraStub{
+		issues:      map[string]bool{},
+		links:       map[string]string{},
+		comments:    map[string][]string{},
+		transitions: map[string]string{},
+	}
+	for _, key := range issues {
+		stub.issues[key] = true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/issue/", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "jira-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var key, action string
+		rest := r.URL.Path[len("/rest/api/2/issue/"):]
+		for i := range rest {
+			if rest[i] == '/' {
+				key, action = rest[:i], rest[i+1:]
+				break
+			}
+		}
+		if key == "" {
+			key = rest
+		}
+
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		if !stub.issues[key] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case action == "":
+			w.Write([]byte(`{"key":"` + key + `"}`))
+		case action == "remotelink":
+			stub.links[key] = body["globalId"].(string)
+			w.WriteHeader(http.StatusCreated)
+		case action == "comment":
+			stub.comments[key] = append(stub.comments[key], body["body"].(string))
+			w.WriteHeader(http.StatusCreated)
+		case action == "transitions" && r.Method == http.MethodGet:
+			w.Write([]byte(`{"transitions":[{"id":"21","name":"Start review","to":{"name":"In Review"}},{"id":"31","name":"Done","to":{"name":"Done"}}]}`))
+		case action == "transitions":
+			stub.transitions[key] = body["transition"].(map[string]interface{})["id"].(string)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+func newJiraTestBot(t *testing.T, jiraURL string) *ReviewBot {
+	gh := http.NewServeMux()
+	gh.HandleFunc("/repos/acme/api/pulls/5/commits", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"commit":{"message":"ABC-2: add retry budget"}},{"commit":{"message":"typo"}}]`))
+	})
+
+	bot := newTestBot(t, gh)
+	bot.config.Settings.Jira = JiraSettings{
+		BaseURL:  jiraURL,
+		User:     "bot@example.com",
+		Token:    "jira-token",
+		Projects: []string{"ABC"},
+		Transitions: map[string]string{
+			JiraOpened: "In Review",
+			JiraMerged: "Done",
+		},
+	}
+	return bot
+}
+
+func testPullRequest() *github.PullRequest {
+	return &github.PullRequest{
+		Number:  github.Int(5),
+		Title:   github.String("ABC-1: Retry webhook deliveries"),
+		HTMLURL: github.String("https://github.com/acme/api/pull/5"),
+		Head:    &github.PullRequestBranch{Ref: github.String("feature/abc-1-retries"), SHA: github.String("abc")},
+	}
+}
+
+func TestSyncJiraLinksCommentsAndTransitions(t *testing.T) {
+	stub, server := newJiraStub(t, "ABC-1", "ABC-2")
+	bot := newJiraTestBot(t, server.URL)
+
+	bot.syncJira(context.Background(), "acme", "api", testPullRequest(), JiraOpened)
+
+	for _, key := range []string{"ABC-1", "ABC-2"} {
+		if stub.links[key] != "https://github.com/acme/api/pull/5" {
+			t.Errorf("Expected %s to be linked to the PR, got %q", key, stub.links[key])
+		}
+		if len(stub.comments[key]) != 1 {
+			t.Errorf("Expected one comment on %s, got %v", key, stub.comments[key])
+		}
+		if stub.transitions[key] != "21" {
+			t.Errorf("Expected %s to move to In Review (21), got %q", key, stub.transitions[key])
+		}
+	}
+
+	// A stage without a configured status only comments.
+	bot.syncJira(context.Background(), "acme", "api", testPullRequest(), JiraMergeReady)
+	if len(stub.comments["ABC-1"]) != 2 || stub.transitions["ABC-1"] != "21" {
+		t.Errorf("Expected merge_ready to comment without transitioning, got comments=%v transition=%s",
+			stub.comments["ABC-1"], stub.transitions["ABC-1"])
+	}
+}
+
+func TestRunJiraCheck(t *testing.T) {
+	_, server := newJiraStub(t, "ABC-2")
+	bot := newJiraTestBot(t, server.URL)
+
+	result := bot.runJiraCheck(context.Background(), "acme", "api", testPullRequest())
+	if result.Status != "success" || result.Message != "Linked to ABC-2" {
+		t.Errorf("Expected success linking ABC-2, got %+v", result)
+	}
+
+	_, emptyServer := newJiraStub(t)
+	bot.config.Settings.Jira.BaseURL = emptyServer.URL
+	result = bot.runJiraCheck(context.Background(), "acme", "api", testPullRequest())
+	if result.Status != "failure" {
+		t.Errorf("Expected failure when no referenced issue exists, got %+v", result)
+	}
+
+	bot.config.Settings.Jira = JiraSettings{}
+	result = bot.runJiraCheck(context.Background(), "acme", "api", testPullRequest())
+	if result.Status != "skipped" {
+		t.Errorf("Expected skipped without Jira configuration, got %+v", result)
+	}
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// LintFinding is a single problem reported by one of the lint analyzers.
+type LintFinding struct {
+	File     string
+	Line     int
+	Analyzer string
+	Message  string
+}
+
+func (f LintFinding) String() string {
+	switch {
+	case f.File == "":
+		return fmt.Sprintf("[%s] %s", f.Analyzer, f.Message)
+	case f.Line == 0:
+		return fmt.Sprintf("`%s` [%s] %s", f.File, f.Analyzer, f.Message)
+	}
+	return fmt.Sprintf("`%s:%d` [%s] %s", f.File, f.Line, f.Analyzer, f.Message)
+}
+
+// runLintCheck fetches the head version of every changed Go file, runs the
+// built-in analyzers on it and reports findings that fall on added lines.
+func (rb *ReviewBot) runLintCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return CheckResult{
+			Name:    "lint",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get PR files: %v", err),
+		}
+	}
+
+	var findings []LintFinding
+	syntaxErrors := 0
+	linted := 0
+	for _, file := range files {
+		name := file.GetFilename()
+		if !strings.HasSuffix(name, ".go") || file.GetStatus() == "removed" || isVendored(name) {
+			continue
+		}
+
+		src, err := rb.fileContentAt(ctx, owner, repo, name, pr.GetHead().GetSHA())
+		if err != nil {
+			return CheckResult{
+				Name:    "lint",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to get %s at %s: %v", name, shortSHA(pr.GetHead().GetSHA()), err),
+			}
+		}
+		if isGeneratedGo(src) {
+			continue
+		}
+		linted++
+
+		fileFindings, err := lintGoFile(name, src)
+		if err != nil {
+			syntaxErrors++
+		}
+		added := addedLines(file.GetPatch())
+		for _, finding := range fileFindings {
+			// Syntax errors are reported wherever they are; they break the build.
+			if added == nil || added[finding.Line] || finding.Analyzer == "syntax" {
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	if linted == 0 {
+		return CheckResult{
+			Name:    "lint",
+			Status:  "success",
+			Message: "No Go files to lint",
+		}
+	}
+	if len(findings) == 0 {
+		return CheckResult{
+			Name:    "lint",
+			Status:  "success",
+			Message: fmt.Sprintf("No linting issues found in %d changed Go files", linted),
+		}
+	}
+
+	status := "warning"
+	if syntaxErrors > 0 {
+		status = "failure"
+	}
+	return CheckResult{
+		Name:    "lint",
+		Status:  status,
+		Message: fmt.Sprintf("Found %d linting issues on changed lines", len(findings)),
+		Details: lintDetails(findings),
+	}
+}
+
+func lintDetails(findings []LintFinding) []string {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+
+	details := make([]string, len(findings))
+	for i, finding := range findings {
+		details[i] = finding.String()
+	}
+	return capDetails(details, maxCheckDetails)
+}
+
+// lintGoFile parses src and runs every analyzer over it. If the file does not
+// parse, the syntax errors are returned as findings along with the error.
+func lintGoFile(filename string, src []byte) ([]LintFinding, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		var findings []LintFinding
+		if list, ok := err.(scanner.ErrorList); ok {
+			for _, e := range list {
+				findings = append(findings, LintFinding{File: filename, Line: e.Pos.Line, Analyzer: "syntax", Message: e.Msg})
+			}
+		} else {
+			findings = append(findings, LintFinding{File: filename, Line: 1, Analyzer: "syntax", Message: err.Error()})
+		}
+		return findings, err
+	}
+
+	var findings []LintFinding
+	findings = append(findings, gofmtFindings(filename, src)...)
+	for _, analyze := range []func(*token.FileSet, *ast.File) []LintFinding{
+		unusedResultFindings,
+		shadowFindings,
+		printfFindings,
+	} {
+		findings = append(findings, analyze(fset, file)...)
+	}
+	return findings, nil
+}
+
+// gofmtFindings reports the lines that gofmt would change.
+func gofmtFindings(filename string, src []byte) []LintFinding {
+	formatted, err := format.Source(src)
+	if err != nil || bytes.Equal(formatted, src) {
+		return nil
+	}
+
+	var findings []LintFinding
+	for _, line := range changedLines(splitLines(src), splitLines(formatted)) {
+		findings = append(findings, LintFinding{File: filename, Line: line, Analyzer: "gofmt", Message: "line is not gofmt-formatted"})
+	}
+	return findings
+}
+
+func splitLines(src []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(src), "\n"), "\n")
+}
+
+// changedLines returns the 1-based lines of a that are not part of a
+// shortest edit script turning a into b (Myers' algorithm). Very different
+// inputs fall back to the first differing line.
+func changedLines(a, b []string) []int {
+	n, m := len(a), len(b)
+	limit := 1000
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	// trace[d] keeps diagonals -d..d of v as it was before step d, the only
+	// ones step d reads.
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= n+m && d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	if !found {
+		for i := 0; i < n && i < m; i++ {
+			if a[i] != b[i] {
+				return []int{i + 1}
+			}
+		}
+		return []int{min(n, m) + 1}
+	}
+
+	// Walk the trace backwards; every step right (x advances alone) deletes
+	// a line from a.
+	var deleted []int
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x > prevX {
+			deleted = append(deleted, x)
+		}
+		x, y = prevX, prevY
+	}
+	sort.Ints(deleted)
+	return deleted
+}
+
+// importNames maps the local name of each import in file to its path.
+func importNames(file *ast.File) map[string]string {
+	names := make(map[string]string)
+	for _, imp := range file.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+		name := importPath[strings.LastIndex(importPath, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		names[name] = importPath
+	}
+	return names
+}
+
+// packageCall returns the import path and function name when call is a
+// package-qualified call such as fmt.Sprintf.
+func packageCall(imports map[string]string, call *ast.CallExpr) (string, string, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", "", false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok || pkg.Obj != nil {
+		return "", "", false
+	}
+	importPath, ok := imports[pkg.Name]
+	return importPath, sel.Sel.Name, ok
+}
+
+// pureFuncs are functions whose only effect is their result, so calling them
+// as a statement is always a mistake.
+var pureFuncs = map[string]bool{
+	"errors.New":         true,
+	"fmt.Errorf":         true,
+	"fmt.Sprint":         true,
+	"fmt.Sprintf":        true,
+	"fmt.Sprintln":       true,
+	"strings.Join":       true,
+	"strings.Repeat":     true,
+	"strings.Replace":    true,
+	"strings.ReplaceAll": true,
+	"strings.Split":      true,
+	"strings.ToLower":    true,
+	"strings.ToUpper":    true,
+	"strings.Trim":       true,
+	"strings.TrimPrefix": true,
+	"strings.TrimSpace":  true,
+	"strings.TrimSuffix": true,
+	"context.WithValue":  true,
+	"sort.Reverse":       true,
+	"time.Since":         true,
+}
+
+func unusedResultFindings(fset *token.FileSet, file *ast.File) []LintFinding {
+	imports := importNames(file)
+	var findings []LintFinding
+	ast.Inspect(file, func(n ast.Node) bool {
+		stmt, ok := n.(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+		call, ok := stmt.X.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		importPath, name, ok := packageCall(imports, call)
+		if ok && pureFuncs[importPath+"."+name] {
+			findings = append(findings, LintFinding{
+				File:     fset.Position(call.Pos()).Filename,
+				Line:     fset.Position(call.Pos()).Line,
+				Analyzer: "unusedresult",
+				Message:  fmt.Sprintf("result of %s.%s call not used", importPath, name),
+			})
+		}
+		return true
+	})
+	return findings
+}
+
+// printfFuncs maps printf-style functions to the index of their format
+// argument.
+var printfFuncs = map[string]int{
+	"fmt.Printf":  0,
+	"fmt.Sprintf": 0,
+	"fmt.Errorf":  0,
+	"fmt.Fprintf": 1,
+	"fmt.Appendf": 1,
+	"log.Printf":  0,
+	"log.Fatalf":  0,
+	"log.Panicf":  0,
+}
+
+// printfMethods are method names checked regardless of receiver, covering
+// testing.T, log.Logger and most logging libraries.
+var printfMethods = map[string]bool{
+	"Errorf": true,
+	"Fatalf": true,
+	"Logf":   true,
+	"Panicf": true,
+	"Printf": true,
+	"Skipf":  true,
+}
+
+func printfFindings(fset *token.FileSet, file *ast.File) []LintFinding {
+	imports := importNames(file)
+	var findings []LintFinding
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || call.Ellipsis.IsValid() {
+			return true
+		}
+
+		var name string
+		formatIndex := -1
+		if importPath, fn, ok := packageCall(imports, call); ok {
+			if idx, ok := printfFuncs[importPath+"."+fn]; ok {
+				name, formatIndex = importPath+"."+fn, idx
+			}
+		} else if sel, ok := call.Fun.(*ast.SelectorExpr); ok && printfMethods[sel.Sel.Name] {
+			name, formatIndex = sel.Sel.Name, 0
+		}
+		if formatIndex < 0 || len(call.Args) <= formatIndex {
+			return true
+		}
+
+		lit, ok := call.Args[formatIndex].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		formatString, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+
+		verbs, problem := countFormatVerbs(formatString)
+		args := len(call.Args) - formatIndex - 1
+		pos := fset.Position(call.Pos())
+		switch {
+		case problem != "":
+			findings = append(findings, LintFinding{File: pos.Filename, Line: pos.Line, Analyzer: "printf",
+				Message: fmt.Sprintf("%s format %q %s", name, formatString, problem)})
+		case verbs >= 0 && verbs != args:
+			findings = append(findings, LintFinding{File: pos.Filename, Line: pos.Line, Analyzer: "printf",
+				Message: fmt.Sprintf("%s format %q reads %d args, but call has %d", name, formatString, verbs, args)})
+		}
+		return true
+	})
+	return findings
+}
+
+// countFormatVerbs returns how many arguments a printf format consumes, or
+// -1 when it uses explicit argument indexes that make counting unreliable.
+func countFormatVerbs(format string) (int, string) {
+	count := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		if i < len(format) && format[i] == '[' {
+			return -1, ""
+		}
+		if i < len(format) && format[i] == '*' {
+			count++
+			i++
+		}
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			if i < len(format) && format[i] == '*' {
+				count++
+				i++
+			}
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				i++
+			}
+		}
+		if i >= len(format) {
+			return count, "ends with % and no verb"
+		}
+		count++
+	}
+	return count, ""
+}
+
+// shadowDecl is one declaration of err and the places it is read.
+type shadowDecl struct {
+	pos  token.Pos
+	uses []token.Pos
+}
+
+type shadowScope struct {
+	end   token.Pos
+	decls map[string]*shadowDecl
+	// visibleFrom records, per name, where the declaration takes effect
+	// (after the declaring statement, so `err := f(err)` reads the outer err).
+	visibleFrom map[string]token.Pos
+}
+
+// shadowFindings reports declarations of err that shadow an err from an
+// enclosing scope when the outer one is still used after the inner scope
+// ends - the classic "error silently dropped" bug.
+func shadowFindings(fset *token.FileSet, file *ast.File) []LintFinding {
+	const name = "err"
+
+	type candidate struct {
+		inner    token.Pos
+		outer    *shadowDecl
+		innerEnd token.Pos
+	}
+
+	var (
+		scopes     []*shadowScope
+		opened     []bool
+		ignored    = make(map[token.Pos]bool)
+		candidates []candidate
+	)
+
+	push := func(end token.Pos) {
+		scopes = append(scopes, &shadowScope{end: end, decls: map[string]*shadowDecl{}, visibleFrom: map[string]token.Pos{}})
+	}
+	lookup := func(pos token.Pos, skipInnermost bool) *shadowDecl {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if skipInnermost && i == len(scopes)-1 {
+				continue
+			}
+			if decl, ok := scopes[i].decls[name]; ok && scopes[i].visibleFrom[name] <= pos {
+				return decl
+			}
+		}
+		return nil
+	}
+	declare := func(ident *ast.Ident, visibleFrom token.Pos) {
+		ignored[ident.Pos()] = true
+		if ident.Name != name || len(scopes) == 0 {
+			return
+		}
+		scope := scopes[len(scopes)-1]
+		if _, exists := scope.decls[name]; exists {
+			return // := redeclaration in the same scope is an assignment
+		}
+		if outer := lookup(ident.Pos(), true); outer != nil {
+			candidates = append(candidates, candidate{inner: ident.Pos(), outer: outer, innerEnd: scope.end})
+		}
+		scope.decls[name] = &shadowDecl{pos: ident.Pos()}
+		scope.visibleFrom[name] = visibleFrom
+	}
+	declareFields := func(fields *ast.FieldList, visibleFrom token.Pos) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, ident := range field.Names {
+				declare(ident, visibleFrom)
+			}
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			if opened[len(opened)-1] {
+				scopes = scopes[:len(scopes)-1]
+			}
+			opened = opened[:len(opened)-1]
+			return true
+		}
+
+		opens := false
+		switch node := n.(type) {
+		case *ast.FuncDecl:
+			if node.Body != nil {
+				push(node.End())
+				opens = true
+				declareFields(node.Recv, node.Pos())
+				declareFields(node.Type.Params, node.Pos())
+				declareFields(node.Type.Results, node.Pos())
+			}
+		case *ast.FuncLit:
+			push(node.End())
+			opens = true
+			declareFields(node.Type.Params, node.Pos())
+			declareFields(node.Type.Results, node.Pos())
+		case *ast.BlockStmt, *ast.IfStmt, *ast.ForStmt, *ast.SwitchStmt,
+			*ast.TypeSwitchStmt, *ast.CaseClause, *ast.CommClause:
+			push(node.End())
+			opens = true
+		case *ast.RangeStmt:
+			push(node.End())
+			opens = true
+			if node.Tok == token.DEFINE {
+				for _, expr := range []ast.Expr{node.Key, node.Value} {
+					if ident, ok := expr.(*ast.Ident); ok {
+						declare(ident, node.X.End())
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			if node.Tok == token.DEFINE {
+				for _, expr := range node.Lhs {
+					if ident, ok := expr.(*ast.Ident); ok {
+						declare(ident, node.End())
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			for _, ident := range node.Names {
+				declare(ident, node.End())
+			}
+		case *ast.Field:
+			for _, ident := range node.Names {
+				ignored[ident.Pos()] = true
+			}
+		case *ast.SelectorExpr:
+			ignored[node.Sel.Pos()] = true
+		case *ast.KeyValueExpr:
+			if ident, ok := node.Key.(*ast.Ident); ok {
+				ignored[ident.Pos()] = true
+			}
+		case *ast.Ident:
+			if node.Name == name && !ignored[node.Pos()] {
+				if decl := lookup(node.Pos(), false); decl != nil {
+					decl.uses = append(decl.uses, node.Pos())
+				}
+			}
+		}
+		opened = append(opened, opens)
+		return true
+	})
+
+	var findings []LintFinding
+	for _, c := range candidates {
+		for _, use := range c.outer.uses {
+			if use > c.innerEnd {
+				pos := fset.Position(c.inner)
+				findings = append(findings, LintFinding{
+					File:     pos.Filename,
+					Line:     pos.Line,
+					Analyzer: "shadow",
+					Message:  fmt.Sprintf("declaration of %q shadows declaration at line %d", name, fset.Position(c.outer.pos).Line),
+				})
+				break
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestAddedLines(t *testing.T) {
+	patch := "@@ -1,3 +1,4 @@\n package main\n-var a = 1\n+var a = 2\n+var b = 3\n \n@@ -10 +11,2 @@ func f() {\n+\tx()\n \ty()\n\\ No newline at end of file"
+	want := map[int]bool{2: true, 3: true, 11: true}
+	if got := addedLines(patch); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if addedLines("") != nil {
+		t.Error("Expected nil for a missing patch")
+	}
+}
+
+func lintSource(t *testing.T, src string) []LintFinding {
+	t.Helper()
+	findings, err := lintGoFile("x.go", []byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	return findings
+}
+
+func findingLines(findings []LintFinding, analyzer string) []int {
+	var lines []int
+	for _, f := range findings {
+		if f.Analyzer == analyzer {
+			lines = append(lines, f.Line)
+		}
+	}
+	return lines
+}
+
+func TestLintGofmt(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\tx := 1\n\t_ = x\n   y:=2\n\t_ = y\n}\n"
+	if got := findingLines(lintSource(t, src), "gofmt"); !reflect.DeepEqual(got, []int{6}) {
+		t.Errorf("Expected gofmt finding on line 6, got %v", got)
+	}
+
+	formatted := "package main\n\nfunc main() {}\n"
+	if got := findingLines(lintSource(t, formatted), "gofmt"); got != nil {
+		t.Errorf("Expected no gofmt findings, got %v", got)
+	}
+}
+
+func TestChangedLines(t *testing.T) {
+	a := []string{"a", "b", "c", "d", "e"}
+	b := []string{"a", "B", "c", "e", "f"}
+	if got := changedLines(a, b); !reflect.DeepEqual(got, []int{2, 4}) {
+		t.Errorf("Expected [2 4], got %v", got)
+	}
+}
+
+func TestLintUnusedResult(t *testing.T) {
+	src := `package main
+
+import (
+	f "fmt"
+	"strings"
+)
+
+func main() {
+	f.Sprintf("%d", 1)
+	strings.TrimSpace(" x ")
+	f.Println("ok")
+}
+`
+	if got := findingLines(lintSource(t, src), "unusedresult"); !reflect.DeepEqual(got, []int{9, 10}) {
+		t.Errorf("Expected unusedresult findings on lines 9 and 10, got %v", got)
+	}
+}
+
+func TestLintPrintf(t *testing.T) {
+	src := `package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func main() {
+	fmt.Printf("%s %d\n", "a")
+	fmt.Fprintf(os.Stderr, "100%% %*d\n", 3, 4)
+	log.Printf("%s", "a", "b")
+	fmt.Printf("%[1]s %[1]s\n", "a")
+	args := []interface{}{1}
+	fmt.Printf("%d %d", args...)
+	var t interface{ Errorf(string, ...interface{}) }
+	t.Errorf("trailing %")
+}
+`
+	if got := findingLines(lintSource(t, src), "printf"); !reflect.DeepEqual(got, []int{10, 12, 17}) {
+		t.Errorf("Expected printf findings on lines 10, 12 and 17, got %v", got)
+	}
+}
+
+func TestLintShadow(t *testing.T) {
+	src := `package main
+
+import "os"
+
+func main() {
+	_, err := os.Open("a")
+	if true {
+		_, err := os.Open("b")
+		_ = err
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ok() error {
+	_, err := os.Open("a")
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := os.Open("b"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+`
+	if got := findingLines(lintSource(t, src), "shadow"); !reflect.DeepEqual(got, []int{8}) {
+		t.Errorf("Expected a shadow finding on line 8 only, got %v", got)
+	}
+}
+
+func TestLintSyntaxError(t *testing.T) {
+	findings, err := lintGoFile("x.go", []byte("package main\n\nfunc main() {\n"))
+	if err == nil {
+		t.Fatal("Expected a parse error")
+	}
+	if len(findings) == 0 || findings[0].Analyzer != "syntax" {
+		t.Errorf("Expected syntax findings, got %v", findings)
+	}
+}
+
+func TestRunLintCheckOnlyReportsChangedLines(t *testing.T) {
+	source := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Sprintf(\"old\")\n\tfmt.Sprintf(\"new\")\n}\n"
+	generated := "// Code generated by tool. DO NOT EDIT.\n\npackage main\n\nfunc   f() {}\n"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{
+			{Filename: github.String("main.go"), Status: github.String("modified"), Patch: github.String("@@ -6,0 +7 @@\n+\tfmt.Sprintf(\"new\")")},
+			{Filename: github.String("gen.go"), Status: github.String("added")},
+			{Filename: github.String("vendor/x/x.go"), Status: github.String("added")},
+			{Filename: github.String("old.go"), Status: github.String("removed")},
+			{Filename: github.String("README.md"), Status: github.String("modified")},
+		})
+	})
+	serve := func(content string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("ref") != "abc123" {
+				t.Errorf("Expected content at head SHA, got ref %q", r.URL.Query().Get("ref"))
+			}
+			json.NewEncoder(w).Encode(&github.RepositoryContent{
+				Type:     github.String("file"),
+				Encoding: github.String("base64"),
+				Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+			})
+		}
+	}
+	mux.HandleFunc("/repos/o/r/contents/main.go", serve(source))
+	mux.HandleFunc("/repos/o/r/contents/gen.go", serve(generated))
+
+	bot := newTestBot(t, mux)
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Head:   &github.PullRequestBranch{SHA: github.String("abc123")},
+	}
+	result := bot.runLintCheck(context.Background(), "o", "r", pr)
+
+	if result.Status != "warning" {
+		t.Fatalf("Expected warning, got %s: %s", result.Status, result.Message)
+	}
+	if len(result.Details) != 1 || !strings.HasPrefix(result.Details[0], "`main.go:7` [unusedresult]") {
+		t.Errorf("Expected a single finding on main.go:7, got %v", result.Details)
+	}
+}
+
+func TestCommentBodyListsDetails(t *testing.T) {
+	bot := NewReviewBot(NewConfig())
+	checks := []CheckResult{{Name: "lint", Status: "warning", Message: "Found 1 linting issues", Details: []string{"`a.go:3` [gofmt] line is not gofmt-formatted"}}}
+	comment := bot.generateCommentBody(checks, MergeVerdict{})
+	if !strings.Contains(comment, "\n  - `a.go:3` [gofmt]") {
+		t.Errorf("Expected nested detail bullet, got:\n%s", comment)
+	}
+}
@@ -1,36 +1,72 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/go-github/v57/github"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/oauth2"
 )
 
+const version = "1.0.0"
+
 type Config struct {
-	GitHubToken    string
-	WebhookSecret  string
-	Port           string
-	MinReviewers   int
-	RequiredChecks []string
+	GitHubToken     string
+	WebhookSecret   string
+	Port            string
+	MinReviewers    int
+	RequiredChecks  []string
+	OTLPEndpoint    string
+	ServiceName     string
+	DataDir         string
+	AdminToken      string
+	WebhookURL      string
+	SlackWebhookURL string
+	ConfigFile      string
+	// BotLogin is the login the bot comments as. It is looked up from
+	// GITHUB_TOKEN if unset; a GitHub App's installation token can't look
+	// itself up, so set it to "<app-slug>[bot]" there.
+	BotLogin string
+	Settings Settings
 }
 
 type ReviewBot struct {
-	client *github.Client
-	config Config
-	stats  *StatsCollector
+	client          *github.Client
+	config          Config
+	stats           *StatsCollector
+	store           *Store
+	outbox          *Outbox
+	evaluations     *EvaluationStore
+	osv             *OSVDatabase
+	reviewers       *ReviewerRotation
+	reminders       *ReminderLog
+	mergeQueue      *MergeQueue
+	freezes         *FreezeLog
+	shadow          *ShadowLog
+	autoMergeOptIns *AutoMergeOptIns
+
+	// inFlight tracks webhook deliveries still being processed.
+	inFlight sync.WaitGroup
+
+	loginMu sync.Mutex
+	login   string
 }
 
 type StatsCollector struct {
@@ -42,19 +78,27 @@ type StatsCollector struct {
 }
 
 type CheckResult struct {
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
-	Time    string `json:"time"`
+	Name    string      `json:"name"`
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Time    string      `json:"time"`
+	Details []string    `json:"details,omitempty"`
+	Table   *CheckTable `json:"table,omitempty"`
+}
+
+// CheckTable is tabular detail shown below the check list in the PR comment.
+type CheckTable struct {
+	Header []string   `json:"header"`
+	Rows   [][]string `json:"rows"`
 }
 
 type PRStats struct {
-	PRNumber        int                    `json:"pr_number"`
-	ProcessingTime  string                 `json:"processing_time"`
-	ChecksRun       []CheckResult          `json:"checks_run"`
-	ReviewersCount  int                    `json:"reviewers_count"`
-	Status          string                 `json:"status"`
-	ThirdPartyHooks map[string]interface{} `json:"third_party_hooks"`
+	PRNumber       int           `json:"pr_number"`
+	Repository     string        `json:"repository"`
+	ProcessingTime string        `json:"processing_time"`
+	ChecksRun      []CheckResult `json:"checks_run"`
+	ReviewersCount int           `json:"reviewers_count"`
+	Status         string        `json:"status"`
 }
 
 func NewConfig() Config {
@@ -62,11 +106,19 @@ func NewConfig() Config {
 	requiredChecks := strings.Split(getEnvOrDefault("REQUIRED_CHECKS", "test,lint,build"), ",")
 	
 	return Config{
-		GitHubToken:    os.Getenv("GITHUB_TOKEN"),
-		WebhookSecret:  os.Getenv("WEBHOOK_SECRET"),
-		Port:           getEnvOrDefault("PORT", "8080"),
-		MinReviewers:   minReviewers,
-		RequiredChecks: requiredChecks,
+		GitHubToken:     os.Getenv("GITHUB_TOKEN"),
+		WebhookSecret:   os.Getenv("WEBHOOK_SECRET"),
+		Port:            getEnvOrDefault("PORT", "8080"),
+		MinReviewers:    minReviewers,
+		RequiredChecks:  requiredChecks,
+		OTLPEndpoint:    os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName:     getEnvOrDefault("OTEL_SERVICE_NAME", "github-review-bot"),
+		DataDir:         getEnvOrDefault("DATA_DIR", "./data"),
+		AdminToken:      os.Getenv("ADMIN_TOKEN"),
+		WebhookURL:      os.Getenv("THIRD_PARTY_WEBHOOK_URL"),
+		SlackWebhookURL: os.Getenv("SLACK_WEBHOOK_URL"),
+		ConfigFile:      getEnvOrDefault("CONFIG_FILE", "review-bot.json"),
+		BotLogin:        os.Getenv("BOT_LOGIN"),
 	}
 }
 
@@ -82,67 +134,215 @@ func NewReviewBot(config Config) *ReviewBot {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: config.GitHubToken},
 	)
+	store := NewStore(config.DataDir)
+	shadow := NewShadowLog(store)
 	tc := oauth2.NewClient(ctx, ts)
+	tc.Transport = tracedTransport(shadow.Transport(tc.Transport))
 	client := github.NewClient(tc)
 
-	return &ReviewBot{
+	rb := &ReviewBot{
 		client: client,
 		config: config,
 		stats: &StatsCollector{
 			PRProcessingTimes: make(map[string]time.Duration),
 			CheckRunTimes:     make(map[string]time.Duration),
 		},
-	}
+		store:           store,
+		outbox:          NewOutbox(store),
+		evaluations:     NewEvaluationStore(store),
+		osv:             &OSVDatabase{},
+		reviewers:       NewReviewerRotation(store),
+		reminders:       NewReminderLog(store),
+		mergeQueue:      NewMergeQueue(store),
+		freezes:         NewFreezeLog(store),
+		shadow:          shadow,
+		autoMergeOptIns: NewAutoMergeOptIns(store),
+	}
+	rb.outbox.SecretFor = rb.subscriberSecret
+	rb.shadow.Covers = rb.shadowed
+	return rb
 }
 
 func (rb *ReviewBot) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
+
+	// Processing outlives the request, so start from a fresh context and
+	// only carry over any incoming trace headers.
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer().Start(ctx, "handleWebhook", trace.WithAttributes(
+		attribute.String("github.delivery_id", github.DeliveryID(r)),
+		attribute.String("github.event", github.WebHookType(r)),
+	))
 	
 	payload, err := io.ReadAll(r.Body)
 	if err != nil {
+		recordSpanError(span, err)
+		span.End()
 		http.Error(w, "Error reading request body", http.StatusBadRequest)
 		return
 	}
 
 	event, err := github.ParseWebHook(github.WebHookType(r), payload)
 	if err != nil {
+		recordSpanError(span, err)
+		span.End()
 		http.Error(w, "Error parsing webhook", http.StatusBadRequest)
 		return
 	}
 
+	// GitHub gives up on a delivery after 10 seconds, far less than checks
+	// that build and test the code take, so acknowledge it first.
+	rb.inFlight.Add(1)
+	go func() {
+		defer rb.inFlight.Done()
+		defer span.End()
+		rb.dispatchEvent(ctx, event, startTime)
+	}()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (rb *ReviewBot) dispatchEvent(ctx context.Context, event interface{}, startTime time.Time) {
 	switch e := event.(type) {
 	case *github.PullRequestEvent:
-		rb.handlePullRequestEvent(e, startTime)
+		rb.handlePullRequestEvent(ctx, e, startTime)
 	case *github.CheckRunEvent:
-		rb.handleCheckRunEvent(e, startTime)
+		rb.handleCheckRunEvent(ctx, e, startTime)
 	case *github.PullRequestReviewEvent:
-		rb.handleReviewEvent(e, startTime)
+		rb.handleReviewEvent(ctx, e, startTime)
+	case *github.IssueCommentEvent:
+		rb.handleIssueCommentEvent(ctx, e, startTime)
+	case *github.PullRequestReviewThreadEvent:
+		rb.handleReviewThreadEvent(ctx, e)
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
+// botLogin returns the login the bot acts as, looking it up once.
+func (rb *ReviewBot) botLogin(ctx context.Context) (string, error) {
+	if rb.config.BotLogin != "" {
+		return rb.config.BotLogin, nil
+	}
+	rb.loginMu.Lock()
+	defer rb.loginMu.Unlock()
+	if rb.login == "" {
+		user, _, err := rb.client.Users.Get(ctx, "")
+		if err != nil {
+			return "", fmt.Errorf("looking up the bot's login: %w", err)
+		}
+		rb.login = user.GetLogin()
+	}
+	return rb.login, nil
 }
 
-func (rb *ReviewBot) handlePullRequestEvent(event *github.PullRequestEvent, startTime time.Time) {
-	if event.GetAction() != "opened" && event.GetAction() != "synchronize" {
-		return
+// waitInFlight waits for webhook deliveries still being processed, or until
+// ctx is done.
+func (rb *ReviewBot) waitInFlight(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		rb.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	ctx := context.Background()
+func (rb *ReviewBot) handlePullRequestEvent(ctx context.Context, event *github.PullRequestEvent, startTime time.Time) {
 	pr := event.GetPullRequest()
 	owner := event.GetRepo().GetOwner().GetLogin()
 	repo := event.GetRepo().GetName()
 	prNumber := pr.GetNumber()
 
+	if event.GetAction() == "closed" {
+		rb.evaluations.MarkClosed(owner+"/"+repo, prNumber, pr.GetMerged())
+		rb.mergeQueue.Remove(owner+"/"+repo, prNumber, QueueEjected, "the pull request was closed.")
+		rb.autoMergeOptIns.Forget(owner+"/"+repo, prNumber)
+		if pr.GetMerged() {
+			rb.syncJira(ctx, owner, repo, pr, JiraMerged)
+		}
+		return
+	}
+	if event.GetAction() == "labeled" {
+		switch event.GetLabel().GetName() {
+		case rb.config.Settings.AutoMerge.label():
+			if rb.config.Settings.AutoMerge.Enabled {
+				rb.handleAutoMergeLabeled(ctx, owner, repo, pr, event.GetSender().GetLogin())
+			}
+		case rb.config.Settings.Freeze.overrideLabel():
+			rb.handleFreezeOverride(ctx, owner, repo, pr, event.GetSender().GetLogin())
+		default:
+			if containsString(rb.config.Settings.Blockers.Labels, event.GetLabel().GetName()) {
+				rb.reevaluate(ctx, owner, repo, pr)
+			}
+		}
+		return
+	}
+	if event.GetAction() == "unlabeled" {
+		name := event.GetLabel().GetName()
+		if name == rb.config.Settings.AutoMerge.label() {
+			rb.autoMergeOptIns.Forget(owner+"/"+repo, prNumber)
+		}
+		if containsString(rb.config.Settings.Blockers.Labels, name) || name == rb.config.Settings.Freeze.overrideLabel() {
+			rb.reevaluate(ctx, owner, repo, pr)
+		}
+		return
+	}
+	if event.GetAction() == "edited" {
+		// Only the checks that read the title or description are affected
+		titleChanged, bodyChanged := event.GetChanges().GetTitle() != nil, event.GetChanges().GetBody() != nil
+		var rerun []string
+		for _, name := range rb.mergePolicy(pr.GetBase().GetRef()).checks(rb.config.RequiredChecks) {
+			if name == "conventional" && titleChanged || name == "description" && bodyChanged {
+				rerun = append(rerun, name)
+			}
+		}
+		if len(rerun) > 0 {
+			rb.rerunChecks(ctx, owner, repo, pr, rerun)
+		} else if titleChanged && rb.config.Settings.Blockers.WIP {
+			rb.reevaluate(ctx, owner, repo, pr)
+		}
+		return
+	}
+	if event.GetAction() != "opened" && event.GetAction() != "synchronize" && event.GetAction() != "ready_for_review" {
+		return
+	}
+
 	log.Printf("Processing PR #%d in %s/%s", prNumber, owner, repo)
+	trace.SpanFromContext(ctx).SetAttributes(prAttributes(owner, repo, prNumber)...)
 
 	// Run automated checks
 	checks := rb.runAutomatedChecks(ctx, owner, repo, pr)
 	
+	// Label by changed paths and size
+	labels := rb.autolabel(ctx, owner, repo, pr)
+	rb.labelSize(ctx, owner, repo, pr)
+	
+	// Ask for reviews on new PRs, or drafts once they are ready
+	if event.GetAction() == "opened" || event.GetAction() == "ready_for_review" {
+		if reviewers, teams, err := rb.assignReviewers(ctx, owner, repo, pr); err != nil {
+			log.Printf("Failed to assign reviewers to PR #%d: %v", prNumber, err)
+		} else if len(reviewers)+len(teams) > 0 {
+			log.Printf("Requested reviews on PR #%d from %v %v", prNumber, reviewers, teams)
+		}
+	}
+	
 	// Check merge policies
-	canMerge, reason := rb.checkMergePolicy(ctx, owner, repo, prNumber)
+	verdict := rb.checkMergePolicy(ctx, owner, repo, prNumber)
 	
 	// Update PR with status
-	rb.updatePRStatus(ctx, owner, repo, prNumber, checks, canMerge, reason)
+	rb.updatePRStatus(ctx, owner, repo, prNumber, checks, verdict)
+	change := rb.recordEvaluation(ctx, owner, repo, pr, checks, labels, verdict)
+	rb.maybeAutoMerge(ctx, owner, repo, pr, change.Current)
+	
+	// Link Jira issues; only a newly opened PR moves them along
+	jiraStage := ""
+	if event.GetAction() == "opened" {
+		jiraStage = JiraOpened
+	}
+	rb.syncJira(ctx, owner, repo, pr, jiraStage)
 	
 	// Collect stats
 	processingTime := time.Since(startTime)
@@ -152,7 +352,7 @@ func (rb *ReviewBot) handlePullRequestEvent(event *github.PullRequestEvent, star
 	rb.stats.mu.Unlock()
 
 	// Send to third-party integrations
-	rb.sendToThirdPartyServices(owner, repo, prNumber, checks, processingTime)
+	rb.sendToThirdPartyServices(owner, repo, prNumber, checks, processingTime, change)
 
 	log.Printf("Completed processing PR #%d in %v", prNumber, processingTime)
 }
@@ -160,9 +360,14 @@ func (rb *ReviewBot) handlePullRequestEvent(event *github.PullRequestEvent, star
 func (rb *ReviewBot) runAutomatedChecks(ctx context.Context, owner, repo string, pr *github.PullRequest) []CheckResult {
 	var checks []CheckResult
 	
-	for _, checkName := range rb.config.RequiredChecks {
+	for _, checkName := range rb.mergePolicy(pr.GetBase().GetRef()).checks(rb.config.RequiredChecks) {
 		startTime := time.Now()
-		result := rb.runSpecificCheck(ctx, owner, repo, pr, checkName)
+		checkCtx, span := tracer().Start(ctx, "check "+checkName, trace.WithAttributes(
+			append(prAttributes(owner, repo, pr.GetNumber()), attribute.String("check.name", checkName))...,
+		))
+		result := rb.runSpecificCheck(checkCtx, owner, repo, pr, checkName)
+		span.SetAttributes(attribute.String("check.status", result.Status))
+		span.End()
 		checkTime := time.Since(startTime)
 		
 		result.Time = checkTime.String()
@@ -188,6 +393,20 @@ func (rb *ReviewBot) runSpecificCheck(ctx context.Context, owner, repo string, p
 		return rb.runBuildCheck(ctx, owner, repo, pr)
 	case "security":
 		return rb.runSecurityCheck(ctx, owner, repo, pr)
+	case "jira":
+		return rb.runJiraCheck(ctx, owner, repo, pr)
+	case "coverage":
+		return rb.runCoverageCheck(ctx, owner, repo, pr)
+	case "dependencies":
+		return rb.runDependenciesCheck(ctx, owner, repo, pr)
+	case "vulns":
+		return rb.runVulnsCheck(ctx, owner, repo, pr)
+	case "size":
+		return rb.runSizeCheck(ctx, owner, repo, pr)
+	case "conventional":
+		return rb.runConventionalCheck(ctx, owner, repo, pr)
+	case "description":
+		return rb.runDescriptionCheck(ctx, owner, repo, pr)
 	default:
 		return CheckResult{
 			Name:    checkName,
@@ -198,6 +417,10 @@ func (rb *ReviewBot) runSpecificCheck(ctx context.Context, owner, repo string, p
 }
 
 func (rb *ReviewBot) runTestCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	if rb.config.Settings.Executor.Enabled {
+		return rb.runGoTestCheck(ctx, owner, repo, pr)
+	}
+	
 	// Simulate test execution
 	time.Sleep(100 * time.Millisecond)
 	
@@ -235,81 +458,6 @@ func (rb *ReviewBot) runTestCheck(ctx context.Context, owner, repo string, pr *g
 	}
 }
 
-func (rb *ReviewBot) runLintCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
-	time.Sleep(50 * time.Millisecond)
-	
-	files, _, err := rb.client.PullRequests.ListFiles(ctx, owner, repo, pr.GetNumber(), nil)
-	if err != nil {
-		return CheckResult{
-			Name:    "lint",
-			Status:  "error",
-			Message: fmt.Sprintf("Failed to get PR files: %v", err),
-		}
-	}
-	
-	issues := 0
-	for _, file := range files {
-		if strings.HasSuffix(file.GetFilename(), ".go") {
-			// Simulate linting - check for common issues
-			if file.GetAdditions() > 100 {
-				issues++
-			}
-		}
-	}
-	
-	if issues > 0 {
-		return CheckResult{
-			Name:    "lint",
-			Status:  "warning",
-			Message: fmt.Sprintf("Found %d potential linting issues", issues),
-		}
-	}
-	
-	return CheckResult{
-		Name:    "lint",
-		Status:  "success",
-		Message: "No linting issues found",
-	}
-}
-
-func (rb *ReviewBot) runBuildCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
-	time.Sleep(200 * time.Millisecond)
-	
-	// Check for build files
-	files, _, err := rb.client.PullRequests.ListFiles(ctx, owner, repo, pr.GetNumber(), nil)
-	if err != nil {
-		return CheckResult{
-			Name:    "build",
-			Status:  "error",
-			Message: fmt.Sprintf("Failed to get PR files: %v", err),
-		}
-	}
-	
-	hasBuildFiles := false
-	for _, file := range files {
-		if strings.Contains(file.GetFilename(), "Dockerfile") ||
-		   strings.Contains(file.GetFilename(), "go.mod") ||
-		   strings.Contains(file.GetFilename(), "Makefile") {
-			hasBuildFiles = true
-			break
-		}
-	}
-	
-	if !hasBuildFiles {
-		return CheckResult{
-			Name:    "build",
-			Status:  "success",
-			Message: "No build configuration changes",
-		}
-	}
-	
-	return CheckResult{
-		Name:    "build",
-		Status:  "success",
-		Message: "Build check passed",
-	}
-}
-
 func (rb *ReviewBot) runSecurityCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
 	time.Sleep(150 * time.Millisecond)
 	
@@ -347,42 +495,84 @@ func (rb *ReviewBot) runSecurityCheck(ctx context.Context, owner, repo string, p
 	}
 }
 
-func (rb *ReviewBot) checkMergePolicy(ctx context.Context, owner, repo string, prNumber int) (bool, string) {
-	// Check required reviewers
-	reviews, _, err := rb.client.PullRequests.ListReviews(ctx, owner, repo, prNumber, nil)
+// MergeVerdict is what checkMergePolicy decided about a pull request.
+type MergeVerdict struct {
+	CanMerge bool
+	Reason   string
+	// Blockers lists every condition keeping the PR from merging; Reason
+	// joins them.
+	Blockers []string
+	// StaleApprovals lists reviewers whose approval predates the head commit.
+	StaleApprovals []string
+}
+
+func (rb *ReviewBot) checkMergePolicy(ctx context.Context, owner, repo string, prNumber int) (verdict MergeVerdict) {
+	ctx, span := tracer().Start(ctx, "checkMergePolicy", trace.WithAttributes(prAttributes(owner, repo, prNumber)...))
+	defer func() {
+		span.SetAttributes(
+			attribute.Bool("merge.allowed", verdict.CanMerge),
+			attribute.String("merge.reason", verdict.Reason),
+		)
+		span.End()
+	}()
+
+	pr, _, err := rb.client.PullRequests.Get(ctx, owner, repo, prNumber)
 	if err != nil {
-		return false, fmt.Sprintf("Failed to get reviews: %v", err)
+		return MergeVerdict{Reason: fmt.Sprintf("Failed to get PR: %v", err)}
 	}
 	
-	approvals := 0
-	for _, review := range reviews {
-		if review.GetState() == "APPROVED" {
-			approvals++
-		}
-	}
+	// The base branch decides which policy applies
+	policy := rb.mergePolicy(pr.GetBase().GetRef())
+	span.SetAttributes(attribute.String("merge.policy", policy.Name))
+	
+	// Every unmet condition is reported, not just the first
+	var blockers []string
 	
-	if approvals < rb.config.MinReviewers {
-		return false, fmt.Sprintf("Need %d approvals, have %d", rb.config.MinReviewers, approvals)
+	// Nothing merges during a freeze unless it is overridden
+	if freeze, frozen := rb.frozen(owner+"/"+repo, pr, time.Now()); frozen {
+		blockers = append(blockers, freeze.reason())
 	}
 	
-	// Check required status checks
-	pr, _, err := rb.client.PullRequests.Get(ctx, owner, repo, prNumber)
+	// Check required reviewers
+	reviews, err := rb.listReviews(ctx, owner, repo, prNumber)
 	if err != nil {
-		return false, fmt.Sprintf("Failed to get PR: %v", err)
+		return MergeVerdict{Reason: fmt.Sprintf("Failed to get reviews: %v", err)}
+	}
+	verdict.StaleApprovals = staleApprovals(reviews, pr.GetHead().GetSHA())
+	
+	// Each reviewer counts once, by their latest verdict
+	approvals := approvalCount(reviews)
+	
+	if approvals < policy.MinReviewers {
+		blockers = append(blockers, fmt.Sprintf("Need %d approvals, have %d (%s policy)", policy.MinReviewers, approvals, policy.Name))
 	}
 	
+	// Blocking labels, WIP titles and open review threads
+	blockers = append(blockers, rb.mergeBlockers(ctx, owner, repo, pr)...)
+	
+	// Check required status checks
 	if pr.GetHead().GetSHA() == "" {
-		return false, "No SHA available for status checks"
+		blockers = append(blockers, "No SHA available for status checks")
 	}
 	
-	return true, "All merge policies satisfied"
+	if len(blockers) > 0 {
+		verdict.Blockers = blockers
+		verdict.Reason = strings.Join(blockers, reasonSeparator)
+		return verdict
+	}
+	verdict.CanMerge = true
+	verdict.Reason = fmt.Sprintf("All merge policies satisfied (%s policy)", policy.Name)
+	return verdict
 }
 
-func (rb *ReviewBot) updatePRStatus(ctx context.Context, owner, repo string, prNumber int, checks []CheckResult, canMerge bool, reason string) {
+func (rb *ReviewBot) updatePRStatus(ctx context.Context, owner, repo string, prNumber int, checks []CheckResult, verdict MergeVerdict) {
+	ctx, span := tracer().Start(ctx, "updatePRStatus", trace.WithAttributes(prAttributes(owner, repo, prNumber)...))
+	defer span.End()
+
 	status := "pending"
 	description := "Automated checks in progress"
 	
-	if canMerge {
+	if verdict.CanMerge {
 		allPassed := true
 		for _, check := range checks {
 			if check.Status == "failure" {
@@ -400,7 +590,7 @@ func (rb *ReviewBot) updatePRStatus(ctx context.Context, owner, repo string, prN
 		}
 	} else {
 		status = "pending"
-		description = reason
+		description = verdict.statusDescription()
 	}
 	
 	// Create a status check
@@ -418,22 +608,19 @@ func (rb *ReviewBot) updatePRStatus(ctx context.Context, owner, repo string, prN
 	
 	_, _, err = rb.client.Repositories.CreateStatus(ctx, owner, repo, pr.GetHead().GetSHA(), repoStatus)
 	if err != nil {
+		span.RecordError(err)
 		log.Printf("Failed to create status: %v", err)
 	}
 	
-	// Comment on PR with detailed results
-	comment := rb.generateCommentBody(checks, canMerge, reason)
-	prComment := &github.IssueComment{
-		Body: github.String(comment),
-	}
-	
-	_, _, err = rb.client.Issues.CreateComment(ctx, owner, repo, prNumber, prComment)
-	if err != nil {
-		log.Printf("Failed to create comment: %v", err)
+	// Keep the summary comment on the PR up to date with detailed results
+	comment := rb.summaryBody(owner+"/"+repo, prNumber, checks, verdict)
+	if err := rb.upsertSummaryComment(ctx, owner, repo, prNumber, comment); err != nil {
+		span.RecordError(err)
+		log.Printf("Failed to update summary comment: %v", err)
 	}
 }
 
-func (rb *ReviewBot) generateCommentBody(checks []CheckResult, canMerge bool, reason string) string {
+func (rb *ReviewBot) generateCommentBody(checks []CheckResult, verdict MergeVerdict) string {
 	var comment strings.Builder
 	
 	comment.WriteString("## 🤖 Automated Review Results\n\n")
@@ -453,65 +640,108 @@ func (rb *ReviewBot) generateCommentBody(checks []CheckResult, canMerge bool, re
 		}
 		
 		comment.WriteString(fmt.Sprintf("- %s **%s**: %s (%s)\n", emoji, check.Name, check.Message, check.Time))
+		for _, detail := range check.Details {
+			comment.WriteString("  - " + detail + "\n")
+		}
+	}
+	
+	for _, check := range checks {
+		if check.Table == nil || len(check.Table.Rows) == 0 {
+			continue
+		}
+		comment.WriteString(fmt.Sprintf("\n#### %s\n\n", check.Name))
+		comment.WriteString("| " + strings.Join(check.Table.Header, " | ") + " |\n")
+		comment.WriteString(strings.Repeat("| --- ", len(check.Table.Header)) + "|\n")
+		for _, row := range check.Table.Rows {
+			comment.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		}
 	}
 	
 	comment.WriteString("\n### Merge Status:\n")
-	if canMerge {
-		comment.WriteString("✅ **Ready to merge** - " + reason + "\n")
+	if verdict.CanMerge {
+		comment.WriteString("✅ **Ready to merge** - " + verdict.Reason + "\n")
+	} else if len(verdict.Blockers) > 1 {
+		comment.WriteString("⏳ **Not ready to merge**:\n")
+		for _, blocker := range verdict.Blockers {
+			comment.WriteString("- " + blocker + "\n")
+		}
 	} else {
-		comment.WriteString("⏳ **Not ready to merge** - " + reason + "\n")
+		comment.WriteString("⏳ **Not ready to merge** - " + verdict.Reason + "\n")
 	}
 	
-	comment.WriteString("\n---\n*This comment was generated automatically by the Review Bot*")
+	comment.WriteString(commentFooter)
 	
 	return comment.String()
 }
 
-func (rb *ReviewBot) sendToThirdPartyServices(owner, repo string, prNumber int, checks []CheckResult, processingTime time.Duration) {
-	// Simulate third-party service integration
+// reasonSeparator joins the conditions blocking a merge into one reason.
+const reasonSeparator = "; "
+
+// maxStatusDescription is the longest commit status description GitHub
+// accepts.
+const maxStatusDescription = 140
+
+// statusDescription sums up a blocked verdict for the commit status; the
+// summary comment lists the blockers in full.
+func (v MergeVerdict) statusDescription() string {
+	if len(v.Blockers) > 1 {
+		return fmt.Sprintf("%d conditions block merge", len(v.Blockers))
+	}
+	return truncate(v.Reason, maxStatusDescription)
+}
+
+const commentFooter = "\n---\n*This comment was generated automatically by the Review Bot*"
+
+func (rb *ReviewBot) sendToThirdPartyServices(owner, repo string, prNumber int, checks []CheckResult, processingTime time.Duration, change EvaluationChange) {
 	webhookData := PRStats{
 		PRNumber:       prNumber,
+		Repository:     owner + "/" + repo,
 		ProcessingTime: processingTime.String(),
 		ChecksRun:      checks,
 		ReviewersCount: rb.config.MinReviewers,
 		Status:         "processed",
-		ThirdPartyHooks: map[string]interface{}{
-			"slack_notification": map[string]interface{}{
-				"channel": "#code-reviews",
-				"message": fmt.Sprintf("PR #%d in %s/%s processed in %v", prNumber, owner, repo, processingTime),
-			},
-			"jira_integration": map[string]interface{}{
-				"update_ticket": true,
-				"ticket_id":      fmt.Sprintf("PROJ-%d", prNumber),
-			},
-		},
 	}
 	
-	// Send to external webhook (simulate)
-	go func() {
-		webhookURL := os.Getenv("THIRD_PARTY_WEBHOOK_URL")
-		if webhookURL == "" {
-			return
-		}
-		
-		jsonData, err := json.Marshal(webhookData)
-		if err != nil {
-			log.Printf("Failed to marshal webhook data: %v", err)
-			return
-		}
-		
-		resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(jsonData))
-		if err != nil {
-			log.Printf("Failed to send webhook: %v", err)
-			return
-		}
-		defer resp.Body.Close()
-		
-		log.Printf("Webhook sent successfully for PR #%d", prNumber)
-	}()
+	// Delivery happens from the outbox worker, which retries with backoff
+	rb.publish(EventPRProcessed, owner, repo, webhookData)
+	rb.notify(change)
+}
+
+// recordEvaluation stores the latest verdict for pr, tells webhook
+// subscribers and Jira what changed since the previous one and returns the
+// change for chat notifications. labels is what autolabel did on this run.
+func (rb *ReviewBot) recordEvaluation(ctx context.Context, owner, repo string, pr *github.PullRequest, checks []CheckResult, labels LabelChange, verdict MergeVerdict) EvaluationChange {
+	current := Evaluation{
+		Repository:    owner + "/" + repo,
+		PRNumber:      pr.GetNumber(),
+		Title:         pr.GetTitle(),
+		URL:           pr.GetHTMLURL(),
+		Author:        pr.GetUser().GetLogin(),
+		HeadSHA:       pr.GetHead().GetSHA(),
+		Checks:        checks,
+		CanMerge:       verdict.CanMerge,
+		Reason:         verdict.Reason,
+		Blockers:       verdict.Blockers,
+		StaleApprovals: verdict.StaleApprovals,
+		EvaluatedAt:    time.Now().UTC(),
+		LabelsAdded:    labels.Added,
+		LabelsRemoved:  labels.Removed,
+	}
+	
+	previous, hadPrevious := rb.evaluations.Record(current)
+	if len(checks) == 0 {
+		current.Checks = previous.Checks
+	}
+	change := EvaluationChange{Current: current, Previous: previous, HadPrevious: hadPrevious}
+	rb.publishEvaluation(owner, repo, change)
+	
+	if current.mergeReady() && (!hadPrevious || !previous.mergeReady()) {
+		rb.syncJira(ctx, owner, repo, pr, JiraMergeReady)
+	}
+	return change
 }
 
-func (rb *ReviewBot) handleCheckRunEvent(event *github.CheckRunEvent, startTime time.Time) {
+func (rb *ReviewBot) handleCheckRunEvent(ctx context.Context, event *github.CheckRunEvent, startTime time.Time) {
 	log.Printf("Check run event: %s - %s", event.GetCheckRun().GetName(), event.GetCheckRun().GetStatus())
 	
 	processingTime := time.Since(startTime)
@@ -520,21 +750,62 @@ func (rb *ReviewBot) handleCheckRunEvent(event *github.CheckRunEvent, startTime
 	rb.stats.mu.Unlock()
 }
 
-func (rb *ReviewBot) handleReviewEvent(event *github.PullRequestReviewEvent, startTime time.Time) {
+func (rb *ReviewBot) handleReviewEvent(ctx context.Context, event *github.PullRequestReviewEvent, startTime time.Time) {
 	log.Printf("Review event: %s - %s", event.GetReview().GetState(), event.GetReview().GetUser().GetLogin())
 	
 	// Re-evaluate merge policy when new review is submitted
 	if event.GetAction() == "submitted" {
-		ctx := context.Background()
 		owner := event.GetRepo().GetOwner().GetLogin()
 		repo := event.GetRepo().GetName()
-		prNumber := event.GetPullRequest().GetNumber()
 		
-		canMerge, reason := rb.checkMergePolicy(ctx, owner, repo, prNumber)
-		rb.updatePRStatus(ctx, owner, repo, prNumber, []CheckResult{}, canMerge, reason)
+		rb.reevaluate(ctx, owner, repo, event.GetPullRequest())
 	}
 }
 
+// reevaluate re-checks the merge policy of pr without rerunning its checks
+// and updates its status, e.g. after a review or when a freeze ends.
+func (rb *ReviewBot) reevaluate(ctx context.Context, owner, repo string, pr *github.PullRequest) {
+	prNumber := pr.GetNumber()
+	verdict := rb.checkMergePolicy(ctx, owner, repo, prNumber)
+	change := rb.recordEvaluation(ctx, owner, repo, pr, nil, LabelChange{}, verdict)
+	// The summary keeps the results of the last check run
+	rb.updatePRStatus(ctx, owner, repo, prNumber, change.Current.Checks, verdict)
+	rb.notify(change)
+	rb.maybeAutoMerge(ctx, owner, repo, pr, change.Current)
+}
+
+// rerunChecks runs just the named checks again, keeping the other results
+// of the last run, and re-evaluates pr with them. Without results for the
+// current head every check runs.
+func (rb *ReviewBot) rerunChecks(ctx context.Context, owner, repo string, pr *github.PullRequest, names []string) {
+	var checks []CheckResult
+	if eval, ok := rb.evaluations.Get(owner+"/"+repo, pr.GetNumber()); ok && eval.HeadSHA == pr.GetHead().GetSHA() {
+		checks = append(checks, eval.Checks...)
+	} else {
+		checks, names = rb.runAutomatedChecks(ctx, owner, repo, pr), nil
+	}
+	for _, name := range names {
+		startTime := time.Now()
+		result := rb.runSpecificCheck(ctx, owner, repo, pr, name)
+		result.Time = time.Since(startTime).String()
+		replaced := false
+		for i := range checks {
+			if checks[i].Name == result.Name {
+				checks[i], replaced = result, true
+			}
+		}
+		if !replaced {
+			checks = append(checks, result)
+		}
+	}
+	
+	verdict := rb.checkMergePolicy(ctx, owner, repo, pr.GetNumber())
+	change := rb.recordEvaluation(ctx, owner, repo, pr, checks, LabelChange{}, verdict)
+	rb.updatePRStatus(ctx, owner, repo, pr.GetNumber(), checks, verdict)
+	rb.notify(change)
+	rb.maybeAutoMerge(ctx, owner, repo, pr, change.Current)
+}
+
 func (rb *ReviewBot) handleStats(w http.ResponseWriter, r *http.Request) {
 	rb.stats.mu.RLock()
 	defer rb.stats.mu.RUnlock()
@@ -565,11 +836,28 @@ func (rb *ReviewBot) calculateAverageProcessingTime() string {
 	return average.String()
 }
 
+// requireAdmin guards operator endpoints with the ADMIN_TOKEN bearer token.
+// They are disabled entirely when no token is configured.
+func (rb *ReviewBot) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rb.config.AdminToken == "" {
+			http.Error(w, "Admin API disabled", http.StatusForbidden)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(rb.config.AdminToken)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func (rb *ReviewBot) handleHealth(w http.ResponseWriter, r *http.Request) {
 	health := map[string]interface{}{
 		"status":    "healthy",
 		"timestamp": time.Now().UTC(),
-		"version":   "1.0.0",
+		"version":   version,
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -585,12 +873,34 @@ func main() {
 		log.Fatal("GITHUB_TOKEN environment variable is required")
 	}
 	
+	settings, err := LoadSettings(config.ConfigFile)
+	if err != nil {
+		log.Fatalf("Failed to load settings: %v", err)
+	}
+	config.Settings = settings
+	
+	shutdownTracing, err := initTracing(context.Background(), config)
+	if err != nil {
+		log.Fatalf("Failed to initialise tracing: %v", err)
+	}
+	
 	bot := NewReviewBot(config)
 	
 	r := mux.NewRouter()
 	r.HandleFunc("/webhook", bot.handleWebhook).Methods("POST")
 	r.HandleFunc("/stats", bot.handleStats).Methods("GET")
 	r.HandleFunc("/health", bot.handleHealth).Methods("GET")
+	r.HandleFunc("/queue", bot.handleMergeQueue).Methods("GET")
+	r.HandleFunc("/freezes", bot.handleFreezes).Methods("GET")
+	r.HandleFunc("/admin/outbox/failed", bot.requireAdmin(bot.handleOutboxFailed)).Methods("GET")
+	r.HandleFunc("/admin/outbox/{id}/redeliver", bot.requireAdmin(bot.handleOutboxRedeliver)).Methods("POST")
+	r.HandleFunc("/admin/digest", bot.requireAdmin(bot.handleSendDigest)).Methods("POST")
+	r.HandleFunc("/admin/stale", bot.requireAdmin(bot.handleStaleScan)).Methods("POST")
+	r.HandleFunc("/admin/queue/{owner}/{repo}/{number}", bot.requireAdmin(bot.handleMergeQueueRemove)).Methods("DELETE")
+	r.HandleFunc("/admin/freezes", bot.requireAdmin(bot.handleStartFreeze)).Methods("POST")
+	r.HandleFunc("/admin/freezes/audit", bot.requireAdmin(bot.handleFreezeAudit)).Methods("GET")
+	r.HandleFunc("/admin/freezes/{id}", bot.requireAdmin(bot.handleStopFreeze)).Methods("DELETE")
+	r.HandleFunc("/admin/shadow", bot.requireAdmin(bot.handleShadow)).Methods("GET")
 	
 	// Serve static files for dashboard
 	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
@@ -600,5 +910,41 @@ func main() {
 	log.Printf("Stats endpoint: http://localhost:%s/stats", config.Port)
 	log.Printf("Health endpoint: http://localhost:%s/health", config.Port)
 	
-	log.Fatal(http.ListenAndServe(":"+config.Port, r))
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go bot.outbox.Run(workerCtx)
+	go bot.runMergeQueue(workerCtx)
+	go bot.watchFreezes(workerCtx)
+	
+	scheduler, err := bot.newScheduler(workerCtx)
+	if err != nil {
+		log.Fatalf("Failed to set up scheduler: %v", err)
+	}
+	scheduler.Start()
+	
+	srv := &http.Server{Addr: ":" + config.Port, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	
+	log.Printf("Shutting down Review Bot server")
+	stopWorkers()
+	<-scheduler.Stop().Done()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+	if err := bot.waitInFlight(ctx); err != nil {
+		log.Printf("Abandoning webhook processing still in flight: %v", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Tracing shutdown error: %v", err)
+	}
 }
\ No newline at end of file
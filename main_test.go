@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
 	"time"
@@ -19,11 +20,36 @@ func TestMain(m *testing.M) {
 	os.Setenv("GITHUB_TOKEN", "test-token")
 	os.Setenv("WEBHOOK_SECRET", "test-secret")
 	os.Setenv("PORT", "8080")
+	os.Setenv("BOT_LOGIN", "review-bot")
+	
+	dataDir, err := os.MkdirTemp("", "review-bot-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("DATA_DIR", dataDir)
 	
 	code := m.Run()
+	os.RemoveAll(dataDir)
 	os.Exit(code)
 }
 
+// newTestBot returns a bot whose GitHub client talks to handler instead of
+// api.github.com.
+func newTestBot(t *testing.T, handler http.Handler) *ReviewBot {
+	t.Helper()
+	
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	
+	bot := NewReviewBot(NewConfig())
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.client.BaseURL = baseURL
+	return bot
+}
+
 func TestNewConfig(t *testing.T) {
 	config := NewConfig()
 	
@@ -128,7 +154,7 @@ func TestGenerateCommentBody(t *testing.T) {
 		{Name: "build", Status: "failure", Message: "Build failed", Time: "200ms"},
 	}
 	
-	comment := bot.generateCommentBody(checks, true, "All policies satisfied")
+	comment := bot.generateCommentBody(checks, MergeVerdict{CanMerge: true, Reason: "All policies satisfied"})
 	
 	if !bytes.Contains([]byte(comment), []byte("Automated Review Results")) {
 		t.Error("Expected comment to contain 'Automated Review Results'")
@@ -254,6 +280,38 @@ func TestWebhookHandler(t *testing.T) {
 	}
 }
 
+func TestWebhookAcknowledgedBeforeProcessing(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.NewServeMux()
+	handler.HandleFunc("/repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"number":1,"head":{"sha":"abc123"}}`))
+	})
+	bot := newTestBot(t, handler)
+	bot.config.RequiredChecks = nil
+	
+	payload := `{"action":"opened","number":1,"pull_request":{"number":1,"head":{"sha":"abc123"}},"repository":{"name":"repo","owner":{"login":"owner"}}}`
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	
+	rr := httptest.NewRecorder()
+	bot.handleWebhook(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bot.waitInFlight(ctx); err == nil {
+		t.Error("Expected processing to still be in flight")
+	}
+	close(release)
+	if err := bot.waitInFlight(context.Background()); err != nil {
+		t.Errorf("Expected processing to finish, got %v", err)
+	}
+}
+
 func TestCalculateAverageProcessingTime(t *testing.T) {
 	config := NewConfig()
 	bot := NewReviewBot(config)
@@ -304,6 +362,6 @@ func BenchmarkGenerateCommentBody(b *testing.B) {
 	
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		bot.generateCommentBody(checks, true, "All policies satisfied")
+		bot.generateCommentBody(checks, MergeVerdict{CanMerge: true, Reason: "All policies satisfied"})
 	}
 }
\ No newline at end of file
@@ -0,0 +1,659 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Merge queue modes.
+const (
+	QueueMergeBranch = "merge-branch"
+	QueueUpdate      = "update"
+)
+
+// Merge queue entry states and outcomes.
+const (
+	QueueQueued  = "queued"
+	QueueTesting = "testing"
+	QueueMerged  = "merged"
+	QueueEjected = "ejected"
+	// QueueShadowed is the outcome of a PR that passed the queue in shadow
+	// mode, where the merge is only recorded.
+	QueueShadowed = "shadowed"
+)
+
+const (
+	mergeQueueStoreName = "merge_queue"
+	queueHistoryLimit   = 50
+)
+
+// MergeQueueSettings configures the merge queue. When enabled, PRs that
+// auto-merge would merge join a queue per base branch instead and are
+// merged one at a time. Before merging, the required checks run again
+// against the latest base: in "merge-branch" mode (the default) on a
+// temporary branch named BranchPrefix plus the PR number holding the base
+// with the PR merged in, in "update" mode on the PR itself after merging
+// the base into it. PRs whose checks fail or that no longer merge cleanly
+// are ejected. UpdateTimeout bounds how long "update" mode waits for GitHub
+// to update the branch.
+type MergeQueueSettings struct {
+	Enabled       bool   `json:"enabled"`
+	Mode          string `json:"mode"`
+	BranchPrefix  string `json:"branch_prefix"`
+	UpdateTimeout string `json:"update_timeout"`
+}
+
+func (s MergeQueueSettings) validate() error {
+	switch s.Mode {
+	case "", QueueMergeBranch, QueueUpdate:
+	default:
+		return fmt.Errorf("unknown mode %q", s.Mode)
+	}
+	if s.UpdateTimeout != "" {
+		if _, err := time.ParseDuration(s.UpdateTimeout); err != nil {
+			return fmt.Errorf("update_timeout: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s MergeQueueSettings) mode() string {
+	if s.Mode != "" {
+		return s.Mode
+	}
+	return QueueMergeBranch
+}
+
+func (s MergeQueueSettings) branchPrefix() string {
+	if s.BranchPrefix != "" {
+		return s.BranchPrefix
+	}
+	return "review-bot/queue/"
+}
+
+func (s MergeQueueSettings) updateTimeout() time.Duration {
+	if d, err := time.ParseDuration(s.UpdateTimeout); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// QueueEntry is a PR waiting in, or being tested by, the merge queue.
+type QueueEntry struct {
+	Repository string    `json:"repository"`
+	Base       string    `json:"base"`
+	PRNumber   int       `json:"pr_number"`
+	Title      string    `json:"title"`
+	HeadSHA    string    `json:"head_sha"`
+	State      string    `json:"state"`
+	TestSHA    string    `json:"test_sha,omitempty"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+func (e QueueEntry) queue() string {
+	return e.Repository + ":" + e.Base
+}
+
+// QueueOutcome records how a PR left the queue.
+type QueueOutcome struct {
+	Repository string    `json:"repository"`
+	Base       string    `json:"base"`
+	PRNumber   int       `json:"pr_number"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// MergeQueue holds the queued PRs, in order, for every repository and base
+// branch. It is persisted so a restart resumes where it left off.
+type MergeQueue struct {
+	mu      sync.Mutex
+	store   *Store
+	entries []*QueueEntry
+	history []QueueOutcome
+	wake    chan struct{}
+	now     func() time.Time
+
+	PollInterval time.Duration
+}
+
+type mergeQueueState struct {
+	Entries []*QueueEntry  `json:"entries"`
+	History []QueueOutcome `json:"history"`
+}
+
+func NewMergeQueue(store *Store) *MergeQueue {
+	mq := &MergeQueue{
+		store:        store,
+		wake:         make(chan struct{}, 1),
+		now:          time.Now,
+		PollInterval: 30 * time.Second,
+	}
+	var saved mergeQueueState
+	if err := store.Load(mergeQueueStoreName, &saved); err != nil {
+		log.Printf("Failed to load merge queue: %v", err)
+	}
+	mq.entries, mq.history = saved.Entries, saved.History
+	// An entry mid-test when the process stopped starts over
+	for _, entry := range mq.entries {
+		entry.State, entry.TestSHA = QueueQueued, ""
+	}
+	return mq
+}
+
+// Enqueue adds a PR to the back of its queue, or refreshes its head if it
+// is already queued. It returns the PR's 1-based position.
+func (mq *MergeQueue) Enqueue(entry QueueEntry) int {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	if existing := mq.findLocked(entry.Repository, entry.PRNumber); existing != nil {
+		if existing.HeadSHA != entry.HeadSHA {
+			existing.HeadSHA, existing.Title = entry.HeadSHA, entry.Title
+			existing.State, existing.TestSHA = QueueQueued, ""
+			mq.saveLocked()
+		}
+		pos, _ := mq.positionLocked(existing)
+		return pos
+	}
+
+	entry.State = QueueQueued
+	entry.EnqueuedAt = mq.now().UTC()
+	mq.entries = append(mq.entries, &entry)
+	mq.saveLocked()
+	mq.notify()
+	pos, _ := mq.positionLocked(&entry)
+	return pos
+}
+
+// Remove takes a PR out of the queue, recording outcome and reason. It
+// reports whether the PR was queued.
+func (mq *MergeQueue) Remove(repository string, prNumber int, outcome, reason string) bool {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	for i, entry := range mq.entries {
+		if entry.Repository != repository || entry.PRNumber != prNumber {
+			continue
+		}
+		mq.entries = append(mq.entries[:i], mq.entries[i+1:]...)
+		mq.history = append(mq.history, QueueOutcome{
+			Repository: repository,
+			Base:       entry.Base,
+			PRNumber:   prNumber,
+			Outcome:    outcome,
+			Reason:     reason,
+			At:         mq.now().UTC(),
+		})
+		if len(mq.history) > queueHistoryLimit {
+			mq.history = mq.history[len(mq.history)-queueHistoryLimit:]
+		}
+		mq.saveLocked()
+		mq.notify()
+		return true
+	}
+	return false
+}
+
+// Get returns the queued entry for a PR and its position among n entries
+// in the same queue.
+func (mq *MergeQueue) Get(repository string, prNumber int) (entry QueueEntry, position, n int, ok bool) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	e := mq.findLocked(repository, prNumber)
+	if e == nil {
+		return QueueEntry{}, 0, 0, false
+	}
+	position, n = mq.positionLocked(e)
+	return *e, position, n, true
+}
+
+// LastOutcome returns the most recent way the PR left the queue.
+func (mq *MergeQueue) LastOutcome(repository string, prNumber int) (QueueOutcome, bool) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	for i := len(mq.history) - 1; i >= 0; i-- {
+		if mq.history[i].Repository == repository && mq.history[i].PRNumber == prNumber {
+			return mq.history[i], true
+		}
+	}
+	return QueueOutcome{}, false
+}
+
+// heads returns the first entry of every queue.
+func (mq *MergeQueue) heads() []QueueEntry {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var heads []QueueEntry
+	for _, entry := range mq.entries {
+		if !seen[entry.queue()] {
+			seen[entry.queue()] = true
+			heads = append(heads, *entry)
+		}
+	}
+	return heads
+}
+
+func (mq *MergeQueue) setState(repository string, prNumber int, state, testSHA, headSHA string) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	if entry := mq.findLocked(repository, prNumber); entry != nil {
+		entry.State, entry.TestSHA = state, testSHA
+		if headSHA != "" {
+			entry.HeadSHA = headSHA
+		}
+		mq.saveLocked()
+	}
+}
+
+func (mq *MergeQueue) findLocked(repository string, prNumber int) *QueueEntry {
+	for _, entry := range mq.entries {
+		if entry.Repository == repository && entry.PRNumber == prNumber {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (mq *MergeQueue) positionLocked(target *QueueEntry) (int, int) {
+	position, n := 0, 0
+	for _, entry := range mq.entries {
+		if entry.queue() != target.queue() {
+			continue
+		}
+		n++
+		if entry == target {
+			position = n
+		}
+	}
+	return position, n
+}
+
+func (mq *MergeQueue) notify() {
+	select {
+	case mq.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (mq *MergeQueue) saveLocked() {
+	state := mergeQueueState{Entries: mq.entries, History: mq.history}
+	if err := mq.store.Save(mergeQueueStoreName, state); err != nil {
+		log.Printf("Failed to persist merge queue: %v", err)
+	}
+}
+
+// runMergeQueue processes the queues until ctx is cancelled.
+func (rb *ReviewBot) runMergeQueue(ctx context.Context) {
+	ticker := time.NewTicker(rb.mergeQueue.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		rb.processMergeQueue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-rb.mergeQueue.wake:
+		}
+	}
+}
+
+// processMergeQueue tests and merges (or ejects) the head of every queue.
+func (rb *ReviewBot) processMergeQueue(ctx context.Context) {
+	for _, entry := range rb.mergeQueue.heads() {
+		if ctx.Err() != nil {
+			return
+		}
+		rb.processQueueEntry(ctx, entry)
+	}
+}
+
+func (rb *ReviewBot) processQueueEntry(ctx context.Context, entry QueueEntry) {
+	owner, repo, _ := strings.Cut(entry.Repository, "/")
+	ctx, span := tracer().Start(ctx, "processQueueEntry", trace.WithAttributes(prAttributes(owner, repo, entry.PRNumber)...))
+	defer span.End()
+
+	outcome, reason, err := rb.testAndMerge(ctx, owner, repo, entry)
+	if err != nil {
+		// Transient trouble talking to GitHub; try again on the next pass
+		recordSpanError(span, err)
+		log.Printf("Merge queue: %s#%d: %v", entry.Repository, entry.PRNumber, err)
+		rb.mergeQueue.setState(entry.Repository, entry.PRNumber, QueueQueued, "", "")
+		return
+	}
+	if outcome == "" {
+		return
+	}
+
+	rb.mergeQueue.Remove(entry.Repository, entry.PRNumber, outcome, reason)
+	ejected := outcome == QueueEjected
+	if reason != "" {
+		outcome += ": " + reason
+	}
+	log.Printf("Merge queue: %s#%d %s", entry.Repository, entry.PRNumber, outcome)
+	if ejected {
+		body := fmt.Sprintf("🚫 Removed from the merge queue: %s", reason)
+		if _, _, err := rb.client.Issues.CreateComment(ctx, owner, repo, entry.PRNumber, &github.IssueComment{Body: github.String(body)}); err != nil {
+			log.Printf("Failed to comment on %s#%d: %v", entry.Repository, entry.PRNumber, err)
+		}
+	}
+	rb.refreshQueuePositions(ctx, entry.Repository, entry.Base, entry.PRNumber)
+}
+
+// testAndMerge reruns the required checks for entry against the latest
+// base and merges it if they pass. An empty outcome means the entry stays
+// queued (e.g. the base moved and it needs another run).
+func (rb *ReviewBot) testAndMerge(ctx context.Context, owner, repo string, entry QueueEntry) (outcome, reason string, err error) {
+	pr, _, err := rb.client.PullRequests.Get(ctx, owner, repo, entry.PRNumber)
+	if err != nil {
+		return "", "", err
+	}
+	if pr.GetState() != "open" {
+		return QueueEjected, "the pull request was closed.", nil
+	}
+	if pr.GetHead().GetSHA() != entry.HeadSHA {
+		return QueueEjected, "new commits were pushed; it will rejoin the queue once they pass.", nil
+	}
+	if pr.GetBase().GetRef() != entry.Base {
+		return QueueEjected, fmt.Sprintf("the base branch changed to `%s`.", pr.GetBase().GetRef()), nil
+	}
+	if _, frozen := rb.frozen(entry.Repository, pr, time.Now()); frozen {
+		// Keep its place until the freeze ends
+		return "", "", nil
+	}
+
+	branch, _, err := rb.client.Repositories.GetBranch(ctx, owner, repo, entry.Base, 0)
+	if err != nil {
+		return "", "", err
+	}
+	baseSHA := branch.GetCommit().GetSHA()
+
+	settings := rb.config.Settings.MergeQueue
+	var testSHA string
+	switch settings.mode() {
+	case QueueUpdate:
+		testSHA, reason, err = rb.updateQueuedBranch(ctx, owner, repo, pr, baseSHA)
+	default:
+		testSHA, reason, err = rb.prepareMergeBranch(ctx, owner, repo, entry, baseSHA)
+		defer rb.deleteMergeBranch(owner, repo, entry)
+	}
+	if err != nil || reason != "" {
+		return QueueEjected, reason, err
+	}
+
+	rb.mergeQueue.setState(entry.Repository, entry.PRNumber, QueueTesting, testSHA, pr.GetHead().GetSHA())
+	rb.refreshSummary(ctx, owner, repo, entry.PRNumber)
+
+	tested := *pr
+	tested.Head = &github.PullRequestBranch{Ref: pr.GetHead().Ref, SHA: github.String(testSHA), Repo: pr.GetHead().Repo}
+	var failed []string
+	for _, check := range rb.runAutomatedChecks(ctx, owner, repo, &tested) {
+		if check.Status == "failure" || check.Status == "error" {
+			failed = append(failed, fmt.Sprintf("**%s** (%s)", check.Name, check.Message))
+		}
+	}
+	if len(failed) > 0 {
+		return QueueEjected, fmt.Sprintf("checks failed against the latest `%s`: %s.", entry.Base, strings.Join(failed, ", ")), nil
+	}
+	if verdict := rb.checkMergePolicy(ctx, owner, repo, entry.PRNumber); !verdict.CanMerge {
+		return QueueEjected, verdict.Reason + ".", nil
+	}
+
+	// Someone merged around the queue; what we tested is out of date
+	branch, _, err = rb.client.Repositories.GetBranch(ctx, owner, repo, entry.Base, 0)
+	if err != nil {
+		return "", "", err
+	}
+	if branch.GetCommit().GetSHA() != baseSHA {
+		rb.mergeQueue.setState(entry.Repository, entry.PRNumber, QueueQueued, "", "")
+		return "", "", nil
+	}
+
+	method := rb.config.Settings.AutoMerge.method()
+	opts := &github.PullRequestOptions{MergeMethod: method, SHA: pr.GetHead().GetSHA()}
+	if settings.mode() == QueueUpdate {
+		opts.SHA = testSHA
+	}
+	if _, _, err := rb.client.PullRequests.Merge(ctx, owner, repo, entry.PRNumber, "", opts); err != nil {
+		return QueueEjected, mergeFailureReason(pr, err), nil
+	}
+	if rb.shadowed(entry.Repository) {
+		return QueueShadowed, "shadow mode: the merge was only recorded.", nil
+	}
+	if rb.config.Settings.AutoMerge.DeleteBranch && pr.GetHead().GetRepo().GetFullName() == pr.GetBase().GetRepo().GetFullName() {
+		if _, err := rb.client.Git.DeleteRef(ctx, owner, repo, "heads/"+pr.GetHead().GetRef()); err != nil && !isNotFound(err) {
+			log.Printf("Failed to delete branch %s after merging %s#%d: %v", pr.GetHead().GetRef(), entry.Repository, entry.PRNumber, err)
+		}
+	}
+	return QueueMerged, "", nil
+}
+
+func (rb *ReviewBot) mergeBranchName(entry QueueEntry) string {
+	return rb.config.Settings.MergeQueue.branchPrefix() + strconv.Itoa(entry.PRNumber)
+}
+
+// prepareMergeBranch points the entry's temporary branch at baseSHA and
+// merges the PR head into it, returning the merge commit. A non-empty
+// reason means the PR doesn't merge cleanly.
+func (rb *ReviewBot) prepareMergeBranch(ctx context.Context, owner, repo string, entry QueueEntry, baseSHA string) (string, string, error) {
+	branch := rb.mergeBranchName(entry)
+	ref := &github.Reference{Ref: github.String("refs/heads/" + branch), Object: &github.GitObject{SHA: github.String(baseSHA)}}
+	if _, _, err := rb.client.Git.GetRef(ctx, owner, repo, "heads/"+branch); err == nil {
+		if _, _, err := rb.client.Git.UpdateRef(ctx, owner, repo, ref, true); err != nil {
+			return "", "", fmt.Errorf("resetting %s: %w", branch, err)
+		}
+	} else if isNotFound(err) {
+		if _, _, err := rb.client.Git.CreateRef(ctx, owner, repo, ref); err != nil {
+			return "", "", fmt.Errorf("creating %s: %w", branch, err)
+		}
+	} else {
+		return "", "", err
+	}
+
+	commit, _, err := rb.client.Repositories.Merge(ctx, owner, repo, &github.RepositoryMergeRequest{
+		Base:          github.String(branch),
+		Head:          github.String(entry.HeadSHA),
+		CommitMessage: github.String(fmt.Sprintf("Merge queue: test #%d on %s", entry.PRNumber, entry.Base)),
+	})
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusConflict {
+		return "", fmt.Sprintf("it has merge conflicts with the latest `%s`.", entry.Base), nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("merging into %s: %w", branch, err)
+	}
+	if commit.GetSHA() == "" {
+		if rb.shadowed(entry.Repository) {
+			// The branch and merge were only recorded; test the head as is
+			return entry.HeadSHA, "", nil
+		}
+		// 204: the base already contains the head
+		return baseSHA, "", nil
+	}
+	return commit.GetSHA(), "", nil
+}
+
+func (rb *ReviewBot) deleteMergeBranch(owner, repo string, entry QueueEntry) {
+	branch := rb.mergeBranchName(entry)
+	if _, err := rb.client.Git.DeleteRef(context.Background(), owner, repo, "heads/"+branch); err != nil && !isNotFound(err) {
+		log.Printf("Failed to delete merge queue branch %s in %s: %v", branch, entry.Repository, err)
+	}
+}
+
+// updateQueuedBranch merges the base into the PR branch if it is behind and
+// waits for GitHub to report the new head, which it returns.
+func (rb *ReviewBot) updateQueuedBranch(ctx context.Context, owner, repo string, pr *github.PullRequest, baseSHA string) (string, string, error) {
+	head := pr.GetHead().GetSHA()
+	comparison, _, err := rb.client.Repositories.CompareCommits(ctx, owner, repo, baseSHA, head, nil)
+	if err != nil {
+		return "", "", err
+	}
+	if comparison.GetBehindBy() == 0 {
+		return head, "", nil
+	}
+
+	opts := &github.PullRequestBranchUpdateOptions{ExpectedHeadSHA: github.String(head)}
+	if _, _, err := rb.client.PullRequests.UpdateBranch(ctx, owner, repo, pr.GetNumber(), opts); err != nil {
+		var accepted *github.AcceptedError
+		if !errors.As(err, &accepted) {
+			return "", fmt.Sprintf("the branch could not be updated with `%s`: %s", pr.GetBase().GetRef(), mergeFailureReason(pr, err)), nil
+		}
+	}
+	if rb.shadowed(owner + "/" + repo) {
+		// The update was only recorded; the head will not move
+		return head, "", nil
+	}
+
+	deadline := time.Now().Add(rb.config.Settings.MergeQueue.updateTimeout())
+	for time.Now().Before(deadline) {
+		updated, _, err := rb.client.PullRequests.Get(ctx, owner, repo, pr.GetNumber())
+		if err != nil {
+			return "", "", err
+		}
+		if sha := updated.GetHead().GetSHA(); sha != head {
+			pr.Head = updated.Head
+			return sha, "", nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", "", ctx.Err()
+		case <-time.After(rb.mergeQueue.PollInterval / 10):
+		}
+	}
+	return "", "", fmt.Errorf("timed out waiting for GitHub to update the branch")
+}
+
+// enqueue adds a ready PR to the merge queue and updates its summary.
+func (rb *ReviewBot) enqueue(ctx context.Context, owner, repo string, pr *github.PullRequest) {
+	position := rb.mergeQueue.Enqueue(QueueEntry{
+		Repository: owner + "/" + repo,
+		Base:       pr.GetBase().GetRef(),
+		PRNumber:   pr.GetNumber(),
+		Title:      pr.GetTitle(),
+		HeadSHA:    pr.GetHead().GetSHA(),
+	})
+	log.Printf("Merge queue: %s/%s#%d queued at position %d for %s", owner, repo, pr.GetNumber(), position, pr.GetBase().GetRef())
+	rb.refreshSummary(ctx, owner, repo, pr.GetNumber())
+}
+
+// refreshQueuePositions updates the summaries of the PRs still queued
+// behind a PR that just left base's queue, and of that PR itself.
+func (rb *ReviewBot) refreshQueuePositions(ctx context.Context, repository, base string, left int) {
+	owner, repo, _ := strings.Cut(repository, "/")
+	rb.refreshSummary(ctx, owner, repo, left)
+	for _, entry := range rb.queueEntries() {
+		if entry.Repository == repository && entry.Base == base {
+			rb.refreshSummary(ctx, owner, repo, entry.PRNumber)
+		}
+	}
+}
+
+func (rb *ReviewBot) queueEntries() []QueueEntry {
+	rb.mergeQueue.mu.Lock()
+	defer rb.mergeQueue.mu.Unlock()
+
+	entries := make([]QueueEntry, len(rb.mergeQueue.entries))
+	for i, entry := range rb.mergeQueue.entries {
+		entries[i] = *entry
+	}
+	return entries
+}
+
+// queueSection renders the PR's merge queue status for its summary
+// comment, or "" when it has never been queued.
+func (rb *ReviewBot) queueSection(repository string, prNumber int) string {
+	if entry, position, n, ok := rb.mergeQueue.Get(repository, prNumber); ok {
+		if entry.State == QueueTesting {
+			return fmt.Sprintf("\n### Merge Queue:\n🧪 Testing against the latest `%s` (`%s`), position %d of %d\n", entry.Base, shortSHA(entry.TestSHA), position, n)
+		}
+		return fmt.Sprintf("\n### Merge Queue:\n🚦 Queued for `%s`: position %d of %d\n", entry.Base, position, n)
+	}
+	outcome, ok := rb.mergeQueue.LastOutcome(repository, prNumber)
+	if !ok {
+		return ""
+	}
+	switch outcome.Outcome {
+	case QueueMerged:
+		return fmt.Sprintf("\n### Merge Queue:\n✅ Merged into `%s` by the merge queue\n", outcome.Base)
+	case QueueShadowed:
+		return fmt.Sprintf("\n### Merge Queue:\n👻 Would have been merged into `%s` (shadow mode)\n", outcome.Base)
+	}
+	return fmt.Sprintf("\n### Merge Queue:\n🚫 Removed from the queue: %s\n", outcome.Reason)
+}
+
+// MergeQueueView is one repository and base branch's queue as shown by the
+// API.
+type MergeQueueView struct {
+	Repository string       `json:"repository"`
+	Base       string       `json:"base"`
+	Entries    []QueueEntry `json:"entries"`
+}
+
+// handleMergeQueue lists every queue and the most recent outcomes.
+func (rb *ReviewBot) handleMergeQueue(w http.ResponseWriter, r *http.Request) {
+	views := make(map[string]*MergeQueueView)
+	var order []string
+	for _, entry := range rb.queueEntries() {
+		view, ok := views[entry.queue()]
+		if !ok {
+			view = &MergeQueueView{Repository: entry.Repository, Base: entry.Base}
+			views[entry.queue()] = view
+			order = append(order, entry.queue())
+		}
+		view.Entries = append(view.Entries, entry)
+	}
+	sort.Strings(order)
+	queues := make([]*MergeQueueView, 0, len(order))
+	for _, key := range order {
+		queues = append(queues, views[key])
+	}
+
+	rb.mergeQueue.mu.Lock()
+	history := append([]QueueOutcome(nil), rb.mergeQueue.history...)
+	rb.mergeQueue.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": rb.config.Settings.MergeQueue.Enabled,
+		"queues":  queues,
+		"recent":  history,
+	})
+}
+
+// handleMergeQueueRemove takes a PR out of the queue.
+func (rb *ReviewBot) handleMergeQueueRemove(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	number, err := strconv.Atoi(vars["number"])
+	if err != nil {
+		http.Error(w, "Invalid pull request number", http.StatusBadRequest)
+		return
+	}
+	repository := vars["owner"] + "/" + vars["repo"]
+	entry, _, _, ok := rb.mergeQueue.Get(repository, number)
+	if !ok || !rb.mergeQueue.Remove(repository, number, QueueEjected, "removed by an administrator.") {
+		http.Error(w, "Pull request is not queued", http.StatusNotFound)
+		return
+	}
+	rb.refreshQueuePositions(r.Context(), repository, entry.Base, number)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"github.com/gorilla/mux"
+)
+
+func TestMergeQueuePositions(t *testing.T) {
+	store := NewStore(t.TempDir())
+	mq := NewMergeQueue(store)
+	if pos := mq.Enqueue(QueueEntry{Repository: "o/r", Base: "main", PRNumber: 1, HeadSHA: "a"}); pos != 1 {
+		t.Errorf("Expected position 1, got %d", pos)
+	}
+	mq.Enqueue(QueueEntry{Repository: "o/r", Base: "release", PRNumber: 2, HeadSHA: "b"})
+	if pos := mq.Enqueue(QueueEntry{Repository: "o/r", Base: "main", PRNumber: 3, HeadSHA: "c"}); pos != 2 {
+		t.Errorf("Expected position 2 behind #1 on main, got %d", pos)
+	}
+	mq.setState("o/r", 1, QueueTesting, "t1", "")
+
+	// Queueing again keeps the place in line
+	if pos := mq.Enqueue(QueueEntry{Repository: "o/r", Base: "main", PRNumber: 3, HeadSHA: "d"}); pos != 2 {
+		t.Errorf("Expected #3 to keep position 2, got %d", pos)
+	}
+
+	// A restart resumes the queue, retesting whatever was in flight
+	mq = NewMergeQueue(store)
+	entry, pos, n, ok := mq.Get("o/r", 1)
+	if !ok || pos != 1 || n != 2 || entry.State != QueueQueued || entry.TestSHA != "" {
+		t.Errorf("Expected #1 queued at 1 of 2 after reload, got %+v %d/%d", entry, pos, n)
+	}
+	if entry, _, _, _ := mq.Get("o/r", 3); entry.HeadSHA != "d" {
+		t.Errorf("Expected the refreshed head to persist, got %q", entry.HeadSHA)
+	}
+
+	if !mq.Remove("o/r", 1, QueueMerged, "") || mq.Remove("o/r", 1, QueueMerged, "") {
+		t.Error("Expected #1 to be removed exactly once")
+	}
+	if _, pos, n, _ := mq.Get("o/r", 3); pos != 1 || n != 1 {
+		t.Errorf("Expected #3 to move up to 1 of 1, got %d/%d", pos, n)
+	}
+	var heads []int
+	for _, head := range mq.heads() {
+		heads = append(heads, head.PRNumber)
+	}
+	if !reflect.DeepEqual(heads, []int{2, 3}) {
+		t.Errorf("Expected the heads of both queues, got %v", heads)
+	}
+	if outcome, ok := mq.LastOutcome("o/r", 1); !ok || outcome.Outcome != QueueMerged {
+		t.Errorf("Expected #1's outcome to be recorded, got %+v", outcome)
+	}
+}
+
+type mergeQueueServer struct {
+	mu       sync.Mutex
+	prs      map[int]*github.PullRequest
+	merges   []string
+	comments []string
+	edits    []string
+	refs     []string
+}
+
+func (s *mergeQueueServer) mux(t *testing.T) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.Branch{Name: github.String("main"), Commit: &github.RepositoryCommit{SHA: github.String("base1")}})
+	})
+	mux.HandleFunc("/repos/o/r/git/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Not Found"}`))
+		case r.Method == http.MethodPost:
+			var ref struct {
+				Ref string `json:"ref"`
+				SHA string `json:"sha"`
+			}
+			json.NewDecoder(r.Body).Decode(&ref)
+			s.refs = append(s.refs, "create "+ref.Ref+" at "+ref.SHA)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		case r.Method == http.MethodDelete:
+			s.refs = append(s.refs, "delete "+strings.TrimPrefix(r.URL.Path, "/repos/o/r/git/refs/"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/merges", func(w http.ResponseWriter, r *http.Request) {
+		var req github.RepositoryMergeRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.GetHead() == "h3" {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message":"Merge conflict"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&github.RepositoryCommit{SHA: github.String("test-" + req.GetHead())})
+	})
+	mux.HandleFunc("/repos/o/r/pulls/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/o/r/pulls/"), "/")
+		number, _ := strconv.Atoi(parts[0])
+		pr := s.prs[number]
+		switch {
+		case len(parts) == 1:
+			json.NewEncoder(w).Encode(pr)
+		case parts[1] == "files":
+			json.NewEncoder(w).Encode([]*github.CommitFile{})
+		case parts[1] == "reviews":
+			json.NewEncoder(w).Encode([]*github.PullRequestReview{review("alice", "APPROVED"), review("bob", "APPROVED")})
+		case parts[1] == "merge":
+			var opts struct {
+				SHA string `json:"sha"`
+			}
+			json.NewDecoder(r.Body).Decode(&opts)
+			s.merges = append(s.merges, parts[0]+"@"+opts.SHA)
+			pr.State = github.String("closed")
+			json.NewEncoder(w).Encode(&github.PullRequestMergeResult{Merged: github.Bool(true)})
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/issues/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		rest := strings.TrimPrefix(r.URL.Path, "/repos/o/r/issues/")
+		var comment github.IssueComment
+		json.NewDecoder(r.Body).Decode(&comment)
+		switch {
+		case rest == "comments/99":
+			s.edits = append(s.edits, comment.GetBody())
+			json.NewEncoder(w).Encode(&comment)
+		case rest == "1/comments" && r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode([]*github.IssueComment{
+				{ID: github.Int64(98), Body: github.String("Thanks!")},
+				{ID: github.Int64(99), User: &github.User{Login: github.String("review-bot")}, Body: github.String("old results\n" + summaryMarker)},
+			})
+		case r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode([]*github.IssueComment{})
+		default:
+			s.comments = append(s.comments, strings.TrimSuffix(rest, "/comments")+": "+comment.GetBody())
+			json.NewEncoder(w).Encode(&comment)
+		}
+	})
+	return mux
+}
+
+func TestProcessMergeQueue(t *testing.T) {
+	repo := &github.Repository{FullName: github.String("o/r")}
+	pr := func(number int, title, head string) *github.PullRequest {
+		return &github.PullRequest{
+			Number: github.Int(number),
+			Title:  github.String(title),
+			State:  github.String("open"),
+			Head:   &github.PullRequestBranch{SHA: github.String(head), Ref: github.String("feature-" + head), Repo: repo},
+			Base:   &github.PullRequestBranch{Ref: github.String("main"), Repo: repo},
+		}
+	}
+	server := &mergeQueueServer{prs: map[int]*github.PullRequest{
+		1: pr(1, "feat: add queue", "h1"),
+		2: pr(2, "Added a thing", "h2"),
+		3: pr(3, "fix: conflicts", "h3"),
+	}}
+	bot := newTestBot(t, server.mux(t))
+	store := NewStore(t.TempDir())
+	bot.evaluations = NewEvaluationStore(store)
+	bot.mergeQueue = NewMergeQueue(store)
+	bot.autoMergeOptIns = NewAutoMergeOptIns(store)
+	bot.config.RequiredChecks = []string{"conventional"}
+	bot.config.Settings.AutoMerge = AutoMergeSettings{Enabled: true, Method: MergeSquash}
+	bot.config.Settings.MergeQueue = MergeQueueSettings{Enabled: true}
+
+	for _, n := range []int{1, 2, 3} {
+		p := server.prs[n]
+		p.Labels = []*github.Label{{Name: github.String("automerge")}}
+		eval := Evaluation{Repository: "o/r", PRNumber: n, HeadSHA: p.GetHead().GetSHA(), CanMerge: true, Reason: "ok"}
+		bot.evaluations.Record(eval)
+		bot.autoMergeOptIns.Record("o/r", n, "maintainer", time.Now())
+		bot.maybeAutoMerge(context.Background(), "o", "r", p, eval)
+	}
+	if len(server.merges) != 0 {
+		t.Fatalf("Expected ready PRs to be queued rather than merged, got %v", server.merges)
+	}
+	if len(server.edits) != 1 || !strings.Contains(server.edits[0], "🚦 Queued for `main`: position 1 of 1") {
+		t.Errorf("Expected #1's summary to show its position, got %v", server.edits)
+	}
+
+	for i := 0; i < 3; i++ {
+		bot.processMergeQueue(context.Background())
+	}
+
+	if want := []string{"1@h1"}; !reflect.DeepEqual(server.merges, want) {
+		t.Errorf("Expected only #1 to merge, pinned to its head, got %v", server.merges)
+	}
+	wantRefs := []string{
+		"create refs/heads/review-bot/queue/1 at base1", "delete heads/review-bot/queue/1",
+		"create refs/heads/review-bot/queue/2 at base1", "delete heads/review-bot/queue/2",
+		"create refs/heads/review-bot/queue/3 at base1", "delete heads/review-bot/queue/3",
+	}
+	if !reflect.DeepEqual(server.refs, wantRefs) {
+		t.Errorf("Expected a temporary branch per PR\nwant %v\ngot  %v", wantRefs, server.refs)
+	}
+	if last := server.edits[len(server.edits)-1]; !strings.Contains(last, "✅ Merged into `main` by the merge queue") || !strings.HasSuffix(last, summaryMarker) {
+		t.Errorf("Expected #1's summary to record the merge, got %q", last)
+	}
+
+	var ejections []string
+	for _, comment := range server.comments {
+		if strings.Contains(comment, "Removed from the merge queue") {
+			ejections = append(ejections, comment)
+		}
+	}
+	sort.Strings(ejections)
+	if len(ejections) != 2 ||
+		!strings.HasPrefix(ejections[0], "2: 🚫 Removed from the merge queue: checks failed against the latest `main`: **conventional**") ||
+		ejections[1] != "3: 🚫 Removed from the merge queue: it has merge conflicts with the latest `main`." {
+		t.Errorf("Expected #2 and #3 to be ejected with reasons, got %v", ejections)
+	}
+	if entries := bot.queueEntries(); len(entries) != 0 {
+		t.Errorf("Expected an empty queue, got %+v", entries)
+	}
+}
+
+func TestMergeQueueShadowMode(t *testing.T) {
+	repo := &github.Repository{FullName: github.String("o/r")}
+	server := &mergeQueueServer{prs: map[int]*github.PullRequest{1: {
+		Number: github.Int(1),
+		Title:  github.String("feat: add queue"),
+		State:  github.String("open"),
+		Labels: []*github.Label{{Name: github.String("automerge")}},
+		Head:   &github.PullRequestBranch{SHA: github.String("h1"), Ref: github.String("feature-h1"), Repo: repo},
+		Base:   &github.PullRequestBranch{Ref: github.String("main"), Repo: repo},
+	}}}
+	bot := newTestBot(t, server.mux(t))
+	store := NewStore(t.TempDir())
+	bot.evaluations = NewEvaluationStore(store)
+	bot.mergeQueue = NewMergeQueue(store)
+	bot.shadow.store = store
+	bot.shadow.actions = nil
+	bot.autoMergeOptIns = NewAutoMergeOptIns(store)
+	bot.autoMergeOptIns.Record("o/r", 1, "maintainer", time.Now())
+	bot.config.RequiredChecks = []string{"conventional"}
+	bot.config.Settings.AutoMerge = AutoMergeSettings{Enabled: true}
+	bot.config.Settings.MergeQueue = MergeQueueSettings{Enabled: true}
+	bot.config.Settings.Shadow = ShadowSettings{Repos: []string{"o/r"}}
+
+	entry := QueueEntry{Repository: "o/r", Base: "main", PRNumber: 1, HeadSHA: "h1"}
+	if sha, reason, err := bot.prepareMergeBranch(context.Background(), "o", "r", entry, "base1"); sha != "h1" || reason != "" || err != nil {
+		t.Errorf("Expected the PR head to be tested, got %q %q %v", sha, reason, err)
+	}
+
+	eval := Evaluation{Repository: "o/r", PRNumber: 1, HeadSHA: "h1", CanMerge: true, Reason: "ok"}
+	bot.evaluations.Record(eval)
+	bot.maybeAutoMerge(context.Background(), "o", "r", server.prs[1], eval)
+	bot.processMergeQueue(context.Background())
+
+	if len(server.merges)+len(server.refs) != 0 {
+		t.Errorf("Expected nothing to change on GitHub, got merges %v refs %v", server.merges, server.refs)
+	}
+	outcome, ok := bot.mergeQueue.LastOutcome("o/r", 1)
+	if !ok || outcome.Outcome != QueueShadowed {
+		t.Errorf("Expected a shadow outcome, got %+v", outcome)
+	}
+	if section := bot.queueSection("o/r", 1); !strings.Contains(section, "Would have been merged into `main`") {
+		t.Errorf("Expected the summary to show the shadow merge, got %q", section)
+	}
+	merged := false
+	for _, action := range bot.shadow.Actions("o/r", 1) {
+		merged = merged || action.Action == "merge"
+	}
+	if !merged {
+		t.Errorf("Expected the merge to be recorded, got %+v", bot.shadow.Actions("o/r", 0))
+	}
+}
+
+func TestMergeQueueAPI(t *testing.T) {
+	bot := newTestBot(t, http.NewServeMux())
+	store := NewStore(t.TempDir())
+	bot.evaluations = NewEvaluationStore(store)
+	bot.mergeQueue = NewMergeQueue(store)
+	bot.config.AdminToken = "admin"
+	bot.mergeQueue.Enqueue(QueueEntry{Repository: "o/r", Base: "main", PRNumber: 4, HeadSHA: "a"})
+	bot.mergeQueue.Enqueue(QueueEntry{Repository: "o/a", Base: "main", PRNumber: 5, HeadSHA: "b"})
+
+	r := mux.NewRouter()
+	r.HandleFunc("/queue", bot.handleMergeQueue).Methods("GET")
+	r.HandleFunc("/admin/queue/{owner}/{repo}/{number}", bot.requireAdmin(bot.handleMergeQueueRemove)).Methods("DELETE")
+
+	req := httptest.NewRequest("DELETE", "/admin/queue/o/r/4", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/queue", nil))
+	var body struct {
+		Queues []MergeQueueView `json:"queues"`
+		Recent []QueueOutcome   `json:"recent"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Queues) != 1 || body.Queues[0].Repository != "o/a" || body.Queues[0].Entries[0].PRNumber != 5 {
+		t.Errorf("Expected only o/a's queue, got %+v", body.Queues)
+	}
+	if len(body.Recent) != 1 || body.Recent[0].PRNumber != 4 || body.Recent[0].Outcome != QueueEjected {
+		t.Errorf("Expected #4's removal in recent outcomes, got %+v", body.Recent)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Notifier delivers a human-readable PR summary to a chat service.
+type Notifier interface {
+	Name() string
+	Notify(eval Evaluation) error
+}
+
+// NotifierSettings configures one chat notifier. Type is "slack", "teams" or
+// "discord"; Repos restricts it to matching repositories (all when empty).
+// Channel only applies to Slack.
+type NotifierSettings struct {
+	Type       string   `json:"type"`
+	WebhookURL string   `json:"webhook_url"`
+	Channel    string   `json:"channel"`
+	Repos      []string `json:"repos"`
+}
+
+var notifierTypes = map[string]bool{
+	"slack":   true,
+	"teams":   true,
+	"discord": true,
+}
+
+// webhookNotifier renders a summary into a service-specific JSON body and
+// hands it to the outbox, so chat deliveries get the same retries as other
+// outbound webhooks.
+type webhookNotifier struct {
+	name   string
+	url    string
+	outbox *Outbox
+	render func(Evaluation) interface{}
+}
+
+func (n *webhookNotifier) Name() string {
+	return n.name
+}
+
+func (n *webhookNotifier) Notify(eval Evaluation) error {
+	body, err := json.Marshal(n.render(eval))
+	if err != nil {
+		return fmt.Errorf("rendering %s message: %w", n.name, err)
+	}
+	_, err = n.outbox.Enqueue("integration:"+n.name, n.name+"_notification", n.url, body)
+	return err
+}
+
+func newSlackNotifier(outbox *Outbox, webhookURL, channel string) Notifier {
+	return &webhookNotifier{
+		name:   "slack",
+		url:    webhookURL,
+		outbox: outbox,
+		render: func(eval Evaluation) interface{} { return slackMessage(eval, channel) },
+	}
+}
+
+func newTeamsNotifier(outbox *Outbox, webhookURL string) Notifier {
+	return &webhookNotifier{
+		name:   "teams",
+		url:    webhookURL,
+		outbox: outbox,
+		render: func(eval Evaluation) interface{} { return teamsMessage(eval) },
+	}
+}
+
+func newDiscordNotifier(outbox *Outbox, webhookURL string) Notifier {
+	return &webhookNotifier{
+		name:   "discord",
+		url:    webhookURL,
+		outbox: outbox,
+		render: func(eval Evaluation) interface{} { return discordMessage(eval) },
+	}
+}
+
+// notifiersFor returns the notifiers selected for repository: the Slack
+// defaults (SLACK_WEBHOOK_URL and the slack section) plus every entry in
+// notifiers whose repos match.
+func (rb *ReviewBot) notifiersFor(repository string) []Notifier {
+	var notifiers []Notifier
+	if webhookURL, channel := rb.slackDestination(repository); webhookURL != "" {
+		notifiers = append(notifiers, newSlackNotifier(rb.outbox, webhookURL, channel))
+	}
+
+	for _, ns := range rb.config.Settings.Notifiers {
+		if len(ns.Repos) > 0 && !matchesAny(ns.Repos, repository) {
+			continue
+		}
+		switch ns.Type {
+		case "slack":
+			notifiers = append(notifiers, newSlackNotifier(rb.outbox, ns.WebhookURL, ns.Channel))
+		case "teams":
+			notifiers = append(notifiers, newTeamsNotifier(rb.outbox, ns.WebhookURL))
+		case "discord":
+			notifiers = append(notifiers, newDiscordNotifier(rb.outbox, ns.WebhookURL))
+		}
+	}
+	return notifiers
+}
+
+// notify sends change to the repository's notifiers when it is worth a human's
+// attention: the first evaluation, a change in merge readiness or a change in
+// any check status. Re-runs that reach the same verdict stay quiet.
+func (rb *ReviewBot) notify(change EvaluationChange) {
+	if !change.notable() {
+		return
+	}
+	for _, notifier := range rb.notifiersFor(change.Current.Repository) {
+		if err := notifier.Notify(change.Current); err != nil {
+			log.Printf("Failed to queue %s notification for %s: %v", notifier.Name(), change.Current.key(), err)
+		}
+	}
+}
+
+// checkEmoji mirrors the emoji used for check statuses in PR comments, for
+// services that render Unicode emoji rather than Slack-style shortcodes.
+func checkEmoji(status string) string {
+	switch status {
+	case "failure":
+		return "❌"
+	case "warning":
+		return "⚠️"
+	case "error":
+		return "🔴"
+	case "skipped":
+		return "⏭️"
+	default:
+		return "✅"
+	}
+}
+
+// summaryTitle is the one-line heading shared by the chat renderers.
+func summaryTitle(eval Evaluation) string {
+	title := fmt.Sprintf("%s#%d", eval.Repository, eval.PRNumber)
+	if eval.Title != "" {
+		title += ": " + eval.Title
+	}
+	return title
+}
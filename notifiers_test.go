@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func notifierNames(notifiers []Notifier) []string {
+	var names []string
+	for _, n := range notifiers {
+		names = append(names, n.Name())
+	}
+	return names
+}
+
+func TestNotifiersForRepository(t *testing.T) {
+	bot := NewReviewBot(NewConfig())
+	bot.config.Settings.Notifiers = []NotifierSettings{
+		{Type: "teams", WebhookURL: "https://teams.test/hook", Repos: []string{"acme/*"}},
+		{Type: "discord", WebhookURL: "https://discord.test/hook", Repos: []string{"oss/*"}},
+	}
+
+	if got := strings.Join(notifierNames(bot.notifiersFor("acme/api")), ","); got != "teams" {
+		t.Errorf("Expected only teams for acme/api, got %q", got)
+	}
+	if got := strings.Join(notifierNames(bot.notifiersFor("oss/tool")), ","); got != "discord" {
+		t.Errorf("Expected only discord for oss/tool, got %q", got)
+	}
+
+	bot.config.SlackWebhookURL = "https://hooks.slack.test/env"
+	if got := strings.Join(notifierNames(bot.notifiersFor("acme/api")), ","); got != "slack,teams" {
+		t.Errorf("Expected slack and teams for acme/api, got %q", got)
+	}
+}
+
+func TestNotifyOnlyOnStateChange(t *testing.T) {
+	bot := NewReviewBot(NewConfig())
+	bot.outbox = NewOutbox(NewStore(t.TempDir()))
+	bot.config.Settings.Notifiers = []NotifierSettings{{Type: "discord", WebhookURL: "https://discord.test/hook"}}
+
+	first := Evaluation{Repository: "acme/api", PRNumber: 1, Reason: "Need 2 approvals, have 0",
+		Checks: []CheckResult{{Name: "test", Status: "success"}}}
+	bot.notify(EvaluationChange{Current: first})
+
+	sameAgain := first
+	sameAgain.Reason = "Need 2 approvals, have 1"
+	bot.notify(EvaluationChange{Current: sameAgain, Previous: first, HadPrevious: true})
+
+	approved := sameAgain
+	approved.CanMerge = true
+	bot.notify(EvaluationChange{Current: approved, Previous: sameAgain, HadPrevious: true})
+
+	if got := len(bot.outbox.events); got != 2 {
+		t.Errorf("Expected 2 notifications (first run and merge readiness change), got %d", got)
+	}
+	for _, event := range bot.outbox.events {
+		if event.Event != "discord_notification" {
+			t.Errorf("Expected discord_notification events, got %s", event.Event)
+		}
+	}
+}
+
+var renderedEvaluation = Evaluation{
+	Repository: "acme/api",
+	PRNumber:   12,
+	Title:      "Add retry support",
+	URL:        "https://github.com/acme/api/pull/12",
+	HeadSHA:    "0123456789abcdef",
+	CanMerge:   true,
+	Reason:     "All merge policies satisfied",
+	Checks: []CheckResult{
+		{Name: "test", Status: "success", Message: "All tests passed"},
+		{Name: "security", Status: "failure", Message: "Potential security issues found in 1 files"},
+	},
+}
+
+func TestTeamsMessage(t *testing.T) {
+	msg := teamsMessage(renderedEvaluation)
+	if len(msg.Attachments) != 1 || msg.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("Expected one adaptive card attachment, got %+v", msg.Attachments)
+	}
+
+	data, _ := json.Marshal(msg)
+	body := string(data)
+	for _, want := range []string{
+		`"type":"AdaptiveCard"`,
+		`"type":"FactSet"`,
+		`"title":"security"`,
+		`"color":"Attention"`,
+		`"type":"Action.OpenUrl"`,
+		`"url":"https://github.com/acme/api/pull/12"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected Teams card to contain %s, got %s", want, body)
+		}
+	}
+}
+
+func TestDiscordMessage(t *testing.T) {
+	msg := discordMessage(renderedEvaluation)
+	if len(msg.Embeds) != 1 {
+		t.Fatalf("Expected one embed, got %d", len(msg.Embeds))
+	}
+
+	embed := msg.Embeds[0]
+	if embed.Title != "acme/api#12: Add retry support" || embed.URL != renderedEvaluation.URL {
+		t.Errorf("Unexpected embed title/url: %q %q", embed.Title, embed.URL)
+	}
+	if embed.Color != discordRed {
+		t.Errorf("Expected red embed for a failing check, got %#x", embed.Color)
+	}
+	if len(embed.Fields) != 2 || embed.Fields[1].Name != "❌ security" {
+		t.Errorf("Expected a field per check, got %+v", embed.Fields)
+	}
+	if embed.Footer == nil || embed.Footer.Text != "Head 0123456" {
+		t.Errorf("Expected footer with short SHA, got %+v", embed.Footer)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+
+	outboxStoreName = "outbox"
+)
+
+var (
+	errOutboxEventNotFound = errors.New("outbox event not found")
+	errOutboxEventNotDead  = errors.New("outbox event is not dead-lettered")
+)
+
+// OutboxEvent is a single outbound delivery. It is persisted before the
+// first attempt so that nothing is lost if the process exits mid-flight.
+type OutboxEvent struct {
+	ID          string          `json:"id"`
+	Subscriber  string          `json:"subscriber"`
+	Event       string          `json:"event"`
+	URL         string          `json:"url"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Outbox stores outbound webhook events and delivers them from a background
+// worker with exponential backoff. Events that exhaust their attempts move to
+// the dead state until an operator redelivers them.
+type Outbox struct {
+	mu     sync.Mutex
+	store  *Store
+	events map[string]*OutboxEvent
+	client *http.Client
+	wake   chan struct{}
+	now    func() time.Time
+
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	PollInterval time.Duration
+	// Retention is how long delivered events are kept before being pruned.
+	Retention time.Duration
+	// SecretFor returns the signing secret for a subscriber. Secrets are
+	// looked up at delivery time rather than persisted with the event.
+	SecretFor func(subscriber string) string
+}
+
+func NewOutbox(store *Store) *Outbox {
+	ob := &Outbox{
+		store:        store,
+		events:       make(map[string]*OutboxEvent),
+		client:       &http.Client{Timeout: 10 * time.Second},
+		wake:         make(chan struct{}, 1),
+		now:          time.Now,
+		MaxAttempts:  8,
+		BaseDelay:    time.Second,
+		MaxDelay:     10 * time.Minute,
+		PollInterval: 5 * time.Second,
+		Retention:    24 * time.Hour,
+	}
+
+	var saved []*OutboxEvent
+	if err := store.Load(outboxStoreName, &saved); err != nil {
+		log.Printf("Failed to load outbox: %v", err)
+	}
+	for _, event := range saved {
+		ob.events[event.ID] = event
+	}
+	return ob
+}
+
+// Enqueue persists an event for subscriber at url and signals the worker.
+// The event is only accepted once it has been written to the store.
+func (ob *Outbox) Enqueue(subscriber, eventType, url string, payload []byte) (*OutboxEvent, error) {
+	id, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := ob.now()
+	event := &OutboxEvent{
+		ID:          id,
+		Subscriber:  subscriber,
+		Event:       eventType,
+		URL:         url,
+		Payload:     json.RawMessage(payload),
+		Status:      OutboxPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	ob.mu.Lock()
+	ob.events[id] = event
+	err = ob.saveLocked()
+	if err != nil {
+		delete(ob.events, id)
+	}
+	ob.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("persisting outbox event: %w", err)
+	}
+
+	ob.signal()
+	copied := *event
+	return &copied, nil
+}
+
+// Run delivers due events until ctx is cancelled.
+func (ob *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(ob.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		ob.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-ob.wake:
+		}
+	}
+}
+
+// deliverDue makes one attempt at every pending event whose backoff has
+// elapsed.
+func (ob *Outbox) deliverDue(ctx context.Context) {
+	now := ob.now()
+
+	ob.mu.Lock()
+	var due []OutboxEvent
+	for id, event := range ob.events {
+		if event.Status == OutboxDelivered && now.Sub(event.UpdatedAt) > ob.Retention {
+			delete(ob.events, id)
+			continue
+		}
+		if event.Status == OutboxPending && !event.NextAttempt.After(now) {
+			due = append(due, *event)
+		}
+	}
+	ob.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+
+	for _, event := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		err := ob.deliver(ctx, event)
+		ob.recordAttempt(event.ID, err)
+	}
+}
+
+func (ob *Outbox) deliver(ctx context.Context, event OutboxEvent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, event.URL, bytes.NewReader(event.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "github-review-bot/"+version)
+	req.Header.Set("X-ReviewBot-Event", event.Event)
+	req.Header.Set("X-ReviewBot-Delivery", event.ID)
+	if ob.SecretFor != nil {
+		if secret := ob.SecretFor(event.Subscriber); secret != "" {
+			// Signed per attempt so the timestamp reflects when it was sent
+			req.Header.Set(signatureHeader, signPayload(secret, ob.now(), event.Payload))
+		}
+	}
+
+	resp, err := ob.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (ob *Outbox) recordAttempt(id string, deliveryErr error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	event, ok := ob.events[id]
+	if !ok {
+		return
+	}
+
+	now := ob.now()
+	event.Attempts++
+	event.UpdatedAt = now
+
+	switch {
+	case deliveryErr == nil:
+		event.Status = OutboxDelivered
+		event.LastError = ""
+		log.Printf("Delivered %s event %s to %s", event.Event, event.ID, event.URL)
+	case event.Attempts >= ob.MaxAttempts:
+		event.Status = OutboxDead
+		event.LastError = deliveryErr.Error()
+		log.Printf("Giving up on %s event %s after %d attempts: %v", event.Event, event.ID, event.Attempts, deliveryErr)
+	default:
+		event.LastError = deliveryErr.Error()
+		event.NextAttempt = now.Add(ob.backoff(event.Attempts))
+		log.Printf("Delivery of %s event %s failed (attempt %d): %v", event.Event, event.ID, event.Attempts, deliveryErr)
+	}
+
+	if err := ob.saveLocked(); err != nil {
+		log.Printf("Failed to persist outbox: %v", err)
+	}
+}
+
+// backoff returns the delay before the next attempt, doubling per attempt
+// and capped at MaxDelay.
+func (ob *Outbox) backoff(attempts int) time.Duration {
+	delay := ob.BaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= ob.MaxDelay {
+			return ob.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Failed returns dead-lettered events, oldest first.
+func (ob *Outbox) Failed() []OutboxEvent {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	failed := []OutboxEvent{}
+	for _, event := range ob.events {
+		if event.Status == OutboxDead {
+			failed = append(failed, *event)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].CreatedAt.Before(failed[j].CreatedAt) })
+	return failed
+}
+
+// Redeliver moves a dead event back to pending with a fresh attempt budget.
+func (ob *Outbox) Redeliver(id string) error {
+	ob.mu.Lock()
+	event, ok := ob.events[id]
+	if !ok {
+		ob.mu.Unlock()
+		return fmt.Errorf("%w: %s", errOutboxEventNotFound, id)
+	}
+	if event.Status != OutboxDead {
+		ob.mu.Unlock()
+		return fmt.Errorf("%w: %s is %s", errOutboxEventNotDead, id, event.Status)
+	}
+
+	event.Status = OutboxPending
+	event.Attempts = 0
+	event.NextAttempt = ob.now()
+	event.UpdatedAt = event.NextAttempt
+	err := ob.saveLocked()
+	ob.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("persisting outbox event: %w", err)
+	}
+
+	ob.signal()
+	return nil
+}
+
+func (ob *Outbox) saveLocked() error {
+	events := make([]*OutboxEvent, 0, len(ob.events))
+	for _, event := range ob.events {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].CreatedAt.Before(events[j].CreatedAt) })
+	return ob.store.Save(outboxStoreName, events)
+}
+
+func (ob *Outbox) signal() {
+	select {
+	case ob.wake <- struct{}{}:
+	default:
+	}
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (rb *ReviewBot) handleOutboxFailed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rb.outbox.Failed())
+}
+
+func (rb *ReviewBot) handleOutboxRedeliver(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	err := rb.outbox.Redeliver(id)
+	switch {
+	case errors.Is(err, errOutboxEventNotDead):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
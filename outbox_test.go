@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOutboxDeliversAndPersists(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-ReviewBot-Event") != "pr_processed" {
+			t.Errorf("Expected X-ReviewBot-Event header, got %q", r.Header.Get("X-ReviewBot-Event"))
+		}
+		received.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := NewStore(t.TempDir())
+	outbox := NewOutbox(store)
+	if _, err := outbox.Enqueue("default", "pr_processed", server.URL, []byte(`{"pr_number":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh outbox on the same store must see the queued event.
+	reloaded := NewOutbox(store)
+	reloaded.deliverDue(context.Background())
+
+	if received.Load() != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", received.Load())
+	}
+	for _, event := range reloaded.events {
+		if event.Status != OutboxDelivered {
+			t.Errorf("Expected event to be delivered, got %s", event.Status)
+		}
+	}
+}
+
+func TestOutboxRetriesThenDeadLetters(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	outbox := NewOutbox(NewStore(t.TempDir()))
+	outbox.now = func() time.Time { return now }
+	outbox.MaxAttempts = 3
+
+	event, err := outbox.Enqueue("default", "pr_processed", server.URL, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < outbox.MaxAttempts; i++ {
+		outbox.deliverDue(context.Background())
+		now = now.Add(outbox.MaxDelay)
+	}
+
+	failed := outbox.Failed()
+	if len(failed) != 1 || failed[0].ID != event.ID {
+		t.Fatalf("Expected event %s to be dead-lettered, got %+v", event.ID, failed)
+	}
+	if failed[0].Attempts != 3 || failed[0].LastError == "" {
+		t.Errorf("Expected 3 attempts with an error, got %d (%q)", failed[0].Attempts, failed[0].LastError)
+	}
+
+	failing.Store(false)
+	if err := outbox.Redeliver(event.ID); err != nil {
+		t.Fatal(err)
+	}
+	outbox.deliverDue(context.Background())
+
+	if len(outbox.Failed()) != 0 {
+		t.Error("Expected no failed events after redelivery")
+	}
+	if status := outbox.events[event.ID].Status; status != OutboxDelivered {
+		t.Errorf("Expected event to be delivered after redelivery, got %s", status)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	outbox := NewOutbox(NewStore(t.TempDir()))
+	outbox.BaseDelay = time.Second
+	outbox.MaxDelay = 5 * time.Second
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := outbox.backoff(i + 1); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestAdminEndpointsRequireToken(t *testing.T) {
+	bot := NewReviewBot(NewConfig())
+	handler := bot.requireAdmin(bot.handleOutboxFailed)
+
+	req := httptest.NewRequest("GET", "/admin/outbox/failed", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected %d without ADMIN_TOKEN, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	bot.config.AdminToken = "s3cret"
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d without bearer token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected %d with bearer token, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestOutboxRedeliverStatus(t *testing.T) {
+	bot := NewReviewBot(NewConfig())
+	bot.outbox = NewOutbox(NewStore(t.TempDir()))
+	event, err := bot.outbox.Enqueue("default", "pr_processed", "http://example.invalid", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/admin/outbox/{id}/redeliver", bot.handleOutboxRedeliver).Methods("POST")
+	for id, want := range map[string]int{event.ID: http.StatusConflict, "missing": http.StatusNotFound} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/outbox/"+id+"/redeliver", nil))
+		if rr.Code != want {
+			t.Errorf("Redelivering %s: expected %d, got %d", id, want, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "fmt"
+
+// MergePolicy sets what a PR needs before it can merge, by base branch.
+// The first policy with a Branches glob matching the PR's base applies
+// ("**" matches across "/", e.g. "release/**"); a policy without Branches
+// is the default for all other bases. Without such a policy, PRs to other
+// bases need MIN_REVIEWERS approvals.
+//
+// MinReviewers is the number of approvals needed. RequiredChecks run in
+// addition to REQUIRED_CHECKS for PRs the policy applies to.
+type MergePolicy struct {
+	Name           string   `json:"name"`
+	Branches       []string `json:"branches"`
+	MinReviewers   int      `json:"min_reviewers"`
+	RequiredChecks []string `json:"required_checks"`
+}
+
+func validatePolicies(policies []MergePolicy) error {
+	names := make(map[string]bool)
+	hasDefault := false
+	for i, policy := range policies {
+		if policy.Name == "" {
+			return fmt.Errorf("policy %d has no name", i)
+		}
+		if names[policy.Name] {
+			return fmt.Errorf("duplicate policy name %q", policy.Name)
+		}
+		names[policy.Name] = true
+		if policy.MinReviewers < 0 {
+			return fmt.Errorf("policy %q: min_reviewers must not be negative", policy.Name)
+		}
+		if len(policy.Branches) == 0 {
+			if hasDefault {
+				return fmt.Errorf("policy %q: only one policy may omit branches", policy.Name)
+			}
+			hasDefault = true
+		}
+		if err := validateGlobs(policy.Branches); err != nil {
+			return fmt.Errorf("policy %q: %w", policy.Name, err)
+		}
+	}
+	return nil
+}
+
+// mergePolicy returns the policy for PRs targeting base.
+func (rb *ReviewBot) mergePolicy(base string) MergePolicy {
+	var fallback *MergePolicy
+	for i, policy := range rb.config.Settings.Policies {
+		if len(policy.Branches) == 0 {
+			if fallback == nil {
+				fallback = &rb.config.Settings.Policies[i]
+			}
+			continue
+		}
+		if matchesAnyGlob(policy.Branches, base) {
+			return policy
+		}
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	return MergePolicy{Name: "default", MinReviewers: rb.config.MinReviewers}
+}
+
+// checks returns the checks to run under the policy: required, then the
+// policy's own.
+func (p MergePolicy) checks(required []string) []string {
+	checks := append([]string(nil), required...)
+	for _, check := range p.RequiredChecks {
+		if !containsString(checks, check) {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestMergePolicySelection(t *testing.T) {
+	bot := newTestBot(t, http.NewServeMux())
+	bot.config.MinReviewers = 2
+	if policy := bot.mergePolicy("main"); policy.Name != "default" || policy.MinReviewers != 2 {
+		t.Errorf("Expected MIN_REVIEWERS without policies, got %+v", policy)
+	}
+
+	bot.config.Settings.Policies = []MergePolicy{
+		{Name: "fallback", MinReviewers: 2},
+		{Name: "release", Branches: []string{"release/**"}, MinReviewers: 3, RequiredChecks: []string{"security", "test"}},
+		{Name: "feature", Branches: []string{"feature/*"}, MinReviewers: 1},
+	}
+	for base, want := range map[string]string{
+		"release/1.2":       "release",
+		"release/2024/q1":   "release",
+		"feature/login":     "feature",
+		"feature/a/b":       "fallback",
+		"main":              "fallback",
+		"prerelease/branch": "fallback",
+	} {
+		if got := bot.mergePolicy(base).Name; got != want {
+			t.Errorf("Expected %s to use the %s policy, got %s", base, want, got)
+		}
+	}
+
+	checks := bot.mergePolicy("release/1.2").checks([]string{"test", "lint"})
+	if want := []string{"test", "lint", "security"}; !reflect.DeepEqual(checks, want) {
+		t.Errorf("Expected checks %v, got %v", want, checks)
+	}
+
+	for _, policies := range [][]MergePolicy{
+		{{Branches: []string{"main"}}},
+		{{Name: "a"}, {Name: "b"}},
+		{{Name: "a", Branches: []string{"x"}}, {Name: "a", Branches: []string{"y"}}},
+		{{Name: "a", Branches: []string{"[release"}}},
+		{{Name: "a", MinReviewers: -1}},
+	} {
+		if err := validatePolicies(policies); err == nil {
+			t.Errorf("Expected %+v to be rejected", policies)
+		}
+	}
+}
+
+func review(login, state string) *github.PullRequestReview {
+	return &github.PullRequestReview{User: &github.User{Login: github.String(login)}, State: github.String(state)}
+}
+
+func TestCheckMergePolicyByBranch(t *testing.T) {
+	base := "release/1.2"
+	reviews := []*github.PullRequestReview{review("alice", "APPROVED"), review("bob", "APPROVED")}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.PullRequest{
+			Number: github.Int(1),
+			Head:   &github.PullRequestBranch{SHA: github.String("abc")},
+			Base:   &github.PullRequestBranch{Ref: github.String(base)},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(reviews)
+	})
+	bot := newTestBot(t, mux)
+	bot.config.Settings.Policies = []MergePolicy{
+		{Name: "release", Branches: []string{"release/*"}, MinReviewers: 3},
+		{Name: "feature", Branches: []string{"feature/*"}, MinReviewers: 1},
+	}
+
+	verdict := bot.checkMergePolicy(context.Background(), "o", "r", 1)
+	if verdict.CanMerge || verdict.Reason != "Need 3 approvals, have 2 (release policy)" {
+		t.Errorf("Expected the release policy to block, got %+v", verdict)
+	}
+
+	// Repeat approvals count once, and a later change request withdraws one
+	reviews = []*github.PullRequestReview{
+		review("alice", "APPROVED"), review("alice", "APPROVED"), review("alice", "APPROVED"),
+		review("bob", "APPROVED"), review("bob", "CHANGES_REQUESTED"), review("bob", "COMMENTED"),
+		review("carol", "APPROVED"), review("carol", "COMMENTED"),
+	}
+	verdict = bot.checkMergePolicy(context.Background(), "o", "r", 1)
+	if verdict.CanMerge || verdict.Reason != "Need 3 approvals, have 2 (release policy)" {
+		t.Errorf("Expected each reviewer's latest verdict to count once, got %+v", verdict)
+	}
+
+	base = "feature/x"
+	verdict = bot.checkMergePolicy(context.Background(), "o", "r", 1)
+	if !verdict.CanMerge || verdict.Reason != "All merge policies satisfied (feature policy)" {
+		t.Errorf("Expected the feature policy to allow merging, got %+v", verdict)
+	}
+}
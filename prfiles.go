@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// maxCheckDetails caps how many details a check lists in the PR comment.
+const maxCheckDetails = 50
+
+// listPRFiles returns every file changed by the pull request, following
+// pagination (GitHub returns at most 3000 files).
+func (rb *ReviewBot) listPRFiles(ctx context.Context, owner, repo string, prNumber int) ([]*github.CommitFile, error) {
+	var all []*github.CommitFile
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		files, resp, err := rb.client.PullRequests.ListFiles(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, files...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listPRCommits returns the pull request's commits, following pagination
+// (GitHub returns at most 250).
+func (rb *ReviewBot) listPRCommits(ctx context.Context, owner, repo string, prNumber int) ([]*github.RepositoryCommit, error) {
+	var all []*github.RepositoryCommit
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		commits, resp, err := rb.client.PullRequests.ListCommits(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, commits...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// fileContentAt returns the content of filePath at ref.
+func (rb *ReviewBot) fileContentAt(ctx context.Context, owner, repo, filePath, ref string) ([]byte, error) {
+	opts := &github.RepositoryContentGetOptions{Ref: ref}
+	file, _, _, err := rb.client.Repositories.GetContents(ctx, owner, repo, filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files over 1MB come back without inline content
+	if file.GetEncoding() == "none" && file.GetSize() > 0 {
+		rc, _, err := rb.client.Repositories.DownloadContents(ctx, owner, repo, filePath, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// addedLines returns the head-side line numbers added by a unified diff
+// patch as reported by the GitHub files API. It returns nil when there is no
+// patch (binary or oversized files), which callers treat as "every line".
+func addedLines(patch string) map[int]bool {
+	if patch == "" {
+		return nil
+	}
+
+	added := make(map[int]bool)
+	line := 0
+	for _, text := range strings.Split(patch, "\n") {
+		if m := hunkHeader.FindStringSubmatch(text); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, "+"):
+			added[line] = true
+			line++
+		case strings.HasPrefix(text, "-"), strings.HasPrefix(text, `\`):
+			// removed lines and "\ No newline at end of file" don't exist at head
+		default:
+			line++
+		}
+	}
+	return added
+}
+
+// isVendored reports whether filename lives in a vendored dependency tree.
+func isVendored(filename string) bool {
+	return strings.HasPrefix(filename, "vendor/") || strings.Contains(filename, "/vendor/") ||
+		strings.HasPrefix(filename, "third_party/") || path.Base(filename) == "go.sum"
+}
+
+var generatedHeader = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+// isGeneratedGo reports whether src carries the standard generated-code
+// header (https://go.dev/s/generatedcode).
+func isGeneratedGo(src []byte) bool {
+	return generatedHeader.Match(src)
+}
+
+// capDetails truncates details to max entries, noting how many were dropped.
+func capDetails(details []string, max int) []string {
+	if len(details) <= max {
+		return details
+	}
+	return append(details[:max:max], fmt.Sprintf("... and %d more", len(details)-max))
+}
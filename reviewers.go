@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Reviewer selection strategies.
+const (
+	StrategyRoundRobin = "round-robin"
+	StrategyLeastOpen  = "least-open-reviews"
+	StrategyRandom     = "random"
+)
+
+const reviewersStoreName = "reviewers"
+
+// ReviewerSettings configures reviewer requests for newly opened PRs.
+// Candidates are the CODEOWNERS owners of the changed files (when
+// CodeOwners is set) plus the members of every team whose Repos and Paths
+// match. Count reviewers are requested (as many as the merge policy for
+// the base branch needs when 0), picked by Strategy; the author and anyone
+// listed in OutOfOffice are never asked.
+type ReviewerSettings struct {
+	Strategy    string         `json:"strategy"`
+	Count       int            `json:"count"`
+	CodeOwners  bool           `json:"codeowners"`
+	Teams       []ReviewerTeam `json:"teams"`
+	OutOfOffice []string       `json:"out_of_office"`
+}
+
+// ReviewerTeam is a group of reviewers responsible for the repositories
+// matching Repos ("owner/repo" globs) and, within them, the files matching
+// Paths (autolabel-style globs). Empty Repos or Paths match everything. A
+// CODEOWNERS entry "@org/slug" expands to the team whose Name is "org/slug".
+type ReviewerTeam struct {
+	Name    string   `json:"name"`
+	Repos   []string `json:"repos"`
+	Paths   []string `json:"paths"`
+	Members []string `json:"members"`
+}
+
+func (s ReviewerSettings) validate() error {
+	switch s.Strategy {
+	case "", StrategyRoundRobin, StrategyLeastOpen, StrategyRandom:
+	default:
+		return fmt.Errorf("unknown strategy %q", s.Strategy)
+	}
+	if s.Count < 0 {
+		return fmt.Errorf("count must not be negative")
+	}
+	for i, team := range s.Teams {
+		if len(team.Members) == 0 {
+			return fmt.Errorf("team %d (%s) has no members", i, team.Name)
+		}
+		if err := validatePatterns(team.Repos); err != nil {
+			return fmt.Errorf("team %d (%s): %w", i, team.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s ReviewerSettings) enabled() bool {
+	return s.CodeOwners || len(s.Teams) > 0
+}
+
+func (s ReviewerSettings) strategy() string {
+	if s.Strategy != "" {
+		return s.Strategy
+	}
+	return StrategyRoundRobin
+}
+
+// ReviewerRotation remembers when each reviewer was last requested so that
+// round-robin assignment carries on where it left off after a restart.
+type ReviewerRotation struct {
+	mu           sync.Mutex
+	store        *Store
+	lastAssigned map[string]time.Time
+	now          func() time.Time
+}
+
+func NewReviewerRotation(store *Store) *ReviewerRotation {
+	rr := &ReviewerRotation{
+		store:        store,
+		lastAssigned: make(map[string]time.Time),
+		now:          time.Now,
+	}
+	if err := store.Load(reviewersStoreName, &rr.lastAssigned); err != nil {
+		log.Printf("Failed to load reviewer rotation: %v", err)
+	}
+	return rr
+}
+
+// Order sorts candidates so that whoever was requested longest ago (or
+// never) comes first.
+func (rr *ReviewerRotation) Order(candidates []string) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return rr.lastAssigned[candidates[i]].Before(rr.lastAssigned[candidates[j]])
+	})
+}
+
+// Assigned records that logins were just requested.
+func (rr *ReviewerRotation) Assigned(logins []string) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	now := rr.now().UTC()
+	for _, login := range logins {
+		rr.lastAssigned[login] = now
+	}
+	if err := rr.store.Save(reviewersStoreName, rr.lastAssigned); err != nil {
+		log.Printf("Failed to persist reviewer rotation: %v", err)
+	}
+}
+
+// CodeOwnersRule is one CODEOWNERS line.
+type CodeOwnersRule struct {
+	Pattern string
+	Owners  []string
+}
+
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// parseCodeOwners parses a CODEOWNERS file. Owners keep their "@" prefix
+// (e-mail owners are dropped; they can't be requested by login).
+func parseCodeOwners(src []byte) []CodeOwnersRule {
+	var rules []CodeOwnersRule
+	for _, line := range strings.Split(string(src), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rule := CodeOwnersRule{Pattern: fields[0]}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "@") {
+				rule.Owners = append(rule.Owners, owner)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// codeOwnersMatch reports whether a CODEOWNERS pattern (gitignore syntax)
+// matches filename.
+func codeOwnersMatch(pattern, filename string) bool {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.Trim(pattern, "/")
+	if !anchored {
+		pattern = "**/" + pattern
+	}
+	return matchGlob(pattern, filename) || matchGlob(pattern+"/**", filename)
+}
+
+// codeOwners returns the owners of filename; the last matching rule wins.
+func codeOwners(rules []CodeOwnersRule, filename string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if codeOwnersMatch(rules[i].Pattern, filename) {
+			return rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// reviewerCandidates returns the logins eligible to review files in
+// repository and any CODEOWNERS teams with no configured members, which are
+// requested as teams instead.
+func reviewerCandidates(settings ReviewerSettings, repository string, codeOwnerRules []CodeOwnersRule, files []*github.CommitFile) ([]string, []string) {
+	logins := make(map[string]bool)
+	teamSlugs := make(map[string]bool)
+	teams := make(map[string]ReviewerTeam)
+	for _, team := range settings.Teams {
+		if len(team.Repos) == 0 || matchesAny(team.Repos, repository) {
+			teams[team.Name] = team
+		}
+	}
+
+	for _, file := range files {
+		for _, owner := range codeOwners(codeOwnerRules, file.GetFilename()) {
+			owner = strings.TrimPrefix(owner, "@")
+			if !strings.Contains(owner, "/") {
+				logins[owner] = true
+				continue
+			}
+			if team, ok := teams[owner]; ok {
+				for _, member := range team.Members {
+					logins[member] = true
+				}
+				continue
+			}
+			if org, slug, _ := strings.Cut(owner, "/"); strings.EqualFold(org, strings.Split(repository, "/")[0]) {
+				teamSlugs[slug] = true
+			}
+		}
+	}
+	for _, team := range teams {
+		if !teamMatchesFiles(team, files) {
+			continue
+		}
+		for _, member := range team.Members {
+			logins[member] = true
+		}
+	}
+
+	return sortedKeys(logins), sortedKeys(teamSlugs)
+}
+
+func teamMatchesFiles(team ReviewerTeam, files []*github.CommitFile) bool {
+	if len(team.Paths) == 0 {
+		return true
+	}
+	for _, file := range files {
+		if matchesAnyGlob(team.Paths, file.GetFilename()) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// assignReviewers requests reviewers for a newly opened PR, or for a draft
+// once it is marked ready for review. It returns the logins and team slugs
+// it requested.
+func (rb *ReviewBot) assignReviewers(ctx context.Context, owner, repo string, pr *github.PullRequest) ([]string, []string, error) {
+	settings := rb.config.Settings.Reviewers
+	if !settings.enabled() || pr.GetDraft() {
+		return nil, nil, nil
+	}
+	ctx, span := tracer().Start(ctx, "assignReviewers", trace.WithAttributes(prAttributes(owner, repo, pr.GetNumber())...))
+	defer span.End()
+
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing files: %w", err)
+	}
+	var rules []CodeOwnersRule
+	if settings.CodeOwners {
+		for _, name := range codeOwnersPaths {
+			src, err := rb.fileContentAt(ctx, owner, repo, name, pr.GetBase().GetRef())
+			if err == nil {
+				rules = parseCodeOwners(src)
+				break
+			}
+			if !isNotFound(err) {
+				return nil, nil, fmt.Errorf("reading %s: %w", name, err)
+			}
+		}
+	}
+
+	candidates, teams := reviewerCandidates(settings, owner+"/"+repo, rules, files)
+
+	count := settings.Count
+	if count == 0 {
+		count = rb.mergePolicy(pr.GetBase().GetRef()).MinReviewers
+	}
+	unavailable := map[string]bool{strings.ToLower(pr.GetUser().GetLogin()): true}
+	for _, login := range settings.OutOfOffice {
+		unavailable[strings.ToLower(login)] = true
+	}
+	for _, user := range pr.RequestedReviewers {
+		unavailable[strings.ToLower(user.GetLogin())] = true
+		count--
+	}
+	var eligible []string
+	for _, login := range candidates {
+		if !unavailable[strings.ToLower(login)] {
+			eligible = append(eligible, login)
+		}
+	}
+
+	picked := rb.pickReviewers(ctx, owner, settings.strategy(), eligible, count)
+	if len(picked) == 0 && len(teams) == 0 {
+		return nil, nil, nil
+	}
+
+	request := github.ReviewersRequest{Reviewers: picked}
+	if len(picked) < count {
+		request.TeamReviewers = teams
+	}
+	if _, _, err := rb.client.PullRequests.RequestReviewers(ctx, owner, repo, pr.GetNumber(), request); err != nil {
+		span.RecordError(err)
+		return nil, nil, fmt.Errorf("requesting reviewers: %w", err)
+	}
+	// In shadow mode nobody was asked, so the rotation stays put
+	if !rb.shadowed(owner + "/" + repo) {
+		rb.reviewers.Assigned(picked)
+	}
+	return picked, request.TeamReviewers, nil
+}
+
+// pickReviewers chooses up to count of candidates using strategy.
+func (rb *ReviewBot) pickReviewers(ctx context.Context, owner, strategy string, candidates []string, count int) []string {
+	if count <= 0 || len(candidates) == 0 {
+		return nil
+	}
+
+	switch strategy {
+	case StrategyRandom:
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	case StrategyLeastOpen:
+		// Ties go to whoever was asked longest ago; if the counts can't
+		// be had, that is the order used
+		rb.reviewers.Order(candidates)
+		open, err := rb.openReviewCounts(ctx, owner, candidates)
+		if err != nil {
+			log.Printf("Falling back to round-robin reviewer assignment: %v", err)
+			break
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return open[candidates[i]] < open[candidates[j]] })
+	default:
+		rb.reviewers.Order(candidates)
+	}
+
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+	return candidates
+}
+
+// openReviewCounts returns how many open PRs in owner each of logins has
+// been asked to review.
+func (rb *ReviewBot) openReviewCounts(ctx context.Context, owner string, logins []string) (map[string]int, error) {
+	open := make(map[string]int)
+	for _, login := range logins {
+		query := fmt.Sprintf("is:pr is:open review-requested:%s user:%s", login, owner)
+		result, _, err := rb.client.Search.Issues(ctx, query, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}})
+		if err != nil {
+			return nil, fmt.Errorf("counting open reviews for %s: %w", login, err)
+		}
+		open[login] = result.GetTotal()
+	}
+	return open, nil
+}
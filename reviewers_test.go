@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const testCodeOwners = `# Default owners
+*           @alice
+/docs/      @dave # documentation
+*.proto     @my-org/api eve@example.com
+/pkg/store  @carol
+`
+
+func TestCodeOwners(t *testing.T) {
+	rules := parseCodeOwners([]byte(testCodeOwners))
+	tests := map[string][]string{
+		"main.go":                {"@alice"},
+		"docs/guide/setup.md":    {"@dave"},
+		"src/docs/readme.md":     {"@alice"},
+		"api/v1/service.proto":   {"@my-org/api"},
+		"pkg/store/store.go":     {"@carol"},
+		"pkg/storage/storage.go": {"@alice"},
+	}
+	for filename, want := range tests {
+		if got := codeOwners(rules, filename); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", filename, want, got)
+		}
+	}
+}
+
+func TestReviewerCandidates(t *testing.T) {
+	settings := ReviewerSettings{Teams: []ReviewerTeam{
+		{Name: "my-org/api", Members: []string{"frank", "grace"}},
+		{Name: "my-org/web", Paths: []string{"web/**"}, Members: []string{"heidi"}},
+		{Name: "other", Repos: []string{"other/*"}, Members: []string{"ivan"}},
+	}}
+	rules := parseCodeOwners([]byte(testCodeOwners + "/infra/ @my-org/sre\n"))
+	files := []*github.CommitFile{{Filename: github.String("api/v1/service.proto")}, {Filename: github.String("infra/main.tf")}}
+
+	logins, teams := reviewerCandidates(settings, "my-org/repo", rules, files)
+	if want := []string{"frank", "grace"}; !reflect.DeepEqual(logins, want) {
+		t.Errorf("Expected logins %v, got %v", want, logins)
+	}
+	if want := []string{"sre"}; !reflect.DeepEqual(teams, want) {
+		t.Errorf("Expected teams %v, got %v", want, teams)
+	}
+}
+
+func TestAssignReviewers(t *testing.T) {
+	var requests []github.ReviewersRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{{Filename: github.String("server/main.go")}})
+	})
+	mux.HandleFunc("/repos/o/r/contents/.github/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+	})
+	mux.HandleFunc("/repos/o/r/contents/CODEOWNERS", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "main" {
+			t.Errorf("Expected CODEOWNERS to be read from the base branch, got ref %q", r.URL.Query().Get("ref"))
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte("/server/ @alice @bob\n"))),
+		})
+	})
+	mux.HandleFunc("/repos/o/r/pulls/1/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		var request github.ReviewersRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		requests = append(requests, request)
+		json.NewEncoder(w).Encode(&github.PullRequest{})
+	})
+	searchDown := false
+	mux.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		if searchDown {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"message": "API rate limit exceeded"})
+			return
+		}
+		open := map[string]int{"alice": 4, "bob": 2, "carol": 1, "dave": 0}
+		login := strings.Fields(strings.TrimPrefix(r.URL.Query().Get("q"), "is:pr is:open review-requested:"))[0]
+		json.NewEncoder(w).Encode(&github.IssuesSearchResult{Total: github.Int(open[login])})
+	})
+
+	bot := newTestBot(t, mux)
+	store := NewStore(t.TempDir())
+	bot.reviewers = NewReviewerRotation(store)
+	clock := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	bot.reviewers.now = func() time.Time { clock = clock.Add(time.Minute); return clock }
+	bot.config.Settings.Reviewers = ReviewerSettings{
+		CodeOwners:  true,
+		Count:       1,
+		Teams:       []ReviewerTeam{{Name: "backend", Paths: []string{"server/**"}, Members: []string{"carol", "dave", "erin"}}},
+		OutOfOffice: []string{"erin"},
+	}
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		User:   &github.User{Login: github.String("dave")},
+		Base:   &github.PullRequestBranch{Ref: github.String("main")},
+	}
+
+	// Round-robin cycles through alice, bob and carol; dave wrote the PR and
+	// erin is away
+	var got []string
+	for i := 0; i < 4; i++ {
+		if i == 2 {
+			// Rotation state survives a restart
+			bot.reviewers = NewReviewerRotation(store)
+			bot.reviewers.now = func() time.Time { clock = clock.Add(time.Minute); return clock }
+		}
+		picked, _, err := bot.assignReviewers(context.Background(), "o", "r", pr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, picked...)
+	}
+	if want := []string{"alice", "bob", "carol", "alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected round-robin order %v, got %v", want, got)
+	}
+	if len(requests) != 4 || !reflect.DeepEqual(requests[0].Reviewers, []string{"alice"}) {
+		t.Errorf("Unexpected review requests %+v", requests)
+	}
+
+	bot.config.Settings.Reviewers.Strategy = StrategyLeastOpen
+	bot.config.Settings.Reviewers.Count = 2
+	pr.User.Login = github.String("someone")
+	picked, _, err := bot.assignReviewers(context.Background(), "o", "r", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dave", "carol"}; !reflect.DeepEqual(picked, want) {
+		t.Errorf("Expected the least loaded reviewers %v, got %v", want, picked)
+	}
+
+	// Without search results the rotation order is used
+	searchDown = true
+	picked, _, err = bot.assignReviewers(context.Background(), "o", "r", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bob", "alice"}; !reflect.DeepEqual(picked, want) {
+		t.Errorf("Expected a round-robin fallback %v, got %v", want, picked)
+	}
+
+	// Drafts wait until they are ready for review
+	requests = nil
+	pr.Draft = github.Bool(true)
+	if picked, _, err := bot.assignReviewers(context.Background(), "o", "r", pr); err != nil || picked != nil || requests != nil {
+		t.Errorf("Expected no reviewers on a draft, got %v %v %+v", picked, err, requests)
+	}
+
+	// Requests only recorded in shadow mode don't move the rotation
+	pr.Draft = nil
+	bot.config.Settings.Reviewers.Strategy = ""
+	bot.shadow.store = NewStore(t.TempDir())
+	bot.config.Settings.Shadow = ShadowSettings{Repos: []string{"o/r"}}
+	first, _, _ := bot.assignReviewers(context.Background(), "o", "r", pr)
+	second, _, _ := bot.assignReviewers(context.Background(), "o", "r", pr)
+	if len(first) != 2 || !reflect.DeepEqual(first, second) || requests != nil {
+		t.Errorf("Expected the same reviewers and no requests in shadow mode, got %v %v %+v", first, second, requests)
+	}
+}
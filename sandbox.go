@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCommandOutput caps how much of a sandboxed command's stdout and stderr
+// is kept.
+const maxCommandOutput = 16 << 20
+
+// passthroughEnv lists the host variables a sandboxed command may see.
+// Everything else is left out of its environment; that alone doesn't keep
+// secrets from code under test, which as the bot's user could read the
+// bot's environment from /proc (see ExecutorSettings.RunAs).
+var passthroughEnv = []string{
+	"PATH", "LANG", "GOPROXY", "GONOPROXY", "GOSUMDB", "GONOSUMDB", "GOPRIVATE",
+	"GOFLAGS", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+}
+
+// CommandResult is the outcome of a sandboxed command. A non-zero exit is
+// reported through ExitCode, not as an error.
+type CommandResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+	TimedOut bool
+	Duration time.Duration
+}
+
+// cappedBuffer keeps the first max bytes written to it and silently drops
+// the rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// sandboxEnv builds the environment for commands run in ws: a scrubbed copy
+// of the host's plus the workspace's Go caches.
+func sandboxEnv(ws *Workspace, settings ExecutorSettings) []string {
+	env := []string{
+		"HOME=" + filepath.Join(ws.root, "home"),
+		"TMPDIR=" + filepath.Join(ws.root, "tmp"),
+		"GOCACHE=" + filepath.Join(ws.goCacheDir(settings), "build"),
+		"GOMODCACHE=" + filepath.Join(ws.goCacheDir(settings), "mod"),
+		"GOPATH=" + filepath.Join(ws.root, "home", "go"),
+		"GOTOOLCHAIN=local",
+	}
+	if settings.CPUs > 0 {
+		env = append(env, "GOMAXPROCS="+strconv.Itoa(settings.CPUs))
+	}
+	if settings.MemoryMB > 0 {
+		// A soft limit lets the Go runtime collect harder before the hard
+		// ulimit kills it.
+		env = append(env, fmt.Sprintf("GOMEMLIMIT=%dMiB", settings.MemoryMB*9/10))
+	}
+	for _, name := range passthroughEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// runSandboxed runs name with args in dir (a directory inside ws) under the
+// executor's limits: wall-clock time through the context, CPU time and
+// address space through ulimit, and parallelism through GOMAXPROCS. With
+// RunAs set it runs as that user.
+func runSandboxed(ctx context.Context, ws *Workspace, settings ExecutorSettings, dir, name string, args ...string) (*CommandResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, settings.timeout())
+	defer cancel()
+
+	var limits []string
+	if settings.CPUSeconds > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", settings.CPUSeconds))
+	}
+	if settings.MemoryMB > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", settings.MemoryMB*1024))
+	}
+
+	var cmd *exec.Cmd
+	if len(limits) > 0 {
+		script := strings.Join(limits, " && ") + ` && exec "$0" "$@"`
+		cmd = exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", script, name}, args...)...)
+	} else {
+		cmd = exec.CommandContext(ctx, name, args...)
+	}
+	cmd.Dir = dir
+	cmd.Env = sandboxEnv(ws, settings)
+	stdout := &cappedBuffer{max: maxCommandOutput}
+	stderr := &cappedBuffer{max: maxCommandOutput}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	killProcessGroup(cmd)
+	if settings.RunAs != "" {
+		uid, gid, err := settings.runAs()
+		if err != nil {
+			return nil, err
+		}
+		if err := dropPrivileges(cmd, uid, gid); err != nil {
+			return nil, err
+		}
+	}
+	cmd.WaitDelay = 10 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	result := &CommandResult{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		Duration: time.Since(start),
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case result.TimedOut:
+		result.ExitCode = -1
+		return result, nil
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	case err != nil:
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// killProcessGroup is a no-op where process groups aren't available; the
+// context only kills the direct child.
+func killProcessGroup(cmd *exec.Cmd) {}
+
+func dropPrivileges(cmd *exec.Cmd, uid, gid uint32) error {
+	return errors.New("run_as is not supported on this platform")
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup runs cmd in its own process group and makes cancellation
+// kill the whole group, so test binaries spawned by go test don't outlive a
+// timeout.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// dropPrivileges makes cmd run as uid:gid without supplementary groups, so
+// it can't read the bot's files or /proc/<pid>/environ. It must follow
+// killProcessGroup.
+func dropPrivileges(cmd *exec.Cmd, uid, gid uint32) error {
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid}
+	return nil
+}
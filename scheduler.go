@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// parseSchedule parses a standard five-field cron expression (or a
+// descriptor such as "@daily") evaluated in timeZone, which defaults to UTC.
+func parseSchedule(spec, timeZone string) (cron.Schedule, error) {
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	schedule, err := cron.ParseStandard("CRON_TZ=" + timeZone + " " + spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q in %s: %w", spec, timeZone, err)
+	}
+	return schedule, nil
+}
+
+// newScheduler registers the bot's periodic jobs. The caller starts and
+// stops the returned scheduler.
+func (rb *ReviewBot) newScheduler(ctx context.Context) (*cron.Cron, error) {
+	scheduler := cron.New()
+
+	if digest := rb.config.Settings.Digest; digest.Schedule != "" {
+		schedule, err := parseSchedule(digest.Schedule, digest.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		scheduler.Schedule(schedule, cron.FuncJob(func() {
+			if _, err := rb.sendDigests(ctx); err != nil {
+				log.Printf("Digest run failed: %v", err)
+			}
+		}))
+		log.Printf("Scheduled e-mail digest: %s (%s)", digest.Schedule, digest.TimeZone)
+	}
+
+	if stale := rb.config.Settings.Stale; stale.Schedule != "" {
+		schedule, err := parseSchedule(stale.Schedule, stale.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		scheduler.Schedule(schedule, cron.FuncJob(func() {
+			report, err := rb.scanStale(ctx, time.Now())
+			if err != nil {
+				log.Printf("Stale scan failed: %v", err)
+			}
+			log.Printf("Stale scan: %d PRs, %d reminders, %d labelled stale, %d refreshed, %d closed",
+				report.Scanned, report.Reminders, report.Labelled, report.Refreshed, report.Closed)
+		}))
+		log.Printf("Scheduled stale PR scan: %s (%s)", stale.Schedule, stale.TimeZone)
+	}
+
+	return scheduler, nil
+}
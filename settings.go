@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// Settings holds configuration that is too structured for environment
+// variables. It is read from the JSON file named by CONFIG_FILE; ${VAR}
+// references are expanded from the environment so secrets can stay out of
+// the file.
+type Settings struct {
+	Subscribers  []Subscriber         `json:"subscribers"`
+	Slack        SlackSettings        `json:"slack"`
+	Notifiers    []NotifierSettings   `json:"notifiers"`
+	Jira         JiraSettings         `json:"jira"`
+	Digest       DigestSettings       `json:"digest"`
+	SMTP         SMTPSettings         `json:"smtp"`
+	Executor     ExecutorSettings     `json:"executor"`
+	Coverage     CoverageSettings     `json:"coverage"`
+	Dependencies DependencySettings   `json:"dependencies"`
+	Vulns        VulnSettings         `json:"vulns"`
+	Size         SizeSettings         `json:"size"`
+	Conventional ConventionalSettings `json:"conventional"`
+	Autolabel    AutolabelSettings    `json:"autolabel"`
+	Reviewers    ReviewerSettings     `json:"reviewers"`
+	Stale        StaleSettings        `json:"stale"`
+	AutoMerge    AutoMergeSettings    `json:"auto_merge"`
+	MergeQueue   MergeQueueSettings   `json:"merge_queue"`
+	Policies     []MergePolicy        `json:"policies"`
+	Freeze       FreezeSettings       `json:"freeze"`
+	Blockers     BlockerSettings      `json:"blockers"`
+	Description  DescriptionSettings  `json:"description"`
+	Shadow       ShadowSettings       `json:"shadow"`
+}
+
+// Subscriber is an outbound webhook receiver. Events and Repos narrow what it
+// receives; empty means everything. Repos entries are globs over
+// "owner/repo", e.g. "my-org/*".
+type Subscriber struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	Repos  []string `json:"repos"`
+}
+
+// LoadSettings reads the settings file at filename. A missing file yields
+// empty settings so the bot runs on environment configuration alone.
+func LoadSettings(filename string) (Settings, error) {
+	var settings Settings
+	if filename == "" {
+		return settings, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), &settings); err != nil {
+		return settings, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	if err := settings.validate(); err != nil {
+		return settings, fmt.Errorf("%s: %w", filename, err)
+	}
+	return settings, nil
+}
+
+func (s Settings) validate() error {
+	names := make(map[string]bool)
+	for i, sub := range s.Subscribers {
+		if sub.Name == "" {
+			return fmt.Errorf("subscriber %d has no name", i)
+		}
+		if sub.Name == legacySubscriber {
+			return fmt.Errorf("subscriber name %q is reserved for THIRD_PARTY_WEBHOOK_URL", sub.Name)
+		}
+		if names[sub.Name] {
+			return fmt.Errorf("duplicate subscriber name %q", sub.Name)
+		}
+		names[sub.Name] = true
+		if sub.URL == "" {
+			return fmt.Errorf("subscriber %q has no url", sub.Name)
+		}
+		for _, event := range sub.Events {
+			if !knownWebhookEvents[event] {
+				return fmt.Errorf("subscriber %q: unknown event %q", sub.Name, event)
+			}
+		}
+		if err := validatePatterns(sub.Repos); err != nil {
+			return fmt.Errorf("subscriber %q: %w", sub.Name, err)
+		}
+	}
+	for stage := range s.Jira.Transitions {
+		if stage != JiraOpened && stage != JiraMergeReady && stage != JiraMerged {
+			return fmt.Errorf("jira: unknown transition stage %q", stage)
+		}
+	}
+	for i, ns := range s.Notifiers {
+		if !notifierTypes[ns.Type] {
+			return fmt.Errorf("notifier %d: unknown type %q", i, ns.Type)
+		}
+		if ns.WebhookURL == "" {
+			return fmt.Errorf("notifier %d (%s) has no webhook_url", i, ns.Type)
+		}
+		if err := validatePatterns(ns.Repos); err != nil {
+			return fmt.Errorf("notifier %d (%s): %w", i, ns.Type, err)
+		}
+	}
+	if s.Digest.Schedule != "" {
+		if _, err := parseSchedule(s.Digest.Schedule, s.Digest.TimeZone); err != nil {
+			return fmt.Errorf("digest: %w", err)
+		}
+		if s.SMTP.Host == "" || s.Digest.From == "" {
+			return fmt.Errorf("digest: a schedule needs smtp.host and digest.from")
+		}
+	}
+	for i, w := range s.Digest.Watchers {
+		if err := validatePatterns(w.Repos); err != nil {
+			return fmt.Errorf("digest watchers %d: %w", i, err)
+		}
+	}
+	if err := s.Executor.validate(); err != nil {
+		return fmt.Errorf("executor: %w", err)
+	}
+	if err := s.Coverage.validate(); err != nil {
+		return fmt.Errorf("coverage: %w", err)
+	}
+	if err := s.Dependencies.validate(); err != nil {
+		return fmt.Errorf("dependencies: %w", err)
+	}
+	if err := s.Vulns.validate(); err != nil {
+		return fmt.Errorf("vulns: %w", err)
+	}
+	if err := s.Size.validate(); err != nil {
+		return fmt.Errorf("size: %w", err)
+	}
+	if err := s.Conventional.validate(); err != nil {
+		return fmt.Errorf("conventional: %w", err)
+	}
+	if err := s.Autolabel.validate(); err != nil {
+		return fmt.Errorf("autolabel: %w", err)
+	}
+	if err := s.Reviewers.validate(); err != nil {
+		return fmt.Errorf("reviewers: %w", err)
+	}
+	if err := s.Stale.validate(); err != nil {
+		return fmt.Errorf("stale: %w", err)
+	}
+	if err := s.AutoMerge.validate(); err != nil {
+		return fmt.Errorf("auto_merge: %w", err)
+	}
+	if err := s.MergeQueue.validate(); err != nil {
+		return fmt.Errorf("merge_queue: %w", err)
+	}
+	if err := validatePolicies(s.Policies); err != nil {
+		return err
+	}
+	if err := s.Freeze.validate(); err != nil {
+		return fmt.Errorf("freeze: %w", err)
+	}
+	if err := s.Shadow.validate(); err != nil {
+		return fmt.Errorf("shadow: %w", err)
+	}
+	for i, route := range s.Slack.Routes {
+		if len(route.Repos) == 0 {
+			return fmt.Errorf("slack route %d has no repos", i)
+		}
+		if err := validatePatterns(route.Repos); err != nil {
+			return fmt.Errorf("slack route %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Wants reports whether the subscriber should receive event for repository
+// ("owner/repo").
+func (s Subscriber) Wants(event, repository string) bool {
+	if len(s.Events) > 0 && !containsString(s.Events, event) {
+		return false
+	}
+	return len(s.Repos) == 0 || matchesAny(s.Repos, repository)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
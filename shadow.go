@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShadowSettings puts the bot in shadow mode, everywhere with Enabled or
+// for the repositories matching Repos ("owner/repo" globs). In shadow mode
+// the bot evaluates PRs as usual but makes no changes on GitHub: statuses,
+// comments, labels, reviewer requests, merges and branch updates are
+// logged and recorded instead, and can be reviewed at /admin/shadow. State
+// that follows those writes is left alone: the reviewer rotation and
+// reminder log don't advance, and the merge queue tests PR heads as they
+// are and records a "shadowed" outcome instead of a merge.
+type ShadowSettings struct {
+	Enabled bool     `json:"enabled"`
+	Repos   []string `json:"repos"`
+}
+
+func (s ShadowSettings) validate() error {
+	return validatePatterns(s.Repos)
+}
+
+func (s ShadowSettings) covers(repository string) bool {
+	return s.Enabled || (repository != "" && matchesAny(s.Repos, repository))
+}
+
+// ShadowAction is a GitHub write the bot would have made.
+type ShadowAction struct {
+	At         time.Time       `json:"at"`
+	Repository string          `json:"repository,omitempty"`
+	PRNumber   int             `json:"pr_number,omitempty"`
+	Action     string          `json:"action"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+const (
+	shadowStoreName   = "shadow"
+	shadowLogLimit    = 1000
+	shadowPayloadSize = 64 << 10
+)
+
+// ShadowLog records the actions suppressed in shadow mode. Covers decides
+// which repositories ("" for requests outside /repos) are in shadow mode.
+type ShadowLog struct {
+	mu      sync.Mutex
+	store   *Store
+	actions []ShadowAction
+
+	Covers func(repository string) bool
+}
+
+func NewShadowLog(store *Store) *ShadowLog {
+	sl := &ShadowLog{store: store}
+	if err := store.Load(shadowStoreName, &sl.actions); err != nil {
+		log.Printf("Failed to load shadow actions: %v", err)
+	}
+	return sl
+}
+
+// Record appends action to the log.
+func (sl *ShadowLog) Record(action ShadowAction) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.actions = append(sl.actions, action)
+	if len(sl.actions) > shadowLogLimit {
+		sl.actions = sl.actions[len(sl.actions)-shadowLogLimit:]
+	}
+	if err := sl.store.Save(shadowStoreName, sl.actions); err != nil {
+		log.Printf("Failed to persist shadow actions: %v", err)
+	}
+}
+
+// Actions returns the recorded actions for repository and PR, oldest
+// first; empty repository or zero prNumber match everything.
+func (sl *ShadowLog) Actions(repository string, prNumber int) []ShadowAction {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	actions := []ShadowAction{}
+	for _, action := range sl.actions {
+		if repository != "" && action.Repository != repository {
+			continue
+		}
+		if prNumber != 0 && action.PRNumber != prNumber {
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// Transport wraps base so that, for repositories in shadow mode, requests
+// that would change something on GitHub are recorded and answered with an
+// empty 204 instead of being sent.
+func (sl *ShadowLog) Transport(base http.RoundTripper) http.RoundTripper {
+	return shadowTransport{log: sl, base: base}
+}
+
+type shadowTransport struct {
+	log  *ShadowLog
+	base http.RoundTripper
+}
+
+func (t shadowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isWrite(req) {
+		return t.base.RoundTrip(req)
+	}
+	action := describeWrite(req.Method, req.URL.Path)
+	if t.log.Covers == nil || !t.log.Covers(action.Repository) {
+		return t.base.RoundTrip(req)
+	}
+
+	if req.Body != nil {
+		payload, err := io.ReadAll(io.LimitReader(req.Body, shadowPayloadSize+1))
+		req.Body.Close()
+		if err == nil && len(payload) <= shadowPayloadSize && json.Valid(payload) {
+			action.Payload = json.RawMessage(bytes.TrimSpace(payload))
+		}
+	}
+	action.At = time.Now().UTC()
+	t.log.Record(action)
+	if action.PRNumber != 0 {
+		log.Printf("Shadow mode: would %s on %s#%d", action.Action, action.Repository, action.PRNumber)
+	} else {
+		log.Printf("Shadow mode: would %s in %s (%s %s)", action.Action, action.Repository, action.Method, action.Path)
+	}
+
+	return &http.Response{
+		Status:     "204 No Content",
+		StatusCode: http.StatusNoContent,
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// isWrite reports whether req changes state on GitHub. GraphQL requests are
+// POSTs but the bot only queries.
+func isWrite(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return !strings.HasSuffix(req.URL.Path, "/graphql")
+}
+
+// describeWrite names the GitHub write at path in words for the shadow
+// log, along with the repository and PR it concerns.
+func describeWrite(method, path string) ShadowAction {
+	action := ShadowAction{Method: method, Path: path, Action: method + " " + path}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	// GitHub Enterprise Server serves the REST API under /api/v3
+	for len(parts) > 0 && parts[0] != "repos" {
+		parts = parts[1:]
+	}
+	if len(parts) < 3 {
+		return action
+	}
+	action.Repository = parts[1] + "/" + parts[2]
+	rest := parts[3:]
+	number := func(i int) int {
+		if len(rest) > i {
+			n, _ := strconv.Atoi(rest[i])
+			return n
+		}
+		return 0
+	}
+	at := func(i int, value string) bool { return len(rest) > i && rest[i] == value }
+
+	switch {
+	case at(0, "statuses"):
+		action.Action = "set a commit status"
+	case at(0, "issues") && at(1, "comments"):
+		action.Action = "edit a comment"
+	case at(0, "issues") && at(2, "comments"):
+		action.Action, action.PRNumber = "comment", number(1)
+	case at(0, "issues") && at(2, "labels") && method == http.MethodDelete:
+		action.Action, action.PRNumber = "remove a label", number(1)
+	case at(0, "issues") && at(2, "labels"):
+		action.Action, action.PRNumber = "add labels", number(1)
+	case at(0, "labels"):
+		action.Action = "create a label"
+	case at(0, "pulls") && at(2, "merge"):
+		action.Action, action.PRNumber = "merge", number(1)
+	case at(0, "pulls") && at(2, "requested_reviewers"):
+		action.Action, action.PRNumber = "request reviewers", number(1)
+	case at(0, "pulls") && at(2, "update-branch"):
+		action.Action, action.PRNumber = "update the branch", number(1)
+	case at(0, "pulls") && len(rest) == 2:
+		action.Action, action.PRNumber = "edit the pull request", number(1)
+	case at(0, "merges"):
+		action.Action = "merge into a branch"
+	case at(0, "git") && at(1, "refs") && method == http.MethodPost:
+		action.Action = "create a branch"
+	case at(0, "git") && at(1, "refs") && method == http.MethodDelete:
+		action.Action = "delete a branch"
+	case at(0, "git") && at(1, "refs"):
+		action.Action = "reset a branch"
+	}
+	return action
+}
+
+// shadowed reports whether repository is in shadow mode.
+func (rb *ReviewBot) shadowed(repository string) bool {
+	return rb.config.Settings.Shadow.covers(repository)
+}
+
+// handleShadow lists the actions shadow mode held back, optionally for one
+// repository (?repo=owner/repo) and PR (?pr=12).
+func (rb *ReviewBot) handleShadow(w http.ResponseWriter, r *http.Request) {
+	prNumber := 0
+	if pr := r.URL.Query().Get("pr"); pr != "" {
+		n, err := strconv.Atoi(pr)
+		if err != nil {
+			http.Error(w, "Invalid pull request number", http.StatusBadRequest)
+			return
+		}
+		prNumber = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled": rb.config.Settings.Shadow.Enabled,
+		"repos":   rb.config.Settings.Shadow.Repos,
+		"actions": rb.shadow.Actions(r.URL.Query().Get("repo"), prNumber),
+	})
+}
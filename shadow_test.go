@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestShadowModeRecordsWrites(t *testing.T) {
+	var sent []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{}`))
+	})
+
+	bot := newTestBot(t, mux)
+	bot.shadow.store = NewStore(t.TempDir())
+	bot.shadow.actions = nil
+	bot.config.Settings.Shadow = ShadowSettings{Repos: []string{"o/shadowed"}}
+	ctx := context.Background()
+
+	comment, _, err := bot.client.Issues.CreateComment(ctx, "o", "shadowed", 3, &github.IssueComment{Body: github.String("hello")})
+	if err != nil || comment.GetID() != 0 {
+		t.Fatalf("Expected an empty comment and no error, got %+v, %v", comment, err)
+	}
+	if _, _, err := bot.client.PullRequests.Merge(ctx, "o", "shadowed", 3, "", &github.PullRequestOptions{SHA: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bot.client.PullRequests.Get(ctx, "o", "shadowed", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bot.client.Issues.CreateComment(ctx, "o", "live", 3, &github.IssueComment{Body: github.String("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 2 || sent[0] != "GET /repos/o/shadowed/pulls/3" || sent[1] != "POST /repos/o/live/issues/3/comments" {
+		t.Errorf("Expected only the read and the write to the live repo to be sent, got %v", sent)
+	}
+	actions := bot.shadow.Actions("o/shadowed", 3)
+	if len(actions) != 2 || actions[0].Action != "comment" || actions[1].Action != "merge" {
+		t.Fatalf("Expected the comment and merge to be recorded, got %+v", actions)
+	}
+	var payload github.IssueComment
+	if err := json.Unmarshal(actions[0].Payload, &payload); err != nil || payload.GetBody() != "hello" {
+		t.Errorf("Expected the comment body to be recorded, got %s", actions[0].Payload)
+	}
+
+	reloaded := NewShadowLog(bot.shadow.store)
+	if len(reloaded.Actions("", 0)) != 2 {
+		t.Errorf("Expected the actions to be persisted, got %+v", reloaded.Actions("", 0))
+	}
+}
+
+func TestDescribeWrite(t *testing.T) {
+	for _, tc := range []struct {
+		method, path string
+		repository   string
+		prNumber     int
+		action       string
+	}{
+		{"POST", "/repos/o/r/statuses/abc", "o/r", 0, "set a commit status"},
+		{"PATCH", "/api/v3/repos/o/r/issues/comments/9", "o/r", 0, "edit a comment"},
+		{"DELETE", "/repos/o/r/issues/4/labels/ready", "o/r", 4, "remove a label"},
+		{"POST", "/repos/o/r/pulls/4/requested_reviewers", "o/r", 4, "request reviewers"},
+		{"PATCH", "/repos/o/r/pulls/4", "o/r", 4, "edit the pull request"},
+		{"DELETE", "/repos/o/r/git/refs/heads/review-bot/queue/4", "o/r", 0, "delete a branch"},
+		{"PUT", "/user/starred/o/r", "", 0, "PUT /user/starred/o/r"},
+	} {
+		action := describeWrite(tc.method, tc.path)
+		if action.Repository != tc.repository || action.PRNumber != tc.prNumber || action.Action != tc.action {
+			t.Errorf("%s %s: expected %s #%d %q, got %+v", tc.method, tc.path, tc.repository, tc.prNumber, tc.action, action)
+		}
+	}
+}
+
+func TestShadowAPI(t *testing.T) {
+	bot := newTestBot(t, http.NewServeMux())
+	bot.shadow = NewShadowLog(NewStore(t.TempDir()))
+	bot.config.Settings.Shadow = ShadowSettings{Enabled: true}
+	bot.shadow.Record(ShadowAction{Repository: "o/r", PRNumber: 1, Action: "merge"})
+	bot.shadow.Record(ShadowAction{Repository: "o/r", PRNumber: 2, Action: "comment"})
+	bot.shadow.Record(ShadowAction{Repository: "o/other", PRNumber: 1, Action: "comment"})
+
+	rr := httptest.NewRecorder()
+	bot.handleShadow(rr, httptest.NewRequest("GET", "/admin/shadow?repo=o/r&pr=1", nil))
+	var resp struct {
+		Enabled bool           `json:"enabled"`
+		Actions []ShadowAction `json:"actions"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if !resp.Enabled || len(resp.Actions) != 1 || resp.Actions[0].Action != "merge" {
+		t.Errorf("Expected the merge on o/r#1, got %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	bot.handleShadow(rr, httptest.NewRequest("GET", "/admin/shadow?pr=one", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// SizeSettings configures the size check. A PR's size is its added plus
+// deleted lines, not counting vendored files or files matching Exclude
+// (path.Match globs over the repository path; patterns without a "/" also
+// match the base name, and "dir/..." matches everything under dir).
+//
+// Thresholds are the smallest sizes labelled S, M, L and XL; anything below
+// the first is XS. The check warns above WarnAbove and fails above
+// FailAbove (0 disables either). Labels are named LabelPrefix plus the size.
+type SizeSettings struct {
+	Exclude     []string `json:"exclude"`
+	Thresholds  []int    `json:"thresholds"`
+	WarnAbove   int      `json:"warn_above"`
+	FailAbove   int      `json:"fail_above"`
+	LabelPrefix string   `json:"label_prefix"`
+	NoLabels    bool     `json:"no_labels"`
+}
+
+// sizeNames are the size buckets, smallest first.
+var sizeNames = []string{"XS", "S", "M", "L", "XL"}
+
+var defaultSizeThresholds = []int{10, 100, 500, 1000}
+
+func (s SizeSettings) validate() error {
+	if len(s.Thresholds) != 0 && len(s.Thresholds) != len(sizeNames)-1 {
+		return fmt.Errorf("thresholds needs %d values", len(sizeNames)-1)
+	}
+	for i, t := range s.Thresholds {
+		if t <= 0 || (i > 0 && t <= s.Thresholds[i-1]) {
+			return fmt.Errorf("thresholds must be positive and increasing")
+		}
+	}
+	if s.WarnAbove < 0 || s.FailAbove < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	for _, pattern := range s.Exclude {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/..."), ""); err != nil {
+			return fmt.Errorf("bad pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// configured reports whether any size setting is set.
+func (s SizeSettings) configured() bool {
+	return len(s.Exclude) > 0 || len(s.Thresholds) > 0 || s.WarnAbove > 0 || s.FailAbove > 0 || s.LabelPrefix != ""
+}
+
+func (s SizeSettings) labelPrefix() string {
+	if s.LabelPrefix != "" {
+		return s.LabelPrefix
+	}
+	return "size/"
+}
+
+// sizeName returns the bucket for a PR that changes lines lines.
+func (s SizeSettings) sizeName(lines int) string {
+	thresholds := s.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = defaultSizeThresholds
+	}
+	name := sizeNames[0]
+	for i, t := range thresholds {
+		if lines >= t {
+			name = sizeNames[i+1]
+		}
+	}
+	return name
+}
+
+// excluded reports whether filename is left out of the size.
+func (s SizeSettings) excluded(filename string) bool {
+	if isVendored(filename) {
+		return true
+	}
+	for _, pattern := range s.Exclude {
+		if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+			if strings.HasPrefix(filename, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, filename); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(filename)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// prSize is a PR's changed lines, not counting excluded files.
+type prSize struct {
+	additions, deletions int
+	files, excluded      int
+}
+
+func (rb *ReviewBot) measureSize(ctx context.Context, owner, repo string, pr *github.PullRequest) (prSize, error) {
+	settings := rb.config.Settings.Size
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return prSize{}, err
+	}
+
+	var size prSize
+	for _, file := range files {
+		if settings.excluded(file.GetFilename()) {
+			size.excluded++
+			continue
+		}
+		size.files++
+		size.additions += file.GetAdditions()
+		size.deletions += file.GetDeletions()
+	}
+	return size, nil
+}
+
+func (rb *ReviewBot) runSizeCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	settings := rb.config.Settings.Size
+	measured, err := rb.measureSize(ctx, owner, repo, pr)
+	if err != nil {
+		return CheckResult{Name: "size", Status: "error", Message: fmt.Sprintf("Failed to list changed files: %v", err)}
+	}
+	lines := measured.additions + measured.deletions
+	size := settings.sizeName(lines)
+
+	result := CheckResult{
+		Name:    "size",
+		Status:  "success",
+		Message: fmt.Sprintf("Size %s: +%d -%d in %d files", size, measured.additions, measured.deletions, measured.files),
+	}
+	if measured.excluded > 0 {
+		result.Message += fmt.Sprintf(" (%d excluded)", measured.excluded)
+	}
+	switch {
+	case settings.FailAbove > 0 && lines > settings.FailAbove:
+		result.Status = "failure"
+		result.Details = []string{fmt.Sprintf("%d changed lines exceeds the limit of %d; consider splitting this PR", lines, settings.FailAbove)}
+	case settings.WarnAbove > 0 && lines > settings.WarnAbove:
+		result.Status = "warning"
+		result.Details = []string{fmt.Sprintf("%d changed lines is above %d; consider splitting this PR", lines, settings.WarnAbove)}
+	}
+	return result
+}
+
+// labelSize keeps the PR's size label current. PRs are labelled, unless
+// NoLabels is set, when the size check runs on them or when any size
+// setting is configured, whether or not the check is required.
+func (rb *ReviewBot) labelSize(ctx context.Context, owner, repo string, pr *github.PullRequest) {
+	settings := rb.config.Settings.Size
+	if settings.NoLabels {
+		return
+	}
+	if !settings.configured() && !containsString(rb.mergePolicy(pr.GetBase().GetRef()).checks(rb.config.RequiredChecks), "size") {
+		return
+	}
+	measured, err := rb.measureSize(ctx, owner, repo, pr)
+	if err != nil {
+		log.Printf("Failed to list files for the size label on %s/%s#%d: %v", owner, repo, pr.GetNumber(), err)
+		return
+	}
+	label := settings.labelPrefix() + settings.sizeName(measured.additions+measured.deletions)
+	if err := rb.setSizeLabel(ctx, owner, repo, pr, label); err != nil {
+		log.Printf("Failed to update size label on %s/%s#%d: %v", owner, repo, pr.GetNumber(), err)
+	}
+}
+
+// setSizeLabel makes label the PR's only size label, removing stale ones
+// left from earlier pushes.
+func (rb *ReviewBot) setSizeLabel(ctx context.Context, owner, repo string, pr *github.PullRequest, label string) error {
+	prefix := rb.config.Settings.Size.labelPrefix()
+	present := false
+	for _, l := range pr.Labels {
+		name := l.GetName()
+		if name == label {
+			present = true
+			continue
+		}
+		if !isSizeLabel(prefix, name) {
+			continue
+		}
+		if _, err := rb.client.Issues.RemoveLabelForIssue(ctx, owner, repo, pr.GetNumber(), name); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	if present {
+		return nil
+	}
+	_, _, err := rb.client.Issues.AddLabelsToIssue(ctx, owner, repo, pr.GetNumber(), []string{label})
+	return err
+}
+
+func isSizeLabel(prefix, name string) bool {
+	size, ok := strings.CutPrefix(name, prefix)
+	return ok && containsString(sizeNames, size)
+}
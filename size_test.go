@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestSizeName(t *testing.T) {
+	var settings SizeSettings
+	tests := map[int]string{0: "XS", 9: "XS", 10: "S", 99: "S", 100: "M", 500: "L", 999: "L", 1000: "XL", 50000: "XL"}
+	for lines, want := range tests {
+		if got := settings.sizeName(lines); got != want {
+			t.Errorf("%d lines: expected %s, got %s", lines, want, got)
+		}
+	}
+
+	if err := (SizeSettings{Thresholds: []int{10, 5, 20, 30}}).validate(); err == nil {
+		t.Error("Expected decreasing thresholds to be rejected")
+	}
+}
+
+func TestSizeExcluded(t *testing.T) {
+	settings := SizeSettings{Exclude: []string{"*.pb.go", "docs/...", "web/dist/*.js"}}
+	tests := map[string]bool{
+		"api/v1/service.pb.go":   true,
+		"docs/guide/intro.md":    true,
+		"web/dist/app.js":        true,
+		"vendor/a/b.go":          true,
+		"go.sum":                 true,
+		"web/src/app.js":         false,
+		"docsite/index.md":       false,
+		"api/v1/service.go":      false,
+		"web/dist/nested/app.js": false,
+	}
+	for filename, want := range tests {
+		if got := settings.excluded(filename); got != want {
+			t.Errorf("%s: expected excluded=%v, got %v", filename, want, got)
+		}
+	}
+}
+
+func TestRunSizeCheck(t *testing.T) {
+	var added []string
+	var removed []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{
+			{Filename: github.String("main.go"), Additions: github.Int(420), Deletions: github.Int(100)},
+			{Filename: github.String("api/api.pb.go"), Additions: github.Int(5000)},
+			{Filename: github.String("go.sum"), Additions: github.Int(80), Deletions: github.Int(12)},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+		var labels []string
+		json.NewDecoder(r.Body).Decode(&labels)
+		added = append(added, labels...)
+		json.NewEncoder(w).Encode([]*github.Label{})
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/labels/", func(w http.ResponseWriter, r *http.Request) {
+		removed = append(removed, strings.TrimPrefix(r.URL.Path, "/repos/o/r/issues/1/labels/"))
+	})
+
+	bot := newTestBot(t, mux)
+	bot.config.Settings.Size = SizeSettings{Exclude: []string{"*.pb.go"}, WarnAbove: 400, FailAbove: 1000}
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Labels: []*github.Label{{Name: github.String("size/XL")}, {Name: github.String("bug")}},
+	}
+
+	result := bot.runSpecificCheck(context.Background(), "o", "r", pr, "size")
+	if result.Status != "warning" || result.Message != "Size L: +420 -100 in 1 files (2 excluded)" {
+		t.Errorf("Unexpected result %s: %s", result.Status, result.Message)
+	}
+	if len(added)+len(removed) != 0 {
+		t.Errorf("Expected the check to leave labels alone, added %v removed %v", added, removed)
+	}
+	bot.labelSize(context.Background(), "o", "r", pr)
+	if !reflect.DeepEqual(added, []string{"size/L"}) || !reflect.DeepEqual(removed, []string{"size/XL"}) {
+		t.Errorf("Expected size/XL to be replaced by size/L, added %v removed %v", added, removed)
+	}
+
+	// An up-to-date label is left alone
+	added, removed = nil, nil
+	pr.Labels = []*github.Label{{Name: github.String("size/L")}}
+	bot.config.Settings.Size.FailAbove = 500
+	result = bot.runSpecificCheck(context.Background(), "o", "r", pr, "size")
+	if result.Status != "failure" {
+		t.Errorf("Expected failure above the limit, got %s: %s", result.Status, result.Message)
+	}
+	bot.labelSize(context.Background(), "o", "r", pr)
+	if len(added)+len(removed) != 0 {
+		t.Errorf("Expected no label changes, added %v removed %v", added, removed)
+	}
+
+	// Labelling does not depend on the check being required
+	pr.Labels = nil
+	bot.config.RequiredChecks = []string{"test"}
+	bot.labelSize(context.Background(), "o", "r", pr)
+	if !reflect.DeepEqual(added, []string{"size/L"}) {
+		t.Errorf("Expected size/L to be added, added %v", added)
+	}
+
+	// Without size settings only a required size check labels
+	added = nil
+	bot.config.Settings.Size = SizeSettings{}
+	bot.labelSize(context.Background(), "o", "r", pr)
+	if len(added) != 0 {
+		t.Errorf("Expected no size label, added %v", added)
+	}
+}
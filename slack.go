@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SlackSettings configures the Slack notifier. WebhookURL is the default
+// incoming webhook (falling back to SLACK_WEBHOOK_URL); Routes send matching
+// repositories to a different webhook and/or channel.
+type SlackSettings struct {
+	WebhookURL string       `json:"webhook_url"`
+	Channel    string       `json:"channel"`
+	Routes     []SlackRoute `json:"routes"`
+}
+
+type SlackRoute struct {
+	Repos      []string `json:"repos"`
+	WebhookURL string   `json:"webhook_url"`
+	Channel    string   `json:"channel"`
+}
+
+// slackDestination resolves the webhook URL and channel override for
+// repository. The first matching route wins.
+func (rb *ReviewBot) slackDestination(repository string) (string, string) {
+	slack := rb.config.Settings.Slack
+	webhookURL := slack.WebhookURL
+	if webhookURL == "" {
+		webhookURL = rb.config.SlackWebhookURL
+	}
+	channel := slack.Channel
+
+	for _, route := range slack.Routes {
+		if !matchesAny(route.Repos, repository) {
+			continue
+		}
+		if route.WebhookURL != "" {
+			webhookURL = route.WebhookURL
+		}
+		if route.Channel != "" {
+			channel = route.Channel
+		}
+		break
+	}
+	return webhookURL, channel
+}
+
+type slackText struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
+
+type slackElement struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+	URL  string     `json:"url,omitempty"`
+}
+
+type slackBlock struct {
+	Type      string        `json:"type"`
+	Text      *slackText    `json:"text,omitempty"`
+	Elements  []interface{} `json:"elements,omitempty"`
+	Accessory *slackElement `json:"accessory,omitempty"`
+}
+
+type SlackMessage struct {
+	Channel string       `json:"channel,omitempty"`
+	Text    string       `json:"text"`
+	Blocks  []slackBlock `json:"blocks"`
+}
+
+// slackMessage renders eval as a Block Kit message. Text is the plain
+// fallback shown in notifications.
+func slackMessage(eval Evaluation, channel string) SlackMessage {
+	verdict := ":white_check_mark: *Ready to merge*"
+	if !eval.CanMerge {
+		verdict = ":hourglass_flowing_sand: *Not ready to merge*"
+	}
+
+	title := summaryTitle(eval)
+
+	summary := fmt.Sprintf("%s — %s", verdict, slackEscape(eval.Reason))
+	if eval.Author != "" {
+		summary += fmt.Sprintf("\nOpened by *%s*", slackEscape(eval.Author))
+	}
+
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: truncate(title, 150), Emoji: true}},
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: summary}},
+	}
+	if eval.URL != "" {
+		blocks[1].Accessory = &slackElement{
+			Type: "button",
+			Text: &slackText{Type: "plain_text", Text: "View pull request"},
+			URL:  eval.URL,
+		}
+	}
+
+	if len(eval.Checks) > 0 {
+		var lines []string
+		for _, check := range eval.Checks {
+			lines = append(lines, fmt.Sprintf("%s *%s*: %s", slackStatusEmoji(check.Status), check.Name, slackEscape(check.Message)))
+		}
+		blocks = append(blocks,
+			slackBlock{Type: "divider"},
+			slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncate(strings.Join(lines, "\n"), 3000)}},
+		)
+	}
+
+	if eval.HeadSHA != "" {
+		blocks = append(blocks, slackBlock{
+			Type:     "context",
+			Elements: []interface{}{slackText{Type: "mrkdwn", Text: "Head `" + shortSHA(eval.HeadSHA) + "`"}},
+		})
+	}
+
+	readiness := "ready to merge"
+	if !eval.CanMerge {
+		readiness = "not ready to merge"
+	}
+	return SlackMessage{
+		Channel: channel,
+		Text:    fmt.Sprintf("%s is %s: %s", title, readiness, eval.Reason),
+		Blocks:  blocks,
+	}
+}
+
+func slackStatusEmoji(status string) string {
+	switch status {
+	case "failure":
+		return ":x:"
+	case "warning":
+		return ":warning:"
+	case "error":
+		return ":red_circle:"
+	case "skipped":
+		return ":fast_forward:"
+	default:
+		return ":white_check_mark:"
+	}
+}
+
+// slackEscape escapes the characters Slack treats as control sequences in
+// mrkdwn text.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSlackDestinationRouting(t *testing.T) {
+	bot := NewReviewBot(NewConfig())
+	bot.config.SlackWebhookURL = "https://hooks.slack.test/env"
+	bot.config.Settings.Slack = SlackSettings{
+		Channel: "#code-reviews",
+		Routes: []SlackRoute{
+			{Repos: []string{"acme/payments-*"}, Channel: "#payments"},
+			{Repos: []string{"oss/*"}, WebhookURL: "https://hooks.slack.test/oss"},
+		},
+	}
+
+	tests := []struct {
+		repo, url, channel string
+	}{
+		{"acme/payments-api", "https://hooks.slack.test/env", "#payments"},
+		{"oss/tool", "https://hooks.slack.test/oss", "#code-reviews"},
+		{"acme/web", "https://hooks.slack.test/env", "#code-reviews"},
+	}
+	for _, tt := range tests {
+		url, channel := bot.slackDestination(tt.repo)
+		if url != tt.url || channel != tt.channel {
+			t.Errorf("slackDestination(%s) = (%s, %s), want (%s, %s)", tt.repo, url, channel, tt.url, tt.channel)
+		}
+	}
+}
+
+func TestSlackMessageBlocks(t *testing.T) {
+	eval := Evaluation{
+		Repository: "acme/api",
+		PRNumber:   12,
+		Title:      "Add <retry> support",
+		URL:        "https://github.com/acme/api/pull/12",
+		Author:     "octocat",
+		HeadSHA:    "0123456789abcdef",
+		CanMerge:   false,
+		Reason:     "Need 2 approvals, have 1",
+		Checks: []CheckResult{
+			{Name: "test", Status: "success", Message: "All tests passed"},
+			{Name: "security", Status: "failure", Message: "Potential security issues found in 1 files"},
+		},
+	}
+
+	data, err := json.Marshal(slackMessage(eval, "#code-reviews"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(data)
+
+	for _, want := range []string{
+		`"channel":"#code-reviews"`,
+		`"type":"header"`,
+		`Not ready to merge`,
+		`"url":"https://github.com/acme/api/pull/12"`,
+		`:x: *security*`,
+		"Head `0123456`",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected Slack message to contain %q, got %s", want, body)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+const remindersStoreName = "reminders"
+
+// StaleSettings configures the scheduled scan of open PRs in Repos
+// ("owner/repo"). Schedule is a cron expression evaluated in TimeZone,
+// which is also where business hours are counted.
+//
+// Requested reviewers who haven't reviewed after ReminderHours business
+// hours (WorkdayStart to WorkdayEnd, Monday to Friday) are pinged once per
+// request, unless the PR is already stale. PRs with no activity for
+// StaleDays get StaleLabel; stale PRs still untouched CloseDays later are
+// closed. Zero disables each rule, and PRs carrying one of ExemptLabels are
+// never marked stale.
+type StaleSettings struct {
+	Schedule      string   `json:"schedule"`
+	TimeZone      string   `json:"time_zone"`
+	Repos         []string `json:"repos"`
+	ReminderHours int      `json:"reminder_hours"`
+	WorkdayStart  int      `json:"workday_start"`
+	WorkdayEnd    int      `json:"workday_end"`
+	StaleDays     int      `json:"stale_days"`
+	CloseDays     int      `json:"close_days"`
+	StaleLabel    string   `json:"stale_label"`
+	ExemptLabels  []string `json:"exempt_labels"`
+}
+
+func (s StaleSettings) validate() error {
+	if s.Schedule == "" {
+		return nil
+	}
+	if _, err := parseSchedule(s.Schedule, s.TimeZone); err != nil {
+		return err
+	}
+	if len(s.Repos) == 0 {
+		return fmt.Errorf("a schedule needs repos")
+	}
+	for _, repository := range s.Repos {
+		if owner, repo, ok := strings.Cut(repository, "/"); !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return fmt.Errorf("repos must be owner/repo, got %q", repository)
+		}
+	}
+	if s.ReminderHours < 0 || s.StaleDays < 0 || s.CloseDays < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+	start, end := s.workday()
+	if start < 0 || end > 24 || start >= end {
+		return fmt.Errorf("workday must be within 0-24 and start before it ends")
+	}
+	return nil
+}
+
+func (s StaleSettings) workday() (int, int) {
+	if s.WorkdayStart == 0 && s.WorkdayEnd == 0 {
+		return 9, 17
+	}
+	return s.WorkdayStart, s.WorkdayEnd
+}
+
+func (s StaleSettings) staleLabel() string {
+	if s.StaleLabel != "" {
+		return s.StaleLabel
+	}
+	return "stale"
+}
+
+func (s StaleSettings) location() *time.Location {
+	if loc, err := time.LoadLocation(s.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// businessHours returns how much of [from, to) falls within working hours
+// on weekdays in loc.
+func businessHours(from, to time.Time, loc *time.Location, startHour, endHour int) time.Duration {
+	var total time.Duration
+	from, to = from.In(loc), to.In(loc)
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			continue
+		}
+		// Not day.Add: days are 23 or 25 hours long when DST changes
+		open := time.Date(day.Year(), day.Month(), day.Day(), startHour, 0, 0, 0, loc)
+		shut := time.Date(day.Year(), day.Month(), day.Day(), endHour, 0, 0, 0, loc)
+		if open.Before(from) {
+			open = from
+		}
+		if shut.After(to) {
+			shut = to
+		}
+		if shut.After(open) {
+			total += shut.Sub(open)
+		}
+	}
+	return total
+}
+
+// ReminderLog remembers which review requests have already been pinged so
+// a reviewer is reminded once per request, across restarts.
+type ReminderLog struct {
+	mu       sync.Mutex
+	store    *Store
+	reminded map[string]time.Time
+}
+
+func NewReminderLog(store *Store) *ReminderLog {
+	rl := &ReminderLog{store: store, reminded: make(map[string]time.Time)}
+	if err := store.Load(remindersStoreName, &rl.reminded); err != nil {
+		log.Printf("Failed to load reminders: %v", err)
+	}
+	return rl
+}
+
+func reminderKey(repository string, prNumber int, login string) string {
+	return fmt.Sprintf("%s#%d@%s", repository, prNumber, login)
+}
+
+// Due reports whether the request made at requestedAt hasn't been pinged.
+func (rl *ReminderLog) Due(key string, requestedAt time.Time) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.reminded[key].Before(requestedAt)
+}
+
+func (rl *ReminderLog) Reminded(key string, requestedAt time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.reminded[key] = requestedAt
+	rl.saveLocked()
+}
+
+// Prune forgets reminders for repository's PRs that aren't in open.
+func (rl *ReminderLog) Prune(repository string, open map[int]bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	pruned := false
+	for key := range rl.reminded {
+		var number int
+		rest, found := strings.CutPrefix(key, repository+"#")
+		if !found {
+			continue
+		}
+		if _, err := fmt.Sscanf(rest, "%d@", &number); err == nil && !open[number] {
+			delete(rl.reminded, key)
+			pruned = true
+		}
+	}
+	if pruned {
+		rl.saveLocked()
+	}
+}
+
+func (rl *ReminderLog) saveLocked() {
+	if err := rl.store.Save(remindersStoreName, rl.reminded); err != nil {
+		log.Printf("Failed to persist reminders: %v", err)
+	}
+}
+
+// StaleReport counts what a scan did.
+type StaleReport struct {
+	Scanned   int `json:"scanned"`
+	Reminders int `json:"reminders"`
+	Labelled  int `json:"labelled"`
+	Refreshed int `json:"refreshed"`
+	Closed    int `json:"closed"`
+}
+
+// scanStale runs the reminder and stale rules over every configured
+// repository as of now.
+func (rb *ReviewBot) scanStale(ctx context.Context, now time.Time) (StaleReport, error) {
+	ctx, span := tracer().Start(ctx, "scanStale")
+	defer span.End()
+
+	var report StaleReport
+	var failures []string
+	for _, repository := range rb.config.Settings.Stale.Repos {
+		owner, repo, _ := strings.Cut(repository, "/")
+		if err := rb.scanStaleRepo(ctx, owner, repo, now, &report); err != nil {
+			log.Printf("Stale scan of %s failed: %v", repository, err)
+			failures = append(failures, repository)
+		}
+	}
+	if len(failures) > 0 {
+		err := fmt.Errorf("stale scan failed for %s", strings.Join(failures, ", "))
+		recordSpanError(span, err)
+		return report, err
+	}
+	return report, nil
+}
+
+func (rb *ReviewBot) scanStaleRepo(ctx context.Context, owner, repo string, now time.Time, report *StaleReport) error {
+	repository := owner + "/" + repo
+
+	var prs []*github.PullRequest
+	opts := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := rb.client.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return err
+		}
+		prs = append(prs, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	open := make(map[int]bool)
+	for _, pr := range prs {
+		open[pr.GetNumber()] = true
+		report.Scanned++
+		if err := rb.applyStaleRules(ctx, owner, repo, pr, now, report); err != nil {
+			log.Printf("Stale rules failed on %s#%d: %v", repository, pr.GetNumber(), err)
+		}
+	}
+	rb.reminders.Prune(repository, open)
+	return nil
+}
+
+func (rb *ReviewBot) applyStaleRules(ctx context.Context, owner, repo string, pr *github.PullRequest, now time.Time, report *StaleReport) error {
+	settings := rb.config.Settings.Stale
+	label := settings.staleLabel()
+	labelled, exempt := false, false
+	for _, l := range pr.Labels {
+		if containsString(settings.ExemptLabels, l.GetName()) {
+			exempt = true
+		}
+		if l.GetName() == label {
+			labelled = true
+		}
+	}
+
+	// A reminder would count as activity on a stale PR and take its label
+	// off, so stale PRs aren't reminded about
+	remind := settings.ReminderHours > 0 && len(pr.RequestedReviewers) > 0 && !labelled
+	var events []*github.IssueEvent
+	if labelled || remind {
+		var err error
+		if events, err = rb.listIssueEvents(ctx, owner, repo, pr.GetNumber()); err != nil {
+			return err
+		}
+	}
+
+	if remind {
+		if err := rb.remindReviewers(ctx, owner, repo, pr, events, now, report); err != nil {
+			return err
+		}
+	}
+
+	if settings.StaleDays == 0 || exempt {
+		return nil
+	}
+	number := pr.GetNumber()
+	if labelled {
+		labelledAt := pr.GetCreatedAt().Time
+		for _, event := range events {
+			if event.GetEvent() == "labeled" && event.GetLabel().GetName() == label {
+				labelledAt = event.GetCreatedAt().Time
+			}
+		}
+		// The bot's own comment lands just after the label
+		if pr.GetUpdatedAt().Time.After(labelledAt.Add(time.Minute)) {
+			if _, err := rb.client.Issues.RemoveLabelForIssue(ctx, owner, repo, number, label); err != nil && !isNotFound(err) {
+				return err
+			}
+			report.Refreshed++
+			return nil
+		}
+		if settings.CloseDays > 0 && now.Sub(labelledAt) >= days(settings.CloseDays) {
+			body := fmt.Sprintf("Closing this pull request after %d more days without activity. Reopen it if it's still needed.", settings.CloseDays)
+			if _, _, err := rb.client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: github.String(body)}); err != nil {
+				return err
+			}
+			if _, _, err := rb.client.PullRequests.Edit(ctx, owner, repo, number, &github.PullRequest{State: github.String("closed")}); err != nil {
+				return err
+			}
+			report.Closed++
+		}
+		return nil
+	}
+
+	if now.Sub(pr.GetUpdatedAt().Time) < days(settings.StaleDays) {
+		return nil
+	}
+	if _, _, err := rb.client.Issues.AddLabelsToIssue(ctx, owner, repo, number, []string{label}); err != nil {
+		return err
+	}
+	body := fmt.Sprintf("This pull request has had no activity for %d days and is now labelled `%s`.", settings.StaleDays, label)
+	if settings.CloseDays > 0 {
+		body += fmt.Sprintf(" It will be closed in %d days unless it is updated.", settings.CloseDays)
+	}
+	if _, _, err := rb.client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: github.String(body)}); err != nil {
+		return err
+	}
+	report.Labelled++
+	return nil
+}
+
+// remindReviewers pings each requested reviewer whose request has waited
+// at least ReminderHours business hours.
+func (rb *ReviewBot) remindReviewers(ctx context.Context, owner, repo string, pr *github.PullRequest, events []*github.IssueEvent, now time.Time, report *StaleReport) error {
+	settings := rb.config.Settings.Stale
+	start, end := settings.workday()
+	loc := settings.location()
+	repository := owner + "/" + repo
+
+	requestedAt := make(map[string]time.Time)
+	for _, event := range events {
+		if event.GetEvent() == "review_requested" {
+			requestedAt[event.GetRequestedReviewer().GetLogin()] = event.GetCreatedAt().Time
+		}
+	}
+
+	var due []string
+	for _, user := range pr.RequestedReviewers {
+		login := user.GetLogin()
+		at, ok := requestedAt[login]
+		if !ok {
+			at = pr.GetCreatedAt().Time
+		}
+		if businessHours(at, now, loc, start, end) < time.Duration(settings.ReminderHours)*time.Hour {
+			continue
+		}
+		if !rb.reminders.Due(reminderKey(repository, pr.GetNumber(), login), at) {
+			continue
+		}
+		due = append(due, login)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	mentions := make([]string, len(due))
+	for i, login := range due {
+		mentions[i] = "@" + login
+	}
+	body := fmt.Sprintf("%s friendly reminder: your review was requested %d+ business hours ago.", strings.Join(mentions, " "), settings.ReminderHours)
+	if _, _, err := rb.client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), &github.IssueComment{Body: github.String(body)}); err != nil {
+		return err
+	}
+	// In shadow mode nobody was pinged; keep the reminders due
+	for _, login := range due {
+		at, ok := requestedAt[login]
+		if !ok {
+			at = pr.GetCreatedAt().Time
+		}
+		if !rb.shadowed(repository) {
+			rb.reminders.Reminded(reminderKey(repository, pr.GetNumber(), login), at)
+		}
+	}
+	report.Reminders += len(due)
+	return nil
+}
+
+func (rb *ReviewBot) listIssueEvents(ctx context.Context, owner, repo string, number int) ([]*github.IssueEvent, error) {
+	var all []*github.IssueEvent
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := rb.client.Issues.ListIssueEvents(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, events...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// handleStaleScan runs the stale scan immediately, outside its schedule.
+func (rb *ReviewBot) handleStaleScan(w http.ResponseWriter, r *http.Request) {
+	report, err := rb.scanStale(r.Context(), time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	status := http.StatusOK
+	response := map[string]interface{}{"report": report}
+	if err != nil {
+		status = http.StatusBadGateway
+		response["error"] = err.Error()
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestBusinessHours(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	// Friday 15:00 to Monday 11:00 Berlin time
+	from := time.Date(2024, 3, 1, 15, 0, 0, 0, berlin)
+	to := time.Date(2024, 3, 4, 11, 0, 0, 0, berlin)
+	if got := businessHours(from, to, berlin, 9, 17); got != 4*time.Hour {
+		t.Errorf("Expected 4h, got %v", got)
+	}
+	// Counted in UTC the same span starts at 14:00 Friday and ends 10:00 Monday
+	if got := businessHours(from, to, time.UTC, 9, 17); got != 4*time.Hour {
+		t.Errorf("Expected 4h in UTC, got %v", got)
+	}
+	if got := businessHours(to, from, berlin, 9, 17); got != 0 {
+		t.Errorf("Expected an empty span to count 0, got %v", got)
+	}
+
+	// Egypt moved its clocks forward at midnight on Friday 26 April 2024
+	cairo, err := time.LoadLocation("Africa/Cairo")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+	from = time.Date(2024, 4, 26, 9, 0, 0, 0, cairo)
+	to = time.Date(2024, 4, 26, 17, 0, 0, 0, cairo)
+	if got := businessHours(from, to, cairo, 9, 17); got != 8*time.Hour {
+		t.Errorf("Expected 8h on the day DST starts, got %v", got)
+	}
+}
+
+func TestScanStale(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC) // Tuesday
+	ts := func(t time.Time) *github.Timestamp { return &github.Timestamp{Time: t} }
+	label := func(names ...string) []*github.Label {
+		var labels []*github.Label
+		for _, name := range names {
+			labels = append(labels, &github.Label{Name: github.String(name)})
+		}
+		return labels
+	}
+	labelledAt := now.AddDate(0, 0, -8)
+
+	prs := []*github.PullRequest{
+		{Number: github.Int(1), CreatedAt: ts(now.AddDate(0, 0, -3)), UpdatedAt: ts(now.Add(-time.Hour)),
+			RequestedReviewers: []*github.User{{Login: github.String("rev")}, {Login: github.String("late")}}},
+		{Number: github.Int(2), CreatedAt: ts(now.AddDate(0, 0, -30)), UpdatedAt: ts(now.AddDate(0, 0, -20))},
+		{Number: github.Int(3), CreatedAt: ts(now.AddDate(0, 0, -30)), UpdatedAt: ts(labelledAt.Add(10 * time.Second)), Labels: label("stale"),
+			RequestedReviewers: []*github.User{{Login: github.String("rev")}}},
+		{Number: github.Int(4), CreatedAt: ts(now.AddDate(0, 0, -30)), UpdatedAt: ts(now.AddDate(0, 0, -1)), Labels: label("stale")},
+		{Number: github.Int(5), CreatedAt: ts(now.AddDate(0, 0, -90)), UpdatedAt: ts(now.AddDate(0, 0, -60)), Labels: label("pinned")},
+	}
+	events := map[string][]*github.IssueEvent{
+		"1": {
+			{Event: github.String("review_requested"), CreatedAt: ts(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)), RequestedReviewer: &github.User{Login: github.String("rev")}},
+			{Event: github.String("review_requested"), CreatedAt: ts(time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)), RequestedReviewer: &github.User{Login: github.String("late")}},
+		},
+		"3": {{Event: github.String("labeled"), CreatedAt: ts(labelledAt), Label: &github.Label{Name: github.String("stale")}}},
+		"4": {{Event: github.String("labeled"), CreatedAt: ts(labelledAt), Label: &github.Label{Name: github.String("stale")}}},
+	}
+
+	var mu sync.Mutex
+	var actions []string
+	record := func(action string) {
+		mu.Lock()
+		defer mu.Unlock()
+		actions = append(actions, action)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "open" {
+			t.Errorf("Expected only open PRs to be listed, got %q", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(prs)
+	})
+	mux.HandleFunc("/repos/o/r/issues/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/o/r/issues/"), "/")
+		switch {
+		case len(parts) == 2 && parts[1] == "events":
+			json.NewEncoder(w).Encode(events[parts[0]])
+		case len(parts) == 2 && parts[1] == "comments":
+			var comment github.IssueComment
+			json.NewDecoder(r.Body).Decode(&comment)
+			record("comment " + parts[0] + ": " + comment.GetBody())
+			json.NewEncoder(w).Encode(&comment)
+		case len(parts) == 2 && parts[1] == "labels":
+			var labels []string
+			json.NewDecoder(r.Body).Decode(&labels)
+			record("label " + parts[0] + ": " + strings.Join(labels, ","))
+			json.NewEncoder(w).Encode([]*github.Label{})
+		case len(parts) == 3 && parts[1] == "labels" && r.Method == http.MethodDelete:
+			record("unlabel " + parts[0] + ": " + parts[2])
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3", func(w http.ResponseWriter, r *http.Request) {
+		var pr github.PullRequest
+		json.NewDecoder(r.Body).Decode(&pr)
+		record("close 3: " + pr.GetState())
+		json.NewEncoder(w).Encode(&pr)
+	})
+
+	bot := newTestBot(t, mux)
+	bot.reminders = NewReminderLog(NewStore(t.TempDir()))
+	bot.config.Settings.Stale = StaleSettings{
+		Schedule:      "@hourly",
+		Repos:         []string{"o/r"},
+		ReminderHours: 8,
+		StaleDays:     14,
+		CloseDays:     7,
+		ExemptLabels:  []string{"pinned"},
+	}
+
+	report, err := bot.scanStale(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (StaleReport{Scanned: 5, Reminders: 1, Labelled: 1, Refreshed: 1, Closed: 1}); report != want {
+		t.Errorf("Expected report %+v, got %+v", want, report)
+	}
+	sort.Strings(actions)
+	want := []string{
+		"close 3: closed",
+		"comment 1: @rev friendly reminder: your review was requested 8+ business hours ago.",
+		"comment 2: This pull request has had no activity for 14 days and is now labelled `stale`. It will be closed in 7 days unless it is updated.",
+		"comment 3: Closing this pull request after 7 more days without activity. Reopen it if it's still needed.",
+		"label 2: stale",
+		"unlabel 4: stale",
+	}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("Expected actions\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(actions, "\n"))
+	}
+
+	// A reviewer is reminded once per request
+	actions = nil
+	prs = prs[:1]
+	if report, _ := bot.scanStale(context.Background(), now.Add(time.Hour)); report.Reminders != 0 || len(actions) != 0 {
+		t.Errorf("Expected no repeat reminders, got %+v %v", report, actions)
+	}
+
+	// Reminders only recorded in shadow mode stay due
+	bot.reminders = NewReminderLog(NewStore(t.TempDir()))
+	bot.shadow.store = NewStore(t.TempDir())
+	bot.config.Settings.Shadow = ShadowSettings{Repos: []string{"o/r"}}
+	for i := 0; i < 2; i++ {
+		if report, _ := bot.scanStale(context.Background(), now.Add(time.Hour)); report.Reminders != 1 {
+			t.Errorf("Expected the reminder to stay due in shadow mode, got %+v", report)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// summaryMarker identifies the bot's summary comment so every evaluation
+// edits it in place rather than adding another comment to the PR.
+const summaryMarker = "<!-- review-bot:summary -->"
+
+// summaryBody is the summary comment for a PR: the check results and merge
+// status, followed by its merge queue status if it has been queued.
+func (rb *ReviewBot) summaryBody(repository string, prNumber int, checks []CheckResult, verdict MergeVerdict) string {
+	body := strings.TrimSuffix(rb.generateCommentBody(checks, verdict), commentFooter)
+	return body + rb.queueSection(repository, prNumber) + commentFooter + "\n" + summaryMarker
+}
+
+// findSummaryComment returns the PR's summary comment, or nil if there is
+// none yet. Only the bot's own comments count: anyone can paste the marker.
+func (rb *ReviewBot) findSummaryComment(ctx context.Context, owner, repo string, prNumber int) (*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := rb.client.Issues.ListComments(ctx, owner, repo, prNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			if !strings.Contains(comment.GetBody(), summaryMarker) {
+				continue
+			}
+			login, err := rb.botLogin(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if strings.EqualFold(comment.GetUser().GetLogin(), login) {
+				return comment, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// upsertSummaryComment replaces the body of the PR's summary comment,
+// creating it on the first evaluation.
+func (rb *ReviewBot) upsertSummaryComment(ctx context.Context, owner, repo string, prNumber int, body string) error {
+	existing, err := rb.findSummaryComment(ctx, owner, repo, prNumber)
+	if err != nil {
+		return err
+	}
+	comment := &github.IssueComment{Body: github.String(body)}
+	if existing == nil {
+		_, _, err = rb.client.Issues.CreateComment(ctx, owner, repo, prNumber, comment)
+		return err
+	}
+	if existing.GetBody() == body {
+		return nil
+	}
+	_, _, err = rb.client.Issues.EditComment(ctx, owner, repo, existing.GetID(), comment)
+	return err
+}
+
+// refreshSummary re-renders the PR's summary comment from its last
+// evaluation, e.g. after its merge queue position changed.
+func (rb *ReviewBot) refreshSummary(ctx context.Context, owner, repo string, prNumber int) {
+	eval, ok := rb.evaluations.Get(owner+"/"+repo, prNumber)
+	if !ok {
+		return
+	}
+	body := rb.summaryBody(eval.Repository, prNumber, eval.Checks, eval.verdict())
+	if err := rb.upsertSummaryComment(ctx, owner, repo, prNumber, body); err != nil {
+		log.Printf("Failed to update summary comment on %s/%s#%d: %v", owner, repo, prNumber, err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestUpsertSummaryCommentIgnoresCopiedMarker(t *testing.T) {
+	var edited []int64
+	created := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.User{Login: github.String("review-bot[bot]")})
+	})
+	mux.HandleFunc("/repos/o/r/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode([]*github.IssueComment{
+				{ID: github.Int64(7), User: &github.User{Login: github.String("mallory")}, Body: github.String("quoting " + summaryMarker)},
+			})
+			return
+		}
+		created++
+		json.NewEncoder(w).Encode(&github.IssueComment{})
+	})
+	mux.HandleFunc("/repos/o/r/issues/2/comments", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.IssueComment{
+			{ID: github.Int64(8), User: &github.User{Login: github.String("mallory")}, Body: github.String(summaryMarker)},
+			{ID: github.Int64(9), User: &github.User{Login: github.String("review-bot[bot]")}, Body: github.String("old\n" + summaryMarker)},
+		})
+	})
+	mux.HandleFunc("/repos/o/r/issues/comments/", func(w http.ResponseWriter, r *http.Request) {
+		var id int64
+		json.Unmarshal([]byte(r.URL.Path[len("/repos/o/r/issues/comments/"):]), &id)
+		edited = append(edited, id)
+		json.NewEncoder(w).Encode(&github.IssueComment{})
+	})
+	bot := newTestBot(t, mux)
+	bot.config.BotLogin = ""
+
+	if err := bot.upsertSummaryComment(context.Background(), "o", "r", 1, "new\n"+summaryMarker); err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || len(edited) != 0 {
+		t.Errorf("Expected a new summary comment rather than editing someone else's, got %d created, edited %v", created, edited)
+	}
+
+	if err := bot.upsertSummaryComment(context.Background(), "o", "r", 2, "new\n"+summaryMarker); err != nil {
+		t.Fatal(err)
+	}
+	if len(edited) != 1 || edited[0] != 9 {
+		t.Errorf("Expected the bot's own comment to be edited, got %v", edited)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import "fmt"
+
+// Microsoft Teams incoming webhooks (and Workflows webhooks) accept a message
+// wrapping one or more Adaptive Card attachments.
+
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+type TeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	ContentURL  *string      `json:"contentUrl"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+type AdaptiveCard struct {
+	Schema  string                   `json:"$schema"`
+	Type    string                   `json:"type"`
+	Version string                   `json:"version"`
+	Body    []map[string]interface{} `json:"body"`
+	Actions []map[string]interface{} `json:"actions,omitempty"`
+	MSTeams map[string]string        `json:"msteams,omitempty"`
+}
+
+// teamsMessage renders eval as an Adaptive Card.
+func teamsMessage(eval Evaluation) TeamsMessage {
+	verdict, color := "✅ Ready to merge", "Good"
+	if !eval.CanMerge {
+		verdict, color = "⏳ Not ready to merge", "Warning"
+	}
+	if !eval.mergeReady() && eval.CanMerge {
+		color = "Attention"
+	}
+
+	body := []map[string]interface{}{
+		{"type": "TextBlock", "text": summaryTitle(eval), "weight": "Bolder", "size": "Medium", "wrap": true},
+		{"type": "TextBlock", "text": fmt.Sprintf("%s — %s", verdict, eval.Reason), "color": color, "wrap": true},
+	}
+	if eval.Author != "" {
+		body = append(body, map[string]interface{}{
+			"type": "TextBlock", "text": "Opened by " + eval.Author, "isSubtle": true, "spacing": "None", "wrap": true,
+		})
+	}
+
+	if len(eval.Checks) > 0 {
+		var facts []map[string]string
+		for _, check := range eval.Checks {
+			facts = append(facts, map[string]string{
+				"title": check.Name,
+				"value": checkEmoji(check.Status) + " " + check.Message,
+			})
+		}
+		body = append(body, map[string]interface{}{"type": "FactSet", "facts": facts})
+	}
+
+	card := AdaptiveCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body:    body,
+		MSTeams: map[string]string{"width": "Full"},
+	}
+	if eval.URL != "" {
+		card.Actions = []map[string]interface{}{
+			{"type": "Action.OpenUrl", "title": "View pull request", "url": eval.URL},
+		}
+	}
+
+	return TeamsMessage{
+		Type: "message",
+		Attachments: []TeamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content:     card,
+		}},
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWebhookSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/pulls/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"state":"APPROVED"},{"state":"APPROVED"}]`))
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number":1,"head":{"sha":"abc123"}}`))
+	})
+	mux.HandleFunc("/repos/owner/repo/statuses/abc123", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+
+	bot := newTestBot(t, mux)
+	bot.config.RequiredChecks = []string{"unknown"}
+
+	payload := `{"action":"opened","number":1,"pull_request":{"number":1,"head":{"sha":"abc123"}},"repository":{"name":"repo","owner":{"login":"owner"}}}`
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "pull_request")
+	req.Header.Set("X-GitHub-Delivery", "delivery-42")
+
+	rr := httptest.NewRecorder()
+	bot.handleWebhook(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	bot.inFlight.Wait()
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]int{}
+	var root sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		names[span.Name()]++
+		if span.Name() == "handleWebhook" {
+			root = span
+		}
+	}
+
+	for _, name := range []string{"handleWebhook", "check unknown", "checkMergePolicy", "updatePRStatus"} {
+		if names[name] != 1 {
+			t.Errorf("Expected one %q span, got %d", name, names[name])
+		}
+	}
+	if names["GitHub GET /repos/owner/repo/pulls/1/reviews"] != 1 {
+		t.Errorf("Expected a client span for ListReviews, got %v", names)
+	}
+
+	if root == nil {
+		t.Fatal("Expected a handleWebhook span")
+	}
+	found := false
+	for _, attr := range root.Attributes() {
+		if attr.Key == "github.delivery_id" && attr.Value.AsString() == "delivery-42" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected delivery ID attribute on handleWebhook span, got %v", root.Attributes())
+	}
+}
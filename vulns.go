@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/mod/semver"
+)
+
+// VulnSettings points the vulns check at a local OSV database snapshot, a
+// directory tree of OSV JSON entries such as an extracted
+// https://osv-vulnerabilities.storage.googleapis.com/Go/all.zip. Advisories
+// at or above FailOn (LOW, MEDIUM, HIGH or CRITICAL; HIGH by default) fail
+// the check; lower ones only warn. The Go vulnerability database does not
+// rate its GO-* advisories, so those without a severity of their own are
+// treated as DefaultSeverity (HIGH by default). Ignore lists advisory IDs or
+// aliases that have been triaged.
+type VulnSettings struct {
+	DBDir           string   `json:"db_dir"`
+	FailOn          string   `json:"fail_on"`
+	DefaultSeverity string   `json:"default_severity"`
+	Ignore          []string `json:"ignore"`
+}
+
+// Severities in increasing order.
+var severityRank = map[string]int{"UNKNOWN": 0, "LOW": 1, "MEDIUM": 2, "HIGH": 3, "CRITICAL": 4}
+
+func (s VulnSettings) validate() error {
+	for _, severity := range []string{s.FailOn, s.DefaultSeverity} {
+		if severity == "" {
+			continue
+		}
+		if _, ok := severityRank[strings.ToUpper(severity)]; !ok || strings.EqualFold(severity, "UNKNOWN") {
+			return fmt.Errorf("unknown severity %q", severity)
+		}
+	}
+	return nil
+}
+
+func (s VulnSettings) failOn() string {
+	if s.FailOn == "" {
+		return "HIGH"
+	}
+	return strings.ToUpper(s.FailOn)
+}
+
+func (s VulnSettings) defaultSeverity() string {
+	if s.DefaultSeverity == "" {
+		return "HIGH"
+	}
+	return strings.ToUpper(s.DefaultSeverity)
+}
+
+// OSVEntry is the part of the OSV schema (https://ossf.github.io/osv-schema/)
+// the check uses.
+type OSVEntry struct {
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases"`
+	Summary   string   `json:"summary"`
+	Details   string   `json:"details"`
+	Withdrawn string   `json:"withdrawn"`
+	Severity  []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced   string `json:"introduced"`
+				Fixed        string `json:"fixed"`
+				LastAffected string `json:"last_affected"`
+			} `json:"events"`
+		} `json:"ranges"`
+		Versions []string `json:"versions"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// severity returns the entry's severity bucket, preferring the database's
+// own rating (GitHub advisories) over a CVSS v3 vector.
+func (e *OSVEntry) severity() string {
+	switch s := strings.ToUpper(e.DatabaseSpecific.Severity); s {
+	case "MODERATE":
+		return "MEDIUM"
+	case "LOW", "MEDIUM", "HIGH", "CRITICAL":
+		return s
+	}
+	for _, sev := range e.Severity {
+		if strings.HasPrefix(sev.Type, "CVSS_V3") {
+			if score, ok := cvss3BaseScore(sev.Score); ok {
+				return cvssSeverity(score)
+			}
+		}
+	}
+	return "UNKNOWN"
+}
+
+func (e *OSVEntry) summary() string {
+	if e.Summary != "" {
+		return e.Summary
+	}
+	first, _, _ := strings.Cut(strings.TrimSpace(e.Details), "\n")
+	return truncate(first, 120)
+}
+
+// affects reports whether version of module is affected, and the version
+// that fixes it if known.
+func (e *OSVEntry) affects(module, version string) (bool, string) {
+	for _, affected := range e.Affected {
+		if affected.Package.Ecosystem != "Go" || affected.Package.Name != module {
+			continue
+		}
+		for _, v := range affected.Versions {
+			if "v"+strings.TrimPrefix(v, "v") == version {
+				return true, ""
+			}
+		}
+		for _, r := range affected.Ranges {
+			if r.Type != "SEMVER" {
+				continue
+			}
+			// Events are ordered; each introduced opens a range that the
+			// next fixed or last_affected closes.
+			inRange := false
+			for _, event := range r.Events {
+				switch {
+				case event.Introduced != "":
+					inRange = event.Introduced == "0" || semver.Compare(version, "v"+event.Introduced) >= 0
+				case event.Fixed != "":
+					if inRange && semver.Compare(version, "v"+event.Fixed) < 0 {
+						return true, "v" + event.Fixed
+					}
+					inRange = false
+				case event.LastAffected != "":
+					if inRange && semver.Compare(version, "v"+event.LastAffected) <= 0 {
+						return true, ""
+					}
+					inRange = false
+				}
+			}
+			if inRange {
+				return true, ""
+			}
+		}
+	}
+	return false, ""
+}
+
+// OSVDatabase indexes an OSV snapshot by Go module. It is loaded lazily and
+// reloaded when any entry in the snapshot changes.
+type OSVDatabase struct {
+	mu       sync.Mutex
+	dir      string
+	stamp    osvStamp
+	byModule map[string][]*OSVEntry
+}
+
+// osvStamp summarises the entries of a snapshot: entries updated in place
+// move the newest modification time, removed ones change the count.
+type osvStamp struct {
+	files  int
+	newest time.Time
+}
+
+func snapshotStamp(dir string) (osvStamp, error) {
+	var stamp osvStamp
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stamp.files++
+		if info.ModTime().After(stamp.newest) {
+			stamp.newest = info.ModTime()
+		}
+		return nil
+	})
+	return stamp, err
+}
+
+func (db *OSVDatabase) load(dir string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stamp, err := snapshotStamp(dir)
+	if err != nil {
+		return err
+	}
+	if db.byModule != nil && db.dir == dir && stamp.files == db.stamp.files && stamp.newest.Equal(db.stamp.newest) {
+		return nil
+	}
+
+	byModule := make(map[string][]*OSVEntry)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		entry := &OSVEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return nil // index files and the like
+		}
+		if entry.ID == "" || entry.Withdrawn != "" {
+			return nil
+		}
+		seen := make(map[string]bool)
+		for _, affected := range entry.Affected {
+			name := affected.Package.Name
+			if affected.Package.Ecosystem == "Go" && !seen[name] {
+				seen[name] = true
+				byModule[name] = append(byModule[name], entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.dir, db.stamp, db.byModule = dir, stamp, byModule
+	return nil
+}
+
+// Vulnerability is an advisory that affects a required module version.
+type Vulnerability struct {
+	Module   string
+	Version  string
+	ID       string
+	Aliases  []string
+	Severity string
+	Fixed    string
+	Summary  string
+}
+
+func (db *OSVDatabase) Lookup(module, version string) []Vulnerability {
+	db.mu.Lock()
+	entries := db.byModule[module]
+	db.mu.Unlock()
+
+	var vulns []Vulnerability
+	for _, entry := range entries {
+		if affected, fixed := entry.affects(module, version); affected {
+			vulns = append(vulns, Vulnerability{
+				Module:   module,
+				Version:  version,
+				ID:       entry.ID,
+				Aliases:  entry.Aliases,
+				Severity: entry.severity(),
+				Fixed:    fixed,
+				Summary:  entry.summary(),
+			})
+		}
+	}
+	return vulns
+}
+
+// buildList returns the module versions a go.mod selects. Since Go 1.17
+// go.mod lists every module needed to build; older files only list direct
+// dependencies, so go.sum fills in the rest (taking the highest version of
+// each, as minimal version selection would).
+func buildList(mod *GoMod, goSum []byte) map[string]string {
+	versions := make(map[string]string)
+	for _, r := range mod.Requires {
+		versions[r.Path] = r.Version
+	}
+	for _, r := range mod.Replaces {
+		if r.isLocal() {
+			delete(versions, r.Old)
+		} else if _, ok := versions[r.Old]; ok && (r.OldVersion == "" || r.OldVersion == versions[r.Old]) {
+			delete(versions, r.Old)
+			versions[r.New] = r.NewVersion
+		}
+	}
+
+	if semver.Compare("v"+mod.Go, "v1.17") >= 0 {
+		return versions
+	}
+	for _, line := range strings.Split(string(goSum), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		if current, ok := versions[fields[0]]; !ok || semver.Compare(fields[1], current) > 0 {
+			versions[fields[0]] = fields[1]
+		}
+	}
+	return versions
+}
+
+// toolchainVersion returns the Go release named by a go.mod's toolchain
+// line as a semantic version in the form the Go vulnerability database uses
+// for the "stdlib" and "toolchain" packages (go1.21rc2 becomes v1.21.0-rc2).
+// The go line only sets a minimum language version, not the release that
+// builds the module, so without a toolchain line it returns "".
+func toolchainVersion(mod *GoMod) string {
+	v := strings.TrimPrefix(mod.Toolchain, "go")
+	if v == "" {
+		return ""
+	}
+	if i := strings.IndexAny(v, "abcdefghijklmnopqrstuvwxyz"); i > 0 {
+		core, pre := v[:i], v[i:]
+		if strings.Count(core, ".") == 1 {
+			core += ".0"
+		}
+		v = core + "-" + pre
+	}
+	return "v" + v
+}
+
+// runVulnsCheck matches the module versions required at head, and the Go
+// release named by its toolchain line, against the local OSV snapshot.
+func (rb *ReviewBot) runVulnsCheck(ctx context.Context, owner, repo string, pr *github.PullRequest) CheckResult {
+	settings := rb.config.Settings.Vulns
+	if settings.DBDir == "" {
+		return CheckResult{
+			Name:    "vulns",
+			Status:  "skipped",
+			Message: "No OSV database configured",
+		}
+	}
+	if err := rb.osv.load(settings.DBDir); err != nil {
+		return CheckResult{
+			Name:    "vulns",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to load OSV database: %v", err),
+		}
+	}
+
+	files, err := rb.listPRFiles(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return CheckResult{
+			Name:    "vulns",
+			Status:  "error",
+			Message: fmt.Sprintf("Failed to get PR files: %v", err),
+		}
+	}
+	goMods := []string{"go.mod"}
+	for _, file := range files {
+		name := file.GetFilename()
+		if path.Base(name) == "go.mod" && name != "go.mod" && file.GetStatus() != "removed" && !isVendored(name) {
+			goMods = append(goMods, name)
+		}
+	}
+
+	sha := pr.GetHead().GetSHA()
+	var vulns []Vulnerability
+	parsed, checked := 0, 0
+	for _, goMod := range goMods {
+		src, err := rb.fileContentAt(ctx, owner, repo, goMod, sha)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return CheckResult{
+				Name:    "vulns",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to get %s: %v", goMod, err),
+			}
+		}
+		mod, err := parseGoMod(src)
+		if err != nil {
+			return CheckResult{
+				Name:    "vulns",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to parse %s: %v", goMod, err),
+			}
+		}
+		goSum, err := rb.fileContentAt(ctx, owner, repo, path.Join(path.Dir(goMod), "go.sum"), sha)
+		if err != nil && !isNotFound(err) {
+			return CheckResult{
+				Name:    "vulns",
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to get go.sum: %v", err),
+			}
+		}
+
+		parsed++
+
+		versions := buildList(mod, goSum)
+		if v := toolchainVersion(mod); v != "" {
+			versions["stdlib"], versions["toolchain"] = v, v
+		}
+		for module, version := range versions {
+			if module != "stdlib" && module != "toolchain" {
+				checked++
+			}
+			for _, v := range rb.osv.Lookup(module, version) {
+				if containsString(settings.Ignore, v.ID) || containsAny(settings.Ignore, v.Aliases) {
+					continue
+				}
+				if v.Severity == "UNKNOWN" && strings.HasPrefix(v.ID, "GO-") {
+					v.Severity = settings.defaultSeverity()
+				}
+				vulns = append(vulns, v)
+			}
+		}
+	}
+
+	if parsed == 0 {
+		return CheckResult{
+			Name:    "vulns",
+			Status:  "skipped",
+			Message: "No go.mod found",
+		}
+	}
+	if len(vulns) == 0 {
+		return CheckResult{
+			Name:    "vulns",
+			Status:  "success",
+			Message: fmt.Sprintf("No known vulnerabilities in %d modules", checked),
+		}
+	}
+
+	sort.Slice(vulns, func(i, j int) bool {
+		if severityRank[vulns[i].Severity] != severityRank[vulns[j].Severity] {
+			return severityRank[vulns[i].Severity] > severityRank[vulns[j].Severity]
+		}
+		if vulns[i].Module != vulns[j].Module {
+			return vulns[i].Module < vulns[j].Module
+		}
+		return vulns[i].ID < vulns[j].ID
+	})
+
+	blocking := 0
+	table := &CheckTable{Header: []string{"Module", "Version", "Advisory", "Severity", "Fixed in", "Summary"}}
+	for _, v := range vulns {
+		if severityRank[v.Severity] >= severityRank[settings.failOn()] {
+			blocking++
+		}
+		fixed := v.Fixed
+		if fixed == "" {
+			fixed = "no fix"
+		}
+		table.Rows = append(table.Rows, []string{"`" + v.Module + "`", v.Version, v.ID, v.Severity, fixed, strings.ReplaceAll(v.Summary, "|", `\|`)})
+	}
+
+	status := "warning"
+	message := fmt.Sprintf("Found %d known vulnerabilities", len(vulns))
+	if blocking > 0 {
+		status = "failure"
+		message += fmt.Sprintf(", %d rated %s or higher", blocking, settings.failOn())
+	}
+	return CheckResult{
+		Name:    "vulns",
+		Status:  status,
+		Message: message,
+		Table:   table,
+	}
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, c := range candidates {
+		if containsString(values, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// cvss3BaseScore computes the base score of a CVSS v3.x vector such as
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H".
+func cvss3BaseScore(vector string) (float64, bool) {
+	metrics := make(map[string]string)
+	for _, part := range strings.Split(vector, "/") {
+		if key, value, ok := strings.Cut(part, ":"); ok {
+			metrics[key] = value
+		}
+	}
+
+	weights := map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"UI": {"N": 0.85, "R": 0.62},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+	values := make(map[string]float64)
+	for metric, table := range weights {
+		w, ok := table[metrics[metric]]
+		if !ok {
+			return 0, false
+		}
+		values[metric] = w
+	}
+	changed := metrics["S"] == "C"
+	if !changed && metrics["S"] != "U" {
+		return 0, false
+	}
+	pr := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	if changed {
+		pr = map[string]float64{"N": 0.85, "L": 0.68, "H": 0.5}
+	}
+	privileges, ok := pr[metrics["PR"]]
+	if !ok {
+		return 0, false
+	}
+
+	iss := 1 - (1-values["C"])*(1-values["I"])*(1-values["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+	exploitability := 8.22 * values["AV"] * values["AC"] * privileges * values["UI"]
+	if changed {
+		return cvssRoundUp(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return cvssRoundUp(math.Min(impact+exploitability, 10)), true
+}
+
+// cvssRoundUp is the Roundup function from the CVSS v3.1 specification.
+func cvssRoundUp(x float64) float64 {
+	i := int(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+func cvssSeverity(score float64) string {
+	switch {
+	case score >= 9:
+		return "CRITICAL"
+	case score >= 7:
+		return "HIGH"
+	case score >= 4:
+		return "MEDIUM"
+	case score > 0:
+		return "LOW"
+	}
+	return "UNKNOWN"
+}
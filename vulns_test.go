@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestCVSS3BaseScore(t *testing.T) {
+	tests := map[string]float64{
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H": 9.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H": 10.0,
+		"CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:U/C:L/I:N/A:N": 4.3,
+		"CVSS:3.0/AV:L/AC:H/PR:H/UI:R/S:U/C:N/I:N/A:N": 0,
+	}
+	for vector, want := range tests {
+		if got, ok := cvss3BaseScore(vector); !ok || got != want {
+			t.Errorf("%s: expected %.1f, got %.1f (%v)", vector, want, got, ok)
+		}
+	}
+	if _, ok := cvss3BaseScore("CVSS:3.1/AV:X"); ok {
+		t.Error("Expected an incomplete vector to be rejected")
+	}
+}
+
+const osvEntry = `{
+  "id": "GO-2024-0001",
+  "aliases": ["CVE-2024-0001", "GHSA-aaaa-bbbb-cccc"],
+  "summary": "Request smuggling in example.com/web",
+  "affected": [{
+    "package": {"ecosystem": "Go", "name": "example.com/web"},
+    "ranges": [{"type": "SEMVER", "events": [
+      {"introduced": "0"}, {"fixed": "1.2.0"},
+      {"introduced": "1.4.0"}, {"fixed": "1.4.3"}
+    ]}]
+  }],
+  "database_specific": {"severity": "HIGH"}
+}`
+
+func TestOSVEntryAffects(t *testing.T) {
+	var entry OSVEntry
+	if err := json.Unmarshal([]byte(osvEntry), &entry); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		version  string
+		affected bool
+		fixed    string
+	}{
+		{"v1.1.9", true, "v1.2.0"},
+		{"v1.2.0", false, ""},
+		{"v1.3.5", false, ""},
+		{"v1.4.2", true, "v1.4.3"},
+		{"v1.4.3", false, ""},
+	}
+	for _, tt := range tests {
+		affected, fixed := entry.affects("example.com/web", tt.version)
+		if affected != tt.affected || fixed != tt.fixed {
+			t.Errorf("%s: expected %v %q, got %v %q", tt.version, tt.affected, tt.fixed, affected, fixed)
+		}
+	}
+	if affected, _ := entry.affects("example.com/other", "v1.0.0"); affected {
+		t.Error("Expected other modules to be unaffected")
+	}
+}
+
+func TestBuildList(t *testing.T) {
+	mod, _ := parseGoMod([]byte("module m\n\ngo 1.16\n\nrequire example.com/a v1.0.0\n\nreplace example.com/a => example.com/fork v1.0.1\n"))
+	goSum := "example.com/b v1.1.0 h1:x=\nexample.com/b v1.1.0/go.mod h1:y=\nexample.com/b v1.0.0 h1:z=\nexample.com/c v0.2.0/go.mod h1:w=\n"
+	want := map[string]string{"example.com/fork": "v1.0.1", "example.com/b": "v1.1.0"}
+	if got := buildList(mod, []byte(goSum)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	mod.Go = "1.21"
+	if got := buildList(mod, []byte(goSum)); len(got) != 1 {
+		t.Errorf("Expected go.sum to be ignored for Go 1.17+, got %v", got)
+	}
+}
+
+func TestOSVDatabaseReload(t *testing.T) {
+	dbDir := t.TempDir()
+	entry := filepath.Join(dbDir, "ID", "GO-2024-0001.json")
+	os.MkdirAll(filepath.Dir(entry), 0o755)
+	os.WriteFile(entry, []byte(osvEntry), 0o644)
+
+	var db OSVDatabase
+	if err := db.load(dbDir); err != nil {
+		t.Fatal(err)
+	}
+	if vulns := db.Lookup("example.com/web", "v1.4.2"); len(vulns) != 1 {
+		t.Fatalf("Expected v1.4.2 to be affected, got %v", vulns)
+	}
+
+	// Snapshots are updated in place; the directories' own times don't
+	// change.
+	os.WriteFile(entry, []byte(strings.Replace(osvEntry, `"fixed": "1.4.3"`, `"fixed": "1.4.2"`, 1)), 0o644)
+	os.Chtimes(entry, time.Now(), time.Now().Add(time.Minute))
+	if err := db.load(dbDir); err != nil {
+		t.Fatal(err)
+	}
+	if vulns := db.Lookup("example.com/web", "v1.4.2"); len(vulns) != 0 {
+		t.Errorf("Expected the updated advisory to be reloaded, got %v", vulns)
+	}
+}
+
+func TestRunVulnsCheck(t *testing.T) {
+	dbDir := t.TempDir()
+	os.WriteFile(filepath.Join(dbDir, "GO-2024-0001.json"), []byte(osvEntry), 0o644)
+	os.WriteFile(filepath.Join(dbDir, "GO-2024-0002.json"), []byte(`{
+  "id": "GO-2024-0002",
+  "details": "Excessive memory use when parsing headers.\nMore text.",
+  "severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:U/C:L/I:N/A:N"}],
+  "affected": [{"package": {"ecosystem": "Go", "name": "example.com/web"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "1.0.0"}]}]}]
+}`), 0o644)
+	os.WriteFile(filepath.Join(dbDir, "index.json"), []byte(`[]`), 0o644)
+
+	goMod := "module m\n\ngo 1.21\n\nrequire (\n\texample.com/web v1.4.1\n\texample.com/safe v1.0.0\n)\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*github.CommitFile{{Filename: github.String("main.go")}})
+	})
+	mux.HandleFunc("/repos/o/r/contents/go.mod", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(goMod))),
+		})
+	})
+	mux.HandleFunc("/repos/o/r/contents/go.sum", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Not Found"})
+	})
+
+	bot := newTestBot(t, mux)
+	bot.config.Settings.Vulns = VulnSettings{DBDir: dbDir}
+	pr := &github.PullRequest{Number: github.Int(1), Head: &github.PullRequestBranch{SHA: github.String("abc123")}}
+
+	result := bot.runSpecificCheck(context.Background(), "o", "r", pr, "vulns")
+	if result.Status != "failure" || result.Message != "Found 2 known vulnerabilities, 1 rated HIGH or higher" {
+		t.Fatalf("Unexpected result %s: %s", result.Status, result.Message)
+	}
+	want := [][]string{
+		{"`example.com/web`", "v1.4.1", "GO-2024-0001", "HIGH", "v1.4.3", "Request smuggling in example.com/web"},
+		{"`example.com/web`", "v1.4.1", "GO-2024-0002", "MEDIUM", "no fix", "Excessive memory use when parsing headers."},
+	}
+	if !reflect.DeepEqual(result.Table.Rows, want) {
+		t.Errorf("Expected rows %v, got %v", want, result.Table.Rows)
+	}
+
+	bot.config.Settings.Vulns.Ignore = []string{"CVE-2024-0001"}
+	result = bot.runSpecificCheck(context.Background(), "o", "r", pr, "vulns")
+	if result.Status != "warning" || !strings.HasPrefix(result.Message, "Found 1 known vulnerabilities") {
+		t.Errorf("Expected the ignored advisory to be dropped, got %s: %s", result.Status, result.Message)
+	}
+
+	// The Go database leaves its advisories unrated, including those for
+	// the standard library.
+	os.WriteFile(filepath.Join(dbDir, "GO-2024-0003.json"), []byte(`{
+  "id": "GO-2024-0003",
+  "summary": "Infinite loop in net/http",
+  "affected": [{"package": {"ecosystem": "Go", "name": "stdlib"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.21.5"}]}]}]
+}`), 0o644)
+	goMod = "module m\n\ngo 1.21\n"
+	result = bot.runSpecificCheck(context.Background(), "o", "r", pr, "vulns")
+	if result.Status != "success" {
+		t.Errorf("Expected the go line alone not to select a standard library, got %s: %s %v", result.Status, result.Message, result.Table)
+	}
+
+	goMod = "module m\n\ngo 1.21\n\ntoolchain go1.21.4\n"
+	result = bot.runSpecificCheck(context.Background(), "o", "r", pr, "vulns")
+	if result.Status != "failure" || len(result.Table.Rows) != 1 || !reflect.DeepEqual(result.Table.Rows[0][:5], []string{"`stdlib`", "v1.21.4", "GO-2024-0003", "HIGH", "v1.21.5"}) {
+		t.Errorf("Expected the stdlib advisory to block as HIGH, got %s: %s %v", result.Status, result.Message, result.Table)
+	}
+
+	bot.config.Settings.Vulns.DefaultSeverity = "medium"
+	result = bot.runSpecificCheck(context.Background(), "o", "r", pr, "vulns")
+	if result.Status != "warning" {
+		t.Errorf("Expected the default severity to apply, got %s: %s", result.Status, result.Message)
+	}
+}
+
+func TestToolchainVersion(t *testing.T) {
+	for _, tt := range []struct{ goLine, toolchain, want string }{
+		{"1.21", "", ""},
+		{"1.21.3", "go1.22.1", "v1.22.1"},
+		{"1.21", "go1.21rc2", "v1.21.0-rc2"},
+		{"", "", ""},
+	} {
+		if got := toolchainVersion(&GoMod{Go: tt.goLine, Toolchain: tt.toolchain}); got != tt.want {
+			t.Errorf("go %q toolchain %q: expected %q, got %q", tt.goLine, tt.toolchain, tt.want, got)
+		}
+	}
+}
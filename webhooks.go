@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outbound webhook event types.
+const (
+	EventPRProcessed   = "pr_processed"
+	EventPolicyChanged = "policy_changed"
+	EventCheckFailed   = "check_failed"
+)
+
+var knownWebhookEvents = map[string]bool{
+	EventPRProcessed:   true,
+	EventPolicyChanged: true,
+	EventCheckFailed:   true,
+}
+
+const (
+	signatureHeader = "X-ReviewBot-Signature"
+	// legacySubscriber is the implicit, unsigned receiver configured through
+	// THIRD_PARTY_WEBHOOK_URL.
+	legacySubscriber = "default"
+)
+
+type PolicyChange struct {
+	Repository       string `json:"repository"`
+	PRNumber         int    `json:"pr_number"`
+	URL              string `json:"url"`
+	CanMerge         bool   `json:"can_merge"`
+	Reason           string `json:"reason"`
+	PreviousCanMerge bool   `json:"previous_can_merge"`
+	PreviousReason   string `json:"previous_reason"`
+}
+
+type CheckFailure struct {
+	Repository   string        `json:"repository"`
+	PRNumber     int           `json:"pr_number"`
+	URL          string        `json:"url"`
+	HeadSHA      string        `json:"head_sha"`
+	FailedChecks []CheckResult `json:"failed_checks"`
+}
+
+// subscribers returns every configured receiver, including the legacy
+// THIRD_PARTY_WEBHOOK_URL one, which only ever received pr_processed.
+func (rb *ReviewBot) subscribers() []Subscriber {
+	subs := rb.config.Settings.Subscribers
+	if rb.config.WebhookURL != "" {
+		legacy := Subscriber{Name: legacySubscriber, URL: rb.config.WebhookURL, Events: []string{EventPRProcessed}}
+		subs = append([]Subscriber{legacy}, subs...)
+	}
+	return subs
+}
+
+func (rb *ReviewBot) subscriberSecret(name string) string {
+	for _, sub := range rb.config.Settings.Subscribers {
+		if sub.Name == name {
+			return sub.Secret
+		}
+	}
+	return ""
+}
+
+// publish queues payload for every subscriber interested in event on
+// owner/repo.
+func (rb *ReviewBot) publish(event, owner, repo string, payload interface{}) {
+	repository := owner + "/" + repo
+
+	var body []byte
+	for _, sub := range rb.subscribers() {
+		if !sub.Wants(event, repository) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(payload); err != nil {
+				log.Printf("Failed to marshal %s payload: %v", event, err)
+				return
+			}
+		}
+		if _, err := rb.outbox.Enqueue(sub.Name, event, sub.URL, body); err != nil {
+			log.Printf("Failed to queue %s for subscriber %s: %v", event, sub.Name, err)
+		}
+	}
+}
+
+// publishEvaluation emits the events implied by change.
+func (rb *ReviewBot) publishEvaluation(owner, repo string, change EvaluationChange) {
+	current, previous, hadPrevious := change.Current, change.Previous, change.HadPrevious
+
+	failed := current.failingChecks()
+	if len(failed) > 0 && (!hadPrevious || previous.HeadSHA != current.HeadSHA || !sameCheckStatuses(previous.Checks, current.Checks)) {
+		rb.publish(EventCheckFailed, owner, repo, CheckFailure{
+			Repository:   current.Repository,
+			PRNumber:     current.PRNumber,
+			URL:          current.URL,
+			HeadSHA:      current.HeadSHA,
+			FailedChecks: failed,
+		})
+	}
+
+	if hadPrevious && (previous.CanMerge != current.CanMerge || previous.Reason != current.Reason) {
+		rb.publish(EventPolicyChanged, owner, repo, PolicyChange{
+			Repository:       current.Repository,
+			PRNumber:         current.PRNumber,
+			URL:              current.URL,
+			CanMerge:         current.CanMerge,
+			Reason:           current.Reason,
+			PreviousCanMerge: previous.CanMerge,
+			PreviousReason:   previous.Reason,
+		})
+	}
+}
+
+func sameCheckStatuses(a, b []CheckResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Status != b[i].Status {
+			return false
+		}
+	}
+	return true
+}
+
+// signPayload returns the X-ReviewBot-Signature value for body sent at ts.
+// The signed message is "<unix timestamp>.<body>" so a captured request
+// cannot be replayed later with a new timestamp.
+func signPayload(secret string, ts time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + timestamp + ",sha256=" + hex.EncodeToString(computeSignature(secret, timestamp, body))
+}
+
+func computeSignature(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// VerifySignature checks an X-ReviewBot-Signature header against body and
+// rejects signatures older than tolerance. Receivers written in Go can use it
+// directly; the scheme is simple enough to port elsewhere.
+func VerifySignature(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "sha256":
+			signature = value
+		}
+	}
+	if timestamp == "" || signature == "" {
+		return errors.New("malformed signature header")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad signature timestamp: %w", err)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature timestamp outside tolerance (%v)", age)
+	}
+
+	expected := computeSignature(secret, timestamp, body)
+	given, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, given) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignatureRoundTrip(t *testing.T) {
+	body := []byte(`{"pr_number":7}`)
+	sentAt := time.Unix(1700000000, 0)
+	header := signPayload("s3cret", sentAt, body)
+
+	if err := VerifySignature("s3cret", header, body, 5*time.Minute, sentAt.Add(time.Minute)); err != nil {
+		t.Errorf("Expected valid signature, got %v", err)
+	}
+	if err := VerifySignature("wrong", header, body, 5*time.Minute, sentAt); err == nil {
+		t.Error("Expected mismatch with the wrong secret")
+	}
+	if err := VerifySignature("s3cret", header, []byte(`{"pr_number":8}`), 5*time.Minute, sentAt); err == nil {
+		t.Error("Expected mismatch with a tampered body")
+	}
+	if err := VerifySignature("s3cret", header, body, 5*time.Minute, sentAt.Add(time.Hour)); err == nil {
+		t.Error("Expected replayed signature to be rejected")
+	}
+}
+
+func TestSubscriberWants(t *testing.T) {
+	sub := Subscriber{Events: []string{EventCheckFailed}, Repos: []string{"acme/*"}}
+
+	tests := []struct {
+		event, repo string
+		want        bool
+	}{
+		{EventCheckFailed, "acme/api", true},
+		{EventPRProcessed, "acme/api", false},
+		{EventCheckFailed, "other/api", false},
+	}
+	for _, tt := range tests {
+		if got := sub.Wants(tt.event, tt.repo); got != tt.want {
+			t.Errorf("Wants(%s, %s) = %v, want %v", tt.event, tt.repo, got, tt.want)
+		}
+	}
+
+	if !(Subscriber{}).Wants(EventPolicyChanged, "any/repo") {
+		t.Error("Expected subscriber without filters to want everything")
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	os.Setenv("TEST_SUBSCRIBER_SECRET", "from-env")
+	defer os.Unsetenv("TEST_SUBSCRIBER_SECRET")
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "review-bot.json")
+	os.WriteFile(filename, []byte(`{"subscribers":[{"name":"ci","url":"http://example.test","secret":"${TEST_SUBSCRIBER_SECRET}","events":["policy_changed"]}]}`), 0o644)
+
+	settings, err := LoadSettings(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.Subscribers) != 1 || settings.Subscribers[0].Secret != "from-env" {
+		t.Errorf("Expected one subscriber with expanded secret, got %+v", settings.Subscribers)
+	}
+
+	os.WriteFile(filename, []byte(`{"subscribers":[{"name":"ci","url":"http://example.test","events":["nope"]}]}`), 0o644)
+	if _, err := LoadSettings(filename); err == nil {
+		t.Error("Expected unknown event to be rejected")
+	}
+
+	os.WriteFile(filename, []byte(`{"subscribers":[{"name":"default","url":"http://example.test","secret":"s"}]}`), 0o644)
+	if _, err := LoadSettings(filename); err == nil {
+		t.Error("Expected the legacy subscriber's name to be rejected")
+	}
+
+	if _, err := LoadSettings(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("Expected missing settings file to be ignored, got %v", err)
+	}
+}
+
+func TestPublishSignsPerSubscriber(t *testing.T) {
+	var mu sync.Mutex
+	headers := map[string]http.Header{}
+	bodies := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		headers[r.URL.Path] = r.Header
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	bot := NewReviewBot(NewConfig())
+	bot.outbox = NewOutbox(NewStore(t.TempDir()))
+	bot.outbox.SecretFor = bot.subscriberSecret
+	bot.config.Settings.Subscribers = []Subscriber{
+		{Name: "signed", URL: server.URL + "/signed", Secret: "s3cret"},
+		{Name: "plain", URL: server.URL + "/plain"},
+		{Name: "filtered", URL: server.URL + "/filtered", Events: []string{EventPolicyChanged}},
+	}
+
+	bot.publish(EventCheckFailed, "acme", "api", CheckFailure{Repository: "acme/api", PRNumber: 3})
+	bot.outbox.deliverDue(context.Background())
+
+	if _, ok := headers["/filtered"]; ok {
+		t.Error("Expected filtered subscriber not to receive check_failed")
+	}
+	if headers["/plain"].Get(signatureHeader) != "" {
+		t.Error("Expected no signature for subscriber without a secret")
+	}
+	signed := headers["/signed"]
+	if signed == nil {
+		t.Fatal("Expected signed subscriber to receive the event")
+	}
+	if signed.Get("X-ReviewBot-Event") != EventCheckFailed {
+		t.Errorf("Expected event header %s, got %s", EventCheckFailed, signed.Get("X-ReviewBot-Event"))
+	}
+	if err := VerifySignature("s3cret", signed.Get(signatureHeader), bodies["/signed"], time.Minute, time.Now()); err != nil {
+		t.Errorf("Expected delivered signature to verify, got %v", err)
+	}
+}
+
+func TestPublishEvaluationEmitsOnChange(t *testing.T) {
+	bot := NewReviewBot(NewConfig())
+	bot.outbox = NewOutbox(NewStore(t.TempDir()))
+	bot.config.Settings.Subscribers = []Subscriber{{Name: "all", URL: "http://example.test"}}
+
+	events := func() map[string]int {
+		counts := map[string]int{}
+		for _, event := range bot.outbox.events {
+			counts[event.Event]++
+		}
+		return counts
+	}
+
+	previous := Evaluation{Repository: "acme/api", PRNumber: 1, HeadSHA: "a", CanMerge: false, Reason: "Need 2 approvals, have 1"}
+	current := previous
+	current.CanMerge = true
+	current.Reason = "All merge policies satisfied"
+	current.Checks = []CheckResult{{Name: "security", Status: "failure"}}
+
+	bot.config.WebhookURL = "http://legacy.test"
+	bot.publishEvaluation("acme", "api", EvaluationChange{Current: current, Previous: previous, HadPrevious: true})
+	if got := events(); got[EventPolicyChanged] != 1 || got[EventCheckFailed] != 1 {
+		t.Errorf("Expected one policy_changed and one check_failed, got %v", got)
+	}
+	for _, event := range bot.outbox.events {
+		if event.Subscriber == legacySubscriber {
+			t.Errorf("Expected the legacy subscriber to only get pr_processed, got %s", event.Event)
+		}
+	}
+
+	// Same verdict again: nothing new to report
+	bot.publishEvaluation("acme", "api", EvaluationChange{Current: current, Previous: current, HadPrevious: true})
+	if got := events(); got[EventPolicyChanged] != 1 || got[EventCheckFailed] != 1 {
+		t.Errorf("Expected no additional events for an unchanged evaluation, got %v", got)
+	}
+}
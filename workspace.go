@@ -0,0 +1,316 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// ExecutorSettings enables the checks that build and run code from the pull
+// request. Source is "archive" (download a tarball of the head commit, the
+// default) or "mirror" (read it from a bare clone at
+// <mirror_dir>/<owner>/<repo>.git that something else keeps fetched).
+//
+// Pull request code is untrusted. RunAs ("uid:gid") runs it as a separate
+// user, which needs the bot to run as root or with CAP_SETUID; that user
+// must not be able to read CONFIG_FILE or DATA_DIR, and it can still reach
+// the network. Running it as the bot's own user lets it read the bot's
+// environment, GITHUB_TOKEN and ADMIN_TOKEN included, from /proc, so that
+// needs SameUser and is only safe when every PR comes from a trusted author.
+// Only runs as the bot's own user share the Go build and module caches in
+// CacheDir; each RunAs run starts from empty caches that go away with its
+// workspace, since a cache it could write to would let one pull request
+// plant build results or modules that later ones use.
+type ExecutorSettings struct {
+	Enabled      bool   `json:"enabled"`
+	Source       string `json:"source"`
+	MirrorDir    string `json:"mirror_dir"`
+	WorkDir      string `json:"work_dir"`
+	CacheDir     string `json:"cache_dir"`
+	Timeout      string `json:"timeout"`
+	CPUs         int    `json:"cpus"`
+	CPUSeconds   int    `json:"cpu_seconds"`
+	MemoryMB     int    `json:"memory_mb"`
+	MaxArchiveMB int    `json:"max_archive_mb"`
+	RunAs        string `json:"run_as"`
+	SameUser     bool   `json:"same_user"`
+}
+
+const (
+	SourceArchive = "archive"
+	SourceMirror  = "mirror"
+)
+
+func (s ExecutorSettings) validate() error {
+	switch s.Source {
+	case "", SourceArchive:
+	case SourceMirror:
+		if s.MirrorDir == "" {
+			return fmt.Errorf("source %q needs mirror_dir", s.Source)
+		}
+	default:
+		return fmt.Errorf("unknown source %q", s.Source)
+	}
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("bad timeout: %w", err)
+		}
+	}
+	if s.RunAs != "" {
+		if _, _, err := s.runAs(); err != nil {
+			return err
+		}
+	} else if s.Enabled && !s.SameUser {
+		return fmt.Errorf("run_as is required to run pull request code; same_user runs it as the bot, exposing the bot's credentials to it")
+	}
+	return nil
+}
+
+// runAs parses RunAs.
+func (s ExecutorSettings) runAs() (uid, gid uint32, err error) {
+	u, g, ok := strings.Cut(s.RunAs, ":")
+	uid64, uidErr := strconv.ParseUint(u, 10, 32)
+	gid64, gidErr := strconv.ParseUint(g, 10, 32)
+	if !ok || uidErr != nil || gidErr != nil {
+		return 0, 0, fmt.Errorf("bad run_as %q: want numeric uid:gid", s.RunAs)
+	}
+	return uint32(uid64), uint32(gid64), nil
+}
+
+// timeout is the wall-clock limit for one command, 10 minutes by default.
+func (s ExecutorSettings) timeout() time.Duration {
+	if d, err := time.ParseDuration(s.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+func (s ExecutorSettings) maxArchiveBytes() int64 {
+	if s.MaxArchiveMB > 0 {
+		return int64(s.MaxArchiveMB) << 20
+	}
+	return 200 << 20
+}
+
+func (s ExecutorSettings) cacheDir() string {
+	if s.CacheDir != "" {
+		return s.CacheDir
+	}
+	return filepath.Join(os.TempDir(), "review-bot-cache")
+}
+
+// Workspace is a throwaway checkout of one commit.
+type Workspace struct {
+	Dir string
+	// root is the temporary directory holding Dir and the sandbox's HOME
+	// and TMPDIR.
+	root string
+}
+
+func (ws *Workspace) Close() error {
+	return os.RemoveAll(ws.root)
+}
+
+// checkoutWorkspace materialises the tree at sha into a fresh temporary
+// directory. The caller must Close the workspace.
+func (rb *ReviewBot) checkoutWorkspace(ctx context.Context, owner, repo, sha string) (*Workspace, error) {
+	settings := rb.config.Settings.Executor
+	ctx, span := tracer().Start(ctx, "checkoutWorkspace")
+	defer span.End()
+
+	root, err := os.MkdirTemp(settings.WorkDir, "review-bot-")
+	if err != nil {
+		return nil, err
+	}
+	ws := &Workspace{Dir: filepath.Join(root, "src"), root: root}
+	for _, dir := range []string{ws.Dir, filepath.Join(root, "home"), filepath.Join(root, "tmp")} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			ws.Close()
+			return nil, err
+		}
+	}
+
+	if settings.Source == SourceMirror {
+		err = checkoutFromMirror(ctx, filepath.Join(settings.MirrorDir, owner, repo+".git"), sha, ws.Dir, settings.maxArchiveBytes())
+	} else {
+		err = rb.checkoutFromArchive(ctx, owner, repo, sha, ws.Dir, settings.maxArchiveBytes())
+	}
+	if err == nil && settings.RunAs != "" {
+		err = handOver(ws, settings)
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		ws.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// goCacheDir is where commands run in ws keep the Go build and module
+// caches.
+func (ws *Workspace) goCacheDir(settings ExecutorSettings) string {
+	if settings.RunAs != "" {
+		return filepath.Join(ws.root, "cache")
+	}
+	return settings.cacheDir()
+}
+
+// handOver gives the RunAs user the workspace, its caches included, which it
+// writes to while building and testing.
+func handOver(ws *Workspace, settings ExecutorSettings) error {
+	uid, gid, err := settings.runAs()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ws.goCacheDir(settings), 0o755); err != nil {
+		return err
+	}
+	return filepath.WalkDir(ws.root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, int(uid), int(gid))
+	})
+}
+
+func (rb *ReviewBot) checkoutFromArchive(ctx context.Context, owner, repo, sha, dest string, limit int64) error {
+	link, _, err := rb.client.Repositories.GetArchiveLink(ctx, owner, repo, github.Tarball, &github.RepositoryContentGetOptions{Ref: sha}, 1)
+	if err != nil {
+		return fmt.Errorf("getting archive link: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := rb.client.Client().Do(req)
+	if err != nil {
+		return fmt.Errorf("downloading archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading archive: unexpected status %s", resp.Status)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+	// GitHub tarballs wrap everything in an <owner>-<repo>-<sha>/ directory.
+	return extractTar(gz, dest, 1, limit)
+}
+
+func checkoutFromMirror(ctx context.Context, gitDir, sha, dest string, limit int64) error {
+	if _, err := os.Stat(gitDir); err != nil {
+		return fmt.Errorf("no mirror for repository: %w", err)
+	}
+
+	// The mirror may be behind; fetching a commit it already has is cheap.
+	if err := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "cat-file", "-e", sha+"^{commit}").Run(); err != nil {
+		fetch := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "fetch", "--quiet", "origin", sha)
+		if out, err := fetch.CombinedOutput(); err != nil {
+			return fmt.Errorf("fetching %s into mirror: %v: %s", shortSHA(sha), err, bytes.TrimSpace(out))
+		}
+	}
+
+	archive := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "archive", "--format=tar", sha)
+	var stderr bytes.Buffer
+	archive.Stderr = &stderr
+	stdout, err := archive.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := archive.Start(); err != nil {
+		return err
+	}
+	extractErr := extractTar(stdout, dest, 0, limit)
+	if extractErr != nil {
+		// Unblock git if extraction stopped early.
+		io.Copy(io.Discard, stdout)
+	}
+	if err := archive.Wait(); err != nil {
+		return fmt.Errorf("git archive: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return extractErr
+}
+
+// extractTar unpacks regular files, directories and relative symlinks from r
+// into dest, dropping the first strip path components. Entries that would
+// land outside dest are rejected, as is an archive whose files add up to more
+// than limit bytes.
+func extractTar(r io.Reader, dest string, strip int, limit int64) error {
+	tr := tar.NewReader(r)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+
+		parts := strings.Split(strings.Trim(filepath.ToSlash(hdr.Name), "/"), "/")
+		if len(parts) <= strip {
+			continue
+		}
+		name := filepath.FromSlash(strings.Join(parts[strip:], "/"))
+		target := filepath.Join(dest, name)
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %q escapes the workspace", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > limit {
+				return fmt.Errorf("archive is larger than %d MB", limit>>20)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			mode := os.FileMode(0o644)
+			if hdr.Mode&0o111 != 0 {
+				mode = 0o755
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, io.LimitReader(tr, hdr.Size))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			resolved := filepath.Join(filepath.Dir(target), hdr.Linkname)
+			if filepath.IsAbs(hdr.Linkname) || !strings.HasPrefix(resolved, filepath.Clean(dest)+string(os.PathSeparator)) {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}